@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// uploadCandidate is an upload that can run on the client, with its best channel
+type uploadCandidate struct {
+	upload   *models.Upload
+	archRank int
+	channel  *models.Channel
+	head     *models.Build
+}
+
+// findChannelHead returns a channel of an upload with its last completed head
+// build: the preferred channel if the upload has it and it has a completed
+// build, otherwise the channel whose last completed head is newest
+func findChannelHead(db models.Database, upload *models.Upload, preferred string) (*models.Channel, *models.Build, error) {
+	channels, err := db.GetChannelsByUploadID(upload.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bestChannel *models.Channel
+	var bestHead *models.Build
+	for _, channel := range channels {
+		build, err := lastCompletedHead(db, channel)
+		if err != nil {
+			return nil, nil, err
+		}
+		if build == nil {
+			continue
+		}
+		if preferred != "" && channel.Name == preferred {
+			return channel, build, nil
+		}
+		if bestHead == nil || build.ID > bestHead.ID ||
+			(build.ID == bestHead.ID && channel.Name < bestChannel.Name) {
+			bestChannel, bestHead = channel, build
+		}
+	}
+	return bestChannel, bestHead, nil
+}
+
+// uploadChannelHead returns the channel an upload is offered from with its last
+// completed head. A channel asked for by name must exist on the upload;
+// otherwise the default channel is preferred (see findChannelHead).
+func uploadChannelHead(db models.Database, upload *models.Upload, channelName, defaultChannel string) (*models.Channel, *models.Build, error) {
+	if channelName == "" {
+		return findChannelHead(db, upload, defaultChannel)
+	}
+
+	channel, err := db.GetChannelByName(channelName, upload.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := lastCompletedHead(db, channel)
+	if err != nil || head == nil {
+		return nil, nil, err
+	}
+	return channel, head, nil
+}
+
+// GET /games/{id}/uploads/best?os=windows&arch=amd64 - Pick the upload a client should install
+//
+// Each upload offers the last completed build of ?channel= when given, otherwise
+// of the game's default channel, falling back to its newest completed build on
+// any channel. Uploads that don't run on the client's OS, or have no such
+// build, are skipped. The rest are ranked by:
+//  1. architecture: exact match, then uploads listing no architecture, then emulated
+//  2. fewer platforms, so a windows-only upload beats a cross-platform one
+//  3. newest head build
+//  4. lowest upload id
+func (h *CoreHandlers) GetBestUpload(w http.ResponseWriter, r *http.Request) {
+	gameIDStr := mux.Vars(r)["id"]
+	gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid game id")
+		return
+	}
+
+	platform := r.URL.Query().Get("os")
+	arch := r.URL.Query().Get("arch")
+	if platform == "" {
+		writeErrors(w, http.StatusBadRequest, "missing os")
+		return
+	}
+	var archs []string
+	if arch != "" {
+		archs = []string{arch}
+	}
+	if err := models.ValidatePlatforms([]string{platform}, archs); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, game, err := viewableGame(h.db, r, gameID)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	uploads, err := h.db.GetUploadsByGameID(gameID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	channelName := r.URL.Query().Get("channel")
+	var candidates []*uploadCandidate
+	for _, upload := range uploads {
+		if !upload.SupportsPlatform(platform, "") {
+			continue
+		}
+		archRank, ok := upload.ArchRank(platform, arch)
+		if !ok {
+			continue
+		}
+
+		channel, head, err := uploadChannelHead(h.db, upload, channelName, game.DefaultChannel)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if head == nil {
+			continue
+		}
+
+		candidates = append(candidates, &uploadCandidate{upload: upload, archRank: archRank, channel: channel, head: head})
+	}
+
+	if len(candidates) == 0 {
+		if channelName != "" {
+			writeErrors(w, http.StatusNotFound, fmt.Sprintf("no upload for %s on channel '%s'", platformLabel(platform, arch), channelName))
+			return
+		}
+		writeErrors(w, http.StatusNotFound, fmt.Sprintf("no upload for %s", platformLabel(platform, arch)))
+		return
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.archRank != b.archRank {
+			return a.archRank < b.archRank
+		}
+		if len(a.upload.Platforms) != len(b.upload.Platforms) {
+			return len(a.upload.Platforms) < len(b.upload.Platforms)
+		}
+		if a.head.ID != b.head.ID {
+			return a.head.ID > b.head.ID
+		}
+		return a.upload.ID < b.upload.ID
+	})
+	best := candidates[0]
+
+	buildFiles, err := h.db.GetBuildFilesByBuildID(best.head.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var filesResponse []map[string]interface{}
+	for _, file := range buildFiles {
+		if file.State != "uploaded" {
+			continue
+		}
+		filesResponse = append(filesResponse, map[string]interface{}{
+			"id":           file.ID,
+			"type":         file.Type,
+			"sub_type":     file.SubType,
+			"size":         file.Size,
+			"download_url": fmt.Sprintf("/builds/%d/downloads/%d", best.head.ID, file.ID),
+		})
+	}
+
+	response := map[string]interface{}{
+		"upload": map[string]interface{}{
+			"id":            best.upload.ID,
+			"filename":      best.upload.Filename,
+			"display_name":  best.upload.DisplayName,
+			"platforms":     best.upload.Platforms,
+			"architectures": best.upload.Architectures,
+		},
+		"channel": map[string]interface{}{
+			"name": best.channel.Name,
+		},
+		"build": map[string]interface{}{
+			"id":           best.head.ID,
+			"user_version": best.head.UserVersion,
+			"created_at":   best.head.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		},
+		"download": map[string]interface{}{
+			"url":   fmt.Sprintf("/uploads/%d/download?channel=%s", best.upload.ID, url.QueryEscape(best.channel.Name)),
+			"files": filesResponse,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// platformLabel formats a client platform for messages, e.g. "windows/amd64"
+func platformLabel(platform, arch string) string {
+	if arch == "" {
+		return platform
+	}
+	return platform + "/" + arch
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxChangelogDepth bounds how far back a changelog walks the parent chain
+const maxChangelogDepth = 1000
+
+// changelogEntry is the release notes of one build in a changelog
+type changelogEntry struct {
+	BuildID      int64  `json:"build_id"`
+	UserVersion  string `json:"user_version"`
+	ReleaseNotes string `json:"release_notes"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// buildChangelog collects the release notes from head back through its
+// parents, newest first, stopping before the build with id sinceID. Builds
+// that aren't completed or have no notes are left out. A limit of 0 means no
+// limit. The returned bool reports whether sinceID was found among the ancestors.
+func (h *WharfHandlers) buildChangelog(head *models.Build, sinceID int64, limit int) ([]*changelogEntry, bool, error) {
+	entries := []*changelogEntry{}
+
+	build := head
+	for depth := 0; depth < maxChangelogDepth; depth++ {
+		if build.ID == sinceID {
+			return entries, true, nil
+		}
+
+		if build.State == "completed" && build.ReleaseNotes != "" {
+			entries = append(entries, &changelogEntry{
+				BuildID:      build.ID,
+				UserVersion:  build.UserVersion,
+				ReleaseNotes: build.ReleaseNotes,
+				CreatedAt:    build.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			})
+			if limit > 0 && len(entries) >= limit {
+				break
+			}
+		}
+
+		if build.ParentBuildID == nil {
+			break
+		}
+		parent, err := h.db.GetBuildByID(*build.ParentBuildID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get parent build: %w", err)
+		}
+		build = parent
+	}
+
+	return entries, false, nil
+}
+
+// PUT /wharf/builds/{id}/release-notes - Set the markdown release notes of a build.
+// Takes {"release_notes": "..."} as JSON, or the markdown itself as the request body.
+func (h *WharfHandlers) SetBuildReleaseNotes(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "could not read request body")
+		return
+	}
+
+	var releaseNotes string
+	if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			ReleaseNotes string `json:"release_notes"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+			return
+		}
+		releaseNotes = req.ReleaseNotes
+	} else {
+		releaseNotes = string(body)
+	}
+
+	build, _, err := h.resolveBuild(user, mux.Vars(r)["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	build.ReleaseNotes = releaseNotes
+	if err := h.db.UpdateBuild(build); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s set release notes of build %d\n", user.Username, build.ID)
+
+	response := map[string]interface{}{
+		"build": map[string]interface{}{
+			"id":            build.ID,
+			"user_version":  build.UserVersion,
+			"release_notes": build.ReleaseNotes,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /games/{id}/channels/{channel}/changelog - Release notes of a channel's builds, newest first
+func (h *WharfHandlers) GetChannelChangelog(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid game id")
+		return
+	}
+
+	query := r.URL.Query()
+
+	var sinceID int64
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		sinceID, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, "invalid since build id")
+			return
+		}
+	}
+
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			writeErrors(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "markdown" {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid format '%s', expected json or markdown", format))
+		return
+	}
+
+	if _, _, err := viewableGame(h.db, r, gameID); err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	channel, _, err := h.findGameChannel(gameID, vars["channel"])
+	if err != nil {
+		if errors.Is(err, errChannelNotFound) {
+			writeErrors(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	entries := []*changelogEntry{}
+	if channel.CurrentBuildID != nil {
+		head, err := h.db.GetBuildByID(*channel.CurrentBuildID)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		entries, _, err = h.buildChangelog(head, sinceID, limit)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if format == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		for _, entry := range entries {
+			title := entry.UserVersion
+			if title == "" {
+				title = fmt.Sprintf("Build %d", entry.BuildID)
+			}
+			fmt.Fprintf(w, "## %s (%s)\n\n%s\n\n", title, entry.CreatedAt[:10], strings.TrimSpace(entry.ReleaseNotes))
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"channel":   channel.Name,
+		"changelog": entries,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
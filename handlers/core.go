@@ -3,20 +3,55 @@ package handlers
 import (
 	"butler-server/auth"
 	"butler-server/models"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
 )
 
 type CoreHandlers struct {
-	db models.Database
+	db          models.Database
+	minioClient *minio.Client
+	bucketName  string
 }
 
-func NewCoreHandlers(db models.Database) *CoreHandlers {
-	return &CoreHandlers{db: db}
+func NewCoreHandlers(db models.Database, minioClient *minio.Client, bucketName string) *CoreHandlers {
+	return &CoreHandlers{db: db, minioClient: minioClient, bucketName: bucketName}
+}
+
+// parsePlatformFilter reads and validates the ?platform= and ?arch= filters of list endpoints
+func parsePlatformFilter(r *http.Request) (platform, arch string, err error) {
+	platform = r.URL.Query().Get("platform")
+	arch = r.URL.Query().Get("arch")
+
+	var platforms, archs []string
+	if platform != "" {
+		platforms = []string{platform}
+	}
+	if arch != "" {
+		archs = []string{arch}
+	}
+	return platform, arch, models.ValidatePlatforms(platforms, archs)
+}
+
+// filterUploads keeps the uploads that run on the given platform and architecture
+func filterUploads(uploads []*models.Upload, platform, arch string) []*models.Upload {
+	if platform == "" && arch == "" {
+		return uploads
+	}
+	var filtered []*models.Upload
+	for _, upload := range uploads {
+		if upload.SupportsPlatform(platform, arch) {
+			filtered = append(filtered, upload)
+		}
+	}
+	return filtered
 }
 
 // GET /profile - Get current user profile
@@ -39,14 +74,126 @@ func (h *CoreHandlers) GetProfile(w http.ResponseWriter, r *http.Request) {
 func (h *CoreHandlers) GetProfileGames(w http.ResponseWriter, r *http.Request) {
 	user := auth.MustGetUser(r.Context())
 
-	games, err := h.db.GetGamesByUserID(user.ID)
+	platform, arch, err := parsePlatformFilter(r)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := parseListPage(r, []string{"id", "title", "created_at"}, "id", defaultPageLimit)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Platforms are matched here rather than by the database, so the page is cut after filtering
+	options := page.fetchOptions()
+	if platform != "" || arch != "" {
+		options.Limit = 0
+	}
+
+	games, err := h.db.ListGamesByUserID(user.ID, options)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
 
+	if platform != "" || arch != "" {
+		var filtered []*models.Game
+		for _, game := range games {
+			uploads, err := h.db.GetUploadsByGameID(game.ID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
+				return
+			}
+			if len(filterUploads(uploads, platform, arch)) > 0 {
+				filtered = append(filtered, game)
+			}
+			if _, more := page.trim(len(filtered)); more {
+				break
+			}
+		}
+		games = filtered
+	}
+
+	n, more := page.trim(len(games))
+	games = games[:n]
+
+	var next string
+	if more {
+		last := games[n-1]
+		var value string
+		switch page.options.Sort {
+		case "title":
+			value = last.Title
+		case "created_at":
+			value = cursorTime(last.CreatedAt)
+		}
+		next = page.cursorAfter(value, last.ID)
+	}
+
 	response := map[string]interface{}{
-		"games": games,
+		"games":      games,
+		"pagination": page.response(next, map[string]string{"platform": platform, "arch": arch}),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /games/search?q= - Search games by title, short text and owner username.
+// Anonymous users find public games, signed in users also their own, admins all.
+func (h *CoreHandlers) SearchGames(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeErrors(w, http.StatusBadRequest, "missing search query, expected ?q=")
+		return
+	}
+
+	page, err := parseListPage(r, []string{"relevance", "id", "title", "created_at"}, "relevance", defaultPageLimit)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	search := models.GameSearch{Query: query}
+	if user := requestUser(r); user != nil {
+		search.IncludeUserID = user.ID
+		search.AllGames = user.IsAdmin()
+	}
+
+	results, err := h.db.SearchGames(search, page.fetchOptions())
+	if err != nil {
+		http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	n, more := page.trim(len(results))
+	results = results[:n]
+
+	var next string
+	if more {
+		last := results[n-1]
+		var value string
+		switch page.options.Sort {
+		case "relevance":
+			value = strconv.FormatFloat(last.Rank, 'g', -1, 64)
+		case "title":
+			value = last.Game.Title
+		case "created_at":
+			value = cursorTime(last.Game.CreatedAt)
+		}
+		next = page.cursorAfter(value, last.Game.ID)
+	}
+
+	games := make([]map[string]interface{}, 0, len(results))
+	for _, result := range results {
+		games = append(games, gameResponse(result.Owner, result.Game))
+	}
+
+	response := map[string]interface{}{
+		"games":      games,
+		"pagination": page.response(next, map[string]string{"q": query}),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -62,26 +209,14 @@ func (h *CoreHandlers) GetGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, game, err := h.db.GetGameByID(gameID)
+	user, game, err := viewableGame(h.db, r, gameID)
 	if err != nil {
-		http.Error(w, `{"errors":["game not found"]}`, http.StatusNotFound)
+		writeTargetError(w, err)
 		return
 	}
 
 	response := map[string]interface{}{
-		"game": map[string]interface{}{
-			"id":             game.ID,
-			"title":          game.Title,
-			"short_text":     game.ShortText,
-			"type":           game.Type,
-			"classification": game.Classification,
-			"url":            game.URL,
-			"user": map[string]interface{}{
-				"id":           user.ID,
-				"username":     user.Username,
-				"display_name": user.DisplayName,
-			},
-		},
+		"game": gameResponse(user, game),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -97,35 +232,72 @@ func (h *CoreHandlers) GetGameUploads(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if game exists
-	_, _, err = h.db.GetGameByID(gameID)
+	// Check if game exists and is visible
+	_, _, err = viewableGame(h.db, r, gameID)
 	if err != nil {
-		http.Error(w, `{"errors":["game not found"]}`, http.StatusNotFound)
+		writeTargetError(w, err)
 		return
 	}
 
-	uploads, err := h.db.GetUploadsByGameID(gameID)
+	platform, arch, err := parsePlatformFilter(r)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := parseListPage(r, []string{"id", "filename", "created_at"}, "id", defaultPageLimit)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Platforms are matched here rather than by the database, so the page is cut after filtering
+	options := page.fetchOptions()
+	if platform != "" || arch != "" {
+		options.Limit = 0
+	}
+
+	uploads, err := h.db.ListUploadsByGameID(gameID, options)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
+	uploads = filterUploads(uploads, platform, arch)
+
+	n, more := page.trim(len(uploads))
+	uploads = uploads[:n]
+
+	var next string
+	if more {
+		last := uploads[n-1]
+		var value string
+		switch page.options.Sort {
+		case "filename":
+			value = last.Filename
+		case "created_at":
+			value = cursorTime(last.CreatedAt)
+		}
+		next = page.cursorAfter(value, last.ID)
+	}
 
 	// Convert uploads to response format
 	var uploadsResponse []map[string]interface{}
 	for _, upload := range uploads {
 		uploadsResponse = append(uploadsResponse, map[string]interface{}{
-			"id":           upload.ID,
-			"filename":     upload.Filename,
-			"display_name": upload.DisplayName,
-			"size":         upload.Size,
-			"storage":      upload.Storage,
-			"type":         upload.Type,
-			"platforms":    upload.Platforms,
+			"id":            upload.ID,
+			"filename":      upload.Filename,
+			"display_name":  upload.DisplayName,
+			"size":          upload.Size,
+			"storage":       upload.Storage,
+			"type":          upload.Type,
+			"platforms":     upload.Platforms,
+			"architectures": upload.Architectures,
 		})
 	}
 
 	response := map[string]interface{}{
-		"uploads": uploadsResponse,
+		"uploads":    uploadsResponse,
+		"pagination": page.response(next, map[string]string{"platform": platform, "arch": arch}),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -141,22 +313,14 @@ func (h *CoreHandlers) GetUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	upload, err := h.db.GetUploadByID(uploadID)
+	upload, err := viewableUpload(h.db, r, uploadID)
 	if err != nil {
-		http.Error(w, `{"errors":["upload not found"]}`, http.StatusNotFound)
+		writeTargetError(w, err)
 		return
 	}
 
 	response := map[string]interface{}{
-		"upload": map[string]interface{}{
-			"id":           upload.ID,
-			"filename":     upload.Filename,
-			"display_name": upload.DisplayName,
-			"size":         upload.Size,
-			"storage":      upload.Storage,
-			"type":         upload.Type,
-			"platforms":    upload.Platforms,
-		},
+		"upload": uploadResponse(upload),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -172,19 +336,135 @@ func (h *CoreHandlers) GetUploadBuilds(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if upload exists
-	_, err = h.db.GetUploadByID(uploadID)
+	// Check if upload exists and its game is visible
+	_, err = viewableUpload(h.db, r, uploadID)
 	if err != nil {
-		http.Error(w, `{"errors":["upload not found"]}`, http.StatusNotFound)
+		writeTargetError(w, err)
 		return
 	}
 
-	builds, err := h.db.GetBuildsByUploadID(uploadID)
+	query := r.URL.Query()
+
+	page, err := parseListPage(r, []string{"id", "created_at", "version"}, "-id", defaultPageLimit)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := models.BuildFilter{
+		State:       query.Get("state"),
+		UserVersion: query.Get("user_version"),
+	}
+	if filter.CreatedAfter, err = parseTimeFilter(r, "created_after"); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.CreatedBefore, err = parseTimeFilter(r, "created_before"); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var constraint *models.VersionConstraint
+	if versionPattern := query.Get("version"); versionPattern != "" {
+		constraint, err = models.ParseVersionConstraint(versionPattern)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	wantLabels := query["label"]
+
+	// Version patterns, labels and version order are handled here rather than
+	// by the database, so the page is cut after them
+	options := page.fetchOptions()
+	versionSort := page.options.Sort == "version"
+	if versionSort {
+		options = models.ListOptions{}
+	} else if constraint != nil || len(wantLabels) > 0 {
+		options.Limit = 0
+	}
+
+	builds, err := h.db.ListBuilds(uploadID, filter, options)
 	if err != nil {
 		http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
 
+	// Optional semver filtering, e.g. ?version=1.2.x
+	if constraint != nil {
+		builds = models.FilterBuildsByVersion(builds, constraint)
+	}
+
+	labels, err := h.db.GetBuildLabelsByUploadID(uploadID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Optional label filtering, e.g. ?label=qa-approved; repeated labels must all be present
+	if len(wantLabels) > 0 {
+		var labeled []*models.Build
+		for _, build := range builds {
+			hasAll := true
+			for _, label := range wantLabels {
+				if !models.Contains(labels[build.ID], label) {
+					hasAll = false
+					break
+				}
+			}
+			if hasAll {
+				labeled = append(labeled, build)
+			}
+		}
+		builds = labeled
+	}
+
+	if versionSort {
+		models.SortBuildsByVersion(builds, !page.options.Descending)
+
+		// The cursor is the last build of the previous page
+		if after := page.options.After; after != nil {
+			start := -1
+			for i, build := range builds {
+				if build.ID == after.ID {
+					start = i + 1
+					break
+				}
+			}
+			if start < 0 {
+				writeErrors(w, http.StatusBadRequest, "cursor build is no longer listed")
+				return
+			}
+			builds = builds[start:]
+		}
+	}
+
+	n, more := page.trim(len(builds))
+	builds = builds[:n]
+
+	var next string
+	if more {
+		last := builds[n-1]
+		var value string
+		switch page.options.Sort {
+		case "created_at":
+			value = cursorTime(last.CreatedAt)
+		case "version":
+			value = last.UserVersion
+		}
+		next = page.cursorAfter(value, last.ID)
+	}
+
+	// Metadata can name private branches and CI jobs, so only the owner sees it
+	var metadata map[int64]map[string]string
+	if managesUpload(h.db, r, uploadID) {
+		metadata, err = h.db.GetBuildMetadataByUploadID(uploadID)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	// Convert builds to response format
 	var buildsResponse []map[string]interface{}
 	for _, build := range builds {
@@ -195,6 +475,14 @@ func (h *CoreHandlers) GetUploadBuilds(w http.ResponseWriter, r *http.Request) {
 			"created_at":   build.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		}
 
+		if buildLabels := labels[build.ID]; buildLabels != nil {
+			buildData["labels"] = buildLabels
+		}
+
+		if buildMetadata := metadata[build.ID]; buildMetadata != nil {
+			buildData["metadata"] = buildMetadata
+		}
+
 		if build.ParentBuildID != nil {
 			buildData["parent_build_id"] = *build.ParentBuildID
 		}
@@ -202,8 +490,18 @@ func (h *CoreHandlers) GetUploadBuilds(w http.ResponseWriter, r *http.Request) {
 		buildsResponse = append(buildsResponse, buildData)
 	}
 
+	filters := map[string]string{
+		"state":          filter.State,
+		"user_version":   filter.UserVersion,
+		"created_after":  query.Get("created_after"),
+		"created_before": query.Get("created_before"),
+		"version":        query.Get("version"),
+		"label":          strings.Join(wantLabels, ","),
+	}
+
 	response := map[string]interface{}{
-		"builds": buildsResponse,
+		"builds":     buildsResponse,
+		"pagination": page.response(next, filters),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -219,9 +517,9 @@ func (h *CoreHandlers) GetBuild(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	build, err := h.db.GetBuildByID(buildID)
+	build, err := viewableBuild(h.db, r, buildID)
 	if err != nil {
-		http.Error(w, `{"errors":["build not found"]}`, http.StatusNotFound)
+		writeTargetError(w, err)
 		return
 	}
 
@@ -237,6 +535,27 @@ func (h *CoreHandlers) GetBuild(w http.ResponseWriter, r *http.Request) {
 		buildData["parent_build_id"] = *build.ParentBuildID
 	}
 
+	if build.ReleaseNotes != "" {
+		buildData["release_notes"] = build.ReleaseNotes
+	}
+
+	labels, err := h.db.GetBuildLabels(build.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	buildData["labels"] = labels
+
+	// Metadata can name private branches and CI jobs, so only the owner sees it
+	if managesUpload(h.db, r, build.UploadID) {
+		metadata, err := h.db.GetBuildMetadata(build.ID)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		buildData["metadata"] = metadata
+	}
+
 	response := map[string]interface{}{
 		"build": buildData,
 	}
@@ -245,27 +564,138 @@ func (h *CoreHandlers) GetBuild(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// GET /uploads/{id}/download - Generate download URL for upload
-func (h *CoreHandlers) GetUploadDownload(w http.ResponseWriter, r *http.Request) {
-	uploadIDStr := mux.Vars(r)["id"]
-	uploadID, err := strconv.ParseInt(uploadIDStr, 10, 64)
+// GET /games/{id}/builds/latest - Resolve the highest version on a channel or matching a pattern
+func (h *CoreHandlers) GetLatestBuild(w http.ResponseWriter, r *http.Request) {
+	gameIDStr := mux.Vars(r)["id"]
+	gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
 	if err != nil {
-		http.Error(w, `{"errors":["invalid upload id"]}`, http.StatusBadRequest)
+		http.Error(w, `{"errors":["invalid game id"]}`, http.StatusBadRequest)
+		return
+	}
+
+	_, _, err = viewableGame(h.db, r, gameID)
+	if err != nil {
+		writeTargetError(w, err)
 		return
 	}
 
-	upload, err := h.db.GetUploadByID(uploadID)
+	var constraint *models.VersionConstraint
+	if versionPattern := r.URL.Query().Get("version"); versionPattern != "" {
+		constraint, err = models.ParseVersionConstraint(versionPattern)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	uploads, err := h.db.GetUploadsByGameID(gameID)
 	if err != nil {
-		http.Error(w, `{"errors":["upload not found"]}`, http.StatusNotFound)
+		http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
 		return
 	}
 
-	// For now, just generate a simple download URL
-	// In a real implementation, this would be a signed URL with expiration
-	downloadURL := fmt.Sprintf("http://localhost:8080/downloads/uploads/%d/%s", upload.ID, upload.Filename)
+	// On a channel the candidates are the builds it has held as its head,
+	// otherwise every build of the game
+	channelName := r.URL.Query().Get("channel")
+	var channel *models.Channel
+	if channelName != "" {
+		for _, upload := range uploads {
+			c, err := h.db.GetChannelByName(channelName, upload.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				writeErrors(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			channel = c
+			break
+		}
+		if channel == nil {
+			http.Error(w, `{"errors":["channel not found"]}`, http.StatusNotFound)
+			return
+		}
+	}
+
+	var builds []*models.Build
+	if channel != nil {
+		buildIDs, err := channelBuildIDs(h.db, channel)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, id := range buildIDs {
+			build, err := h.db.GetBuildByID(id)
+			if errors.Is(err, sql.ErrNoRows) {
+				// Expired builds stay in the channel's history
+				continue
+			}
+			if err != nil {
+				writeErrors(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if build.State == "completed" {
+				builds = append(builds, build)
+			}
+		}
+	} else {
+		for _, upload := range uploads {
+			uploadBuilds, err := h.db.GetBuildsByUploadID(upload.ID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
+				return
+			}
+			for _, build := range uploadBuilds {
+				if build.State == "completed" {
+					builds = append(builds, build)
+				}
+			}
+		}
+	}
+
+	if constraint != nil {
+		builds = models.FilterBuildsByVersion(builds, constraint)
+	}
+	models.SortBuildsByVersion(builds, false)
+
+	var latest *models.Build
+	if len(builds) > 0 {
+		if _, err := models.ParseSemver(builds[0].UserVersion); err == nil {
+			latest = builds[0]
+		}
+	}
+
+	// Channels without any semver builds fall back to their current head
+	if latest == nil && constraint == nil && channel != nil && channel.CurrentBuildID != nil {
+		latest, err = h.db.GetBuildByID(*channel.CurrentBuildID)
+		if err != nil {
+			latest = nil
+		}
+	}
+
+	if latest == nil {
+		http.Error(w, `{"errors":["no matching build found"]}`, http.StatusNotFound)
+		return
+	}
+
+	buildData := map[string]interface{}{
+		"id":           latest.ID,
+		"upload_id":    latest.UploadID,
+		"user_version": latest.UserVersion,
+		"state":        latest.State,
+		"created_at":   latest.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+
+	if latest.ParentBuildID != nil {
+		buildData["parent_build_id"] = *latest.ParentBuildID
+	}
+
+	if v, err := models.ParseSemver(latest.UserVersion); err == nil {
+		buildData["semver"] = v
+	}
 
 	response := map[string]interface{}{
-		"url": downloadURL,
+		"build": buildData,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
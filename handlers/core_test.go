@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetLatestBuildOnChannel(t *testing.T) {
+	db, err := models.NewSQLiteDatabase(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	user := &models.User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &models.Game{UserID: user.ID, Title: "space-game", Visibility: models.GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+	upload := &models.Upload{GameID: game.ID, Filename: "game.zip"}
+	if err := db.CreateUpload(upload); err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+
+	// Both channels share the upload; main went 1.0.0 -> 1.1.0 -> a failed
+	// 3.0.0 push, beta only ever held 2.0.0-beta.1
+	ids := map[string]int64{}
+	for _, version := range []string{"1.0.0", "2.0.0-beta.1", "1.1.0", "3.0.0"} {
+		build := &models.Build{UploadID: upload.ID, UserVersion: version, State: "completed"}
+		if version == "3.0.0" {
+			build.State = "failed"
+		}
+		if err := db.CreateBuild(build); err != nil {
+			t.Fatalf("failed to create build: %v", err)
+		}
+		ids[version] = build.ID
+	}
+	heads := map[string][]string{
+		"main": {"1.0.0", "1.1.0", "3.0.0"},
+		"beta": {"2.0.0-beta.1"},
+	}
+	for name, versions := range heads {
+		current := ids[versions[len(versions)-1]]
+		channel := &models.Channel{Name: name, UploadID: upload.ID, CurrentBuildID: &current}
+		if err := db.CreateChannel(channel); err != nil {
+			t.Fatalf("failed to create channel: %v", err)
+		}
+		var previous *int64
+		for _, version := range versions {
+			id := ids[version]
+			entry := &models.ChannelHistoryEntry{ChannelID: channel.ID, PreviousBuildID: previous, BuildID: &id, Reason: "push", Username: user.Username}
+			if err := db.CreateChannelHistoryEntry(entry); err != nil {
+				t.Fatalf("failed to create channel history entry: %v", err)
+			}
+			previous = &id
+		}
+	}
+
+	h := NewCoreHandlers(db, nil, "bucket")
+	r := mux.NewRouter()
+	r.HandleFunc("/games/{id}/builds/latest", h.GetLatestBuild)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		want       string
+	}{
+		{query: "channel=main", wantStatus: http.StatusOK, want: "1.1.0"},
+		{query: "channel=beta", wantStatus: http.StatusOK, want: "2.0.0-beta.1"},
+		{query: "", wantStatus: http.StatusOK, want: "2.0.0-beta.1"},
+		{query: "channel=main&version=1.0.x", wantStatus: http.StatusOK, want: "1.0.0"},
+		{query: "channel=beta&version=1.x", wantStatus: http.StatusNotFound},
+		{query: "channel=nightly", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/games/%d/builds/latest?%s", game.ID, tt.query), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Build struct {
+					ID int64 `json:"id"`
+				} `json:"build"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if response.Build.ID != ids[tt.want] {
+				t.Errorf("expected build %d (%s), got %d", ids[tt.want], tt.want, response.Build.ID)
+			}
+		})
+	}
+}
+
+func TestGetBestUploadChannel(t *testing.T) {
+	db, err := models.NewSQLiteDatabase(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	user := &models.User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &models.Game{UserID: user.ID, Title: "space-game", Visibility: models.GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+	upload := &models.Upload{GameID: game.ID, Filename: "windows.zip", Platforms: []string{"windows"}}
+	if err := db.CreateUpload(upload); err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+
+	// main holds 1.0.0 and is pushing 1.1.0; pr-123 holds a newer preview build
+	ids := map[string]int64{}
+	for _, version := range []string{"1.0.0", "pr-123", "1.1.0"} {
+		build := &models.Build{UploadID: upload.ID, UserVersion: version, State: "completed"}
+		if version == "1.1.0" {
+			build.State = "started"
+		}
+		if err := db.CreateBuild(build); err != nil {
+			t.Fatalf("failed to create build: %v", err)
+		}
+		ids[version] = build.ID
+	}
+	heads := map[string][]string{
+		"main":   {"1.0.0", "1.1.0"},
+		"pr-123": {"pr-123"},
+	}
+	for name, versions := range heads {
+		current := ids[versions[len(versions)-1]]
+		channel := &models.Channel{Name: name, UploadID: upload.ID, CurrentBuildID: &current}
+		if err := db.CreateChannel(channel); err != nil {
+			t.Fatalf("failed to create channel: %v", err)
+		}
+		var previous *int64
+		for _, version := range versions {
+			id := ids[version]
+			entry := &models.ChannelHistoryEntry{ChannelID: channel.ID, PreviousBuildID: previous, BuildID: &id, Reason: "push", Username: user.Username}
+			if err := db.CreateChannelHistoryEntry(entry); err != nil {
+				t.Fatalf("failed to create channel history entry: %v", err)
+			}
+			previous = &id
+		}
+	}
+
+	h := NewCoreHandlers(db, nil, "bucket")
+	r := mux.NewRouter()
+	r.HandleFunc("/games/{id}/uploads/best", h.GetBestUpload)
+
+	tests := []struct {
+		name           string
+		defaultChannel string
+		query          string
+		wantStatus     int
+		wantChannel    string
+		wantBuild      string
+	}{
+		{name: "newest head without a default", query: "os=windows", wantStatus: http.StatusOK, wantChannel: "pr-123", wantBuild: "pr-123"},
+		{name: "default channel during a push", defaultChannel: "main", query: "os=windows", wantStatus: http.StatusOK, wantChannel: "main", wantBuild: "1.0.0"},
+		{name: "default missing from the upload", defaultChannel: "stable", query: "os=windows", wantStatus: http.StatusOK, wantChannel: "pr-123", wantBuild: "pr-123"},
+		{name: "named channel", defaultChannel: "main", query: "os=windows&channel=pr-123", wantStatus: http.StatusOK, wantChannel: "pr-123", wantBuild: "pr-123"},
+		{name: "unknown channel", query: "os=windows&channel=beta", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game.DefaultChannel = tt.defaultChannel
+			if err := db.UpdateGame(game); err != nil {
+				t.Fatalf("failed to update game: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/games/%d/uploads/best?%s", game.ID, tt.query), nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Channel  struct{ Name string }
+				Build    struct{ ID int64 }
+				Download struct{ URL string }
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			if response.Channel.Name != tt.wantChannel {
+				t.Errorf("expected channel %s, got %s", tt.wantChannel, response.Channel.Name)
+			}
+			if response.Build.ID != ids[tt.wantBuild] {
+				t.Errorf("expected build %d (%s), got %d", ids[tt.wantBuild], tt.wantBuild, response.Build.ID)
+			}
+			if want := fmt.Sprintf("/uploads/%d/download?channel=%s", upload.ID, tt.wantChannel); response.Download.URL != want {
+				t.Errorf("expected download url %s, got %s", want, response.Download.URL)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// fileChange is one entry of a build diff
+type fileChange struct {
+	Path      string `json:"path"`
+	Type      string `json:"type"`
+	OldSize   int64  `json:"old_size"`
+	NewSize   int64  `json:"new_size"`
+	SizeDelta int64  `json:"size_delta"`
+}
+
+// diffManifests compares two build manifests. Files are considered modified
+// when their hashes differ, or their sizes when either side has no hashes.
+func diffManifests(from, to *buildManifest) (added, removed, modified []*fileChange) {
+	oldEntries := make(map[string]*manifestEntry)
+	for _, entry := range from.Entries {
+		oldEntries[entry.Path] = entry
+	}
+
+	newEntries := make(map[string]*manifestEntry)
+	for _, entry := range to.Entries {
+		newEntries[entry.Path] = entry
+
+		old, ok := oldEntries[entry.Path]
+		if !ok {
+			added = append(added, &fileChange{Path: entry.Path, Type: entry.Type, NewSize: entry.Size, SizeDelta: entry.Size})
+			continue
+		}
+
+		changed := old.Type != entry.Type || old.Size != entry.Size || old.Dest != entry.Dest
+		if !changed && old.Hash != "" && entry.Hash != "" {
+			changed = old.Hash != entry.Hash
+		}
+		if changed {
+			modified = append(modified, &fileChange{
+				Path:      entry.Path,
+				Type:      entry.Type,
+				OldSize:   old.Size,
+				NewSize:   entry.Size,
+				SizeDelta: entry.Size - old.Size,
+			})
+		}
+	}
+
+	for _, entry := range from.Entries {
+		if _, ok := newEntries[entry.Path]; !ok {
+			removed = append(removed, &fileChange{Path: entry.Path, Type: entry.Type, OldSize: entry.Size, SizeDelta: -entry.Size})
+		}
+	}
+
+	for _, list := range [][]*fileChange{added, removed, modified} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	}
+
+	return added, removed, modified
+}
+
+// upgradeSize returns how many bytes a player on build from downloads to get
+// build to. When to descends from from, that is the sum of the patches along
+// the parent chain; otherwise the player downloads the full build.
+func (h *WharfHandlers) upgradeSize(from, to *models.Build) (string, int64, error) {
+	patches, err := h.patchChain(from, to)
+	if err != nil {
+		return "", 0, err
+	}
+	if patches == nil {
+		size, err := h.fullDownloadSize(to)
+		return "full", size, err
+	}
+
+	var patchBytes int64
+	for _, patch := range patches {
+		patchBytes += patch.Size
+	}
+	return "patch", patchBytes, nil
+}
+
+// patchChain returns the patch files that take a player from build from to
+// build to, oldest first, or nil if to doesn't descend from from or a patch
+// along the way is missing
+func (h *WharfHandlers) patchChain(from, to *models.Build) ([]*models.BuildFile, error) {
+	patches := []*models.BuildFile{}
+	for build := to; build.ID != from.ID; {
+		if build.ParentBuildID == nil {
+			return nil, nil
+		}
+
+		buildFiles, err := h.db.GetBuildFilesByBuildID(build.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get build files: %w", err)
+		}
+		patchFile := findBuildFile(buildFiles, "patch")
+		if patchFile == nil {
+			return nil, nil
+		}
+		patches = append([]*models.BuildFile{patchFile}, patches...)
+
+		build, err = h.db.GetBuildByID(*build.ParentBuildID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent build: %w", err)
+		}
+	}
+	return patches, nil
+}
+
+// fullDownloadSize returns the size of downloading a build from scratch: its
+// archive if one was generated, its uncompressed content otherwise
+func (h *WharfHandlers) fullDownloadSize(build *models.Build) (int64, error) {
+	buildFiles, err := h.db.GetBuildFilesByBuildID(build.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get build files: %w", err)
+	}
+	if archiveFile := findBuildFile(buildFiles, "archive"); archiveFile != nil {
+		return archiveFile.Size, nil
+	}
+
+	manifest, err := h.loadManifest(build)
+	if err != nil {
+		return 0, err
+	}
+	return manifest.Size, nil
+}
+
+// GET /builds/{id}/diff?from={buildId} - Compare a build with an earlier build of the same upload
+func (h *WharfHandlers) GetBuildDiff(w http.ResponseWriter, r *http.Request) {
+	buildID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	fromStr := r.URL.Query().Get("from")
+	if fromStr == "" {
+		writeErrors(w, http.StatusBadRequest, "missing from build id")
+		return
+	}
+	fromID, err := strconv.ParseInt(fromStr, 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid from build id")
+		return
+	}
+
+	to, err := viewableBuild(h.db, r, buildID)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	from, err := h.db.GetBuildByID(fromID)
+	if err != nil {
+		writeErrors(w, http.StatusNotFound, "from build not found")
+		return
+	}
+
+	if from.UploadID != to.UploadID {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("builds %d and %d belong to different uploads", from.ID, to.ID))
+		return
+	}
+
+	manifests := make([]*buildManifest, 2)
+	for i, build := range []*models.Build{from, to} {
+		manifests[i], err = h.loadManifest(build)
+		if err != nil {
+			if errors.Is(err, errNoManifestSource) {
+				writeErrors(w, http.StatusNotFound, fmt.Sprintf("build %d: %s", build.ID, err.Error()))
+				return
+			}
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	added, removed, modified := diffManifests(manifests[0], manifests[1])
+
+	method, upgradeBytes, err := h.upgradeSize(from, to)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, list := range []*[]*fileChange{&added, &removed, &modified} {
+		if *list == nil {
+			*list = []*fileChange{}
+		}
+	}
+
+	response := map[string]interface{}{
+		"diff": map[string]interface{}{
+			"from_build_id": from.ID,
+			"to_build_id":   to.ID,
+			"added":         added,
+			"removed":       removed,
+			"modified":      modified,
+			"size_delta":    manifests[1].Size - manifests[0].Size,
+			"upgrade": map[string]interface{}{
+				"method": method,
+				"bytes":  upgradeBytes,
+			},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
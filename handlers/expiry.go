@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// parseTTL parses a channel time-to-live such as "72h"
+func parseTTL(value string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl '%s', expected a positive duration like 72h", value)
+	}
+	return ttl, nil
+}
+
+// pushExpiry returns when a channel expires after a push: requestedTTL if the
+// push set one, otherwise the TTL of the game's first rule matching the
+// channel name. It returns nil if neither applies.
+func (h *WharfHandlers) pushExpiry(gameID int64, channelName, requestedTTL string) (*time.Time, error) {
+	var ttl time.Duration
+	if requestedTTL != "" {
+		var err error
+		ttl, err = parseTTL(requestedTTL)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		rules, err := h.db.GetChannelTTLRules(gameID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get channel ttl rules: %w", err)
+		}
+		for _, rule := range rules {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				continue
+			}
+			if pattern.MatchString(channelName) {
+				ttl = time.Duration(rule.TTLSeconds) * time.Second
+				break
+			}
+		}
+	}
+
+	if ttl == 0 {
+		return nil, nil
+	}
+	expiresAt := time.Now().UTC().Add(ttl)
+	return &expiresAt, nil
+}
+
+// channelTTLRuleResponse formats a TTL rule for API responses
+func channelTTLRuleResponse(rule *models.ChannelTTLRule) map[string]interface{} {
+	return map[string]interface{}{
+		"pattern":     rule.Pattern,
+		"ttl":         (time.Duration(rule.TTLSeconds) * time.Second).String(),
+		"ttl_seconds": rule.TTLSeconds,
+	}
+}
+
+// GET /wharf/channel-ttl-rules - List the rules that give matching channels an expiry
+func (h *WharfHandlers) GetChannelTTLRules(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	rules, err := h.db.GetChannelTTLRules(bt.Game.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ruleData := []map[string]interface{}{}
+	for _, rule := range rules {
+		ruleData = append(ruleData, channelTTLRuleResponse(rule))
+	}
+
+	response := map[string]interface{}{
+		"rules": ruleData,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /wharf/channel-ttl-rules - Replace the channel TTL rules of a game
+func (h *WharfHandlers) SetChannelTTLRules(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Rules []struct {
+			Pattern string `json:"pattern"`
+			TTL     string `json:"ttl"`
+		} `json:"rules"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	var rules []*models.ChannelTTLRule
+	for _, reqRule := range req.Rules {
+		if _, err := regexp.Compile(reqRule.Pattern); err != nil || reqRule.Pattern == "" {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid pattern '%s'", reqRule.Pattern))
+			return
+		}
+		ttl, err := parseTTL(reqRule.TTL)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		rules = append(rules, &models.ChannelTTLRule{Pattern: reqRule.Pattern, TTLSeconds: int64(ttl / time.Second)})
+	}
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	if err := h.db.SetChannelTTLRules(bt.Game.ID, rules); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s set %d channel ttl rules for game %d\n", user.Username, len(rules), bt.Game.ID)
+
+	ruleData := []map[string]interface{}{}
+	for _, rule := range rules {
+		ruleData = append(ruleData, channelTTLRuleResponse(rule))
+	}
+
+	response := map[string]interface{}{
+		"rules": ruleData,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /wharf/channels/{channel}/expiry - Set when a channel expires, from a ttl or an expires_at time
+func (h *WharfHandlers) SetChannelExpiry(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TTL       string `json:"ttl"`
+		ExpiresAt string `json:"expires_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	var expiresAt time.Time
+	switch {
+	case req.TTL != "" && req.ExpiresAt != "":
+		writeErrors(w, http.StatusBadRequest, "set either ttl or expires_at, not both")
+		return
+	case req.TTL != "":
+		ttl, err := parseTTL(req.TTL)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		expiresAt = time.Now().Add(ttl)
+	case req.ExpiresAt != "":
+		var err error
+		expiresAt, err = time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil {
+			writeErrors(w, http.StatusBadRequest, "expires_at must be an RFC 3339 time, like 2025-06-01T17:00:00Z")
+			return
+		}
+	default:
+		writeErrors(w, http.StatusBadRequest, "missing ttl or expires_at")
+		return
+	}
+
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	expiresAt = expiresAt.UTC()
+	channel.ExpiresAt = &expiresAt
+	if err := h.db.UpdateChannel(channel); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s set channel %s to expire at %s\n", user.Username, channel.Name, expiresAt.Format(time.RFC3339))
+
+	response := map[string]interface{}{
+		"channel":    channel.Name,
+		"expires_at": channel.ExpiresAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/channels/{channel}/expiry - Keep a channel forever
+func (h *WharfHandlers) DeleteChannelExpiry(w http.ResponseWriter, r *http.Request) {
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	channel.ExpiresAt = nil
+	if err := h.db.UpdateChannel(channel); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s removed the expiry of channel %s\n", user.Username, channel.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// RunChannelCleanup deletes expired channels and the builds only they used,
+// until ctx is cancelled
+func (h *WharfHandlers) RunChannelCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.deleteExpiredChannels(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deleteExpiredChannels deletes every channel whose expiry has passed
+func (h *WharfHandlers) deleteExpiredChannels(now time.Time) {
+	channels, err := h.db.GetExpiringChannels()
+	if err != nil {
+		fmt.Printf("Warning: could not load expiring channels: %v\n", err)
+		return
+	}
+
+	for _, channel := range channels {
+		if channel.ExpiresAt.After(now) {
+			continue
+		}
+		if err := h.deleteChannel(channel); err != nil {
+			fmt.Printf("Warning: could not delete expired channel %s (ID %d): %v\n", channel.Name, channel.ID, err)
+			continue
+		}
+		fmt.Printf("Deleted expired channel %s (ID %d)\n", channel.Name, channel.ID)
+	}
+}
+
+// deleteChannel deletes the builds only a channel ever held, then the channel,
+// and its upload once that has no channels or builds left. Builds other
+// channels held, labeled builds and the ancestors of any kept build stay, since
+// rollbacks, promotions, changelogs and unpacking may still need them. The
+// channel goes last so a failed cleanup is retried with its history intact.
+func (h *WharfHandlers) deleteChannel(channel *models.Channel) error {
+	upload, err := h.db.GetUploadByID(channel.UploadID)
+	if err != nil {
+		return fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	held, err := channelBuildIDs(h.db, channel)
+	if err != nil {
+		return fmt.Errorf("failed to get channel history: %w", err)
+	}
+
+	keep, err := h.retainedBuilds(upload.GameID, channel.ID)
+	if err != nil {
+		return err
+	}
+
+	// Children first, so no remaining build points at a deleted parent
+	sort.Slice(held, func(i, j int) bool { return held[i] > held[j] })
+	for _, buildID := range held {
+		if keep[buildID] {
+			continue
+		}
+		if _, err := h.db.GetBuildByID(buildID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				// Deleted by an earlier attempt
+				continue
+			}
+			return fmt.Errorf("failed to get build %d: %w", buildID, err)
+		}
+		if err := h.deleteBuild(buildID); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted build %d of expired channel %s\n", buildID, channel.Name)
+	}
+
+	if err := h.db.DeleteChannel(channel.ID); err != nil {
+		return fmt.Errorf("failed to delete channel: %w", err)
+	}
+
+	channels, err := h.db.GetChannelsByUploadID(upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+	builds, err := h.db.GetBuildsByUploadID(upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get builds: %w", err)
+	}
+	if len(channels) == 0 && len(builds) == 0 {
+		if err := h.db.DeleteUpload(upload.ID); err != nil {
+			return fmt.Errorf("failed to delete upload %d: %w", upload.ID, err)
+		}
+		fmt.Printf("Deleted empty upload %d\n", upload.ID)
+	}
+
+	return nil
+}
+
+// retainedBuilds returns the builds of a game cleanup must keep: the builds
+// in use (see servedBuilds), every build a channel held, labeled builds, and
+// their ancestors. The channel being deleted, exceptChannelID, doesn't count.
+func (h *WharfHandlers) retainedBuilds(gameID, exceptChannelID int64) (map[int64]bool, error) {
+	roots, err := h.servedBuilds(gameID, exceptChannelID)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := h.db.GetUploadsByGameID(gameID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploads: %w", err)
+	}
+	for _, upload := range uploads {
+		channels, err := h.db.GetChannelsByUploadID(upload.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get channels: %w", err)
+		}
+		for _, channel := range channels {
+			if channel.ID == exceptChannelID {
+				continue
+			}
+			held, err := channelBuildIDs(h.db, channel)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get history of channel %s: %w", channel.Name, err)
+			}
+			roots = append(roots, held...)
+		}
+
+		labels, err := h.db.GetBuildLabelsByUploadID(upload.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get build labels: %w", err)
+		}
+		for buildID, buildLabels := range labels {
+			if len(buildLabels) > 0 {
+				roots = append(roots, buildID)
+			}
+		}
+	}
+
+	return h.withAncestors(roots), nil
+}
+
+// servedBuilds returns the builds of a game that channels other than
+// exceptChannelID serve or are about to: heads, rollout candidates and pending
+// scheduled releases
+func (h *WharfHandlers) servedBuilds(gameID, exceptChannelID int64) ([]int64, error) {
+	var builds []int64
+
+	uploads, err := h.db.GetUploadsByGameID(gameID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploads: %w", err)
+	}
+	gameChannels := make(map[int64]bool)
+	for _, upload := range uploads {
+		channels, err := h.db.GetChannelsByUploadID(upload.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get channels: %w", err)
+		}
+		for _, channel := range channels {
+			if channel.ID == exceptChannelID {
+				continue
+			}
+			gameChannels[channel.ID] = true
+			if channel.CurrentBuildID != nil {
+				builds = append(builds, *channel.CurrentBuildID)
+			}
+			if channel.CandidateBuildID != nil {
+				builds = append(builds, *channel.CandidateBuildID)
+			}
+		}
+	}
+
+	releases, err := h.db.GetPendingScheduledReleases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled releases: %w", err)
+	}
+	for _, release := range releases {
+		if gameChannels[release.ChannelID] {
+			builds = append(builds, release.BuildID)
+		}
+	}
+
+	return builds, nil
+}
+
+// withAncestors returns the given builds together with their parents, which
+// patches and unpacking build upon
+func (h *WharfHandlers) withAncestors(queue []int64) map[int64]bool {
+	keep := make(map[int64]bool)
+	for len(queue) > 0 {
+		buildID := queue[0]
+		queue = queue[1:]
+		if keep[buildID] {
+			continue
+		}
+		keep[buildID] = true
+
+		build, err := h.db.GetBuildByID(buildID)
+		if err != nil {
+			continue
+		}
+		if build.ParentBuildID != nil {
+			queue = append(queue, *build.ParentBuildID)
+		}
+	}
+	return keep
+}
+
+// deleteBuild deletes a build's objects from storage, then the build itself
+func (h *WharfHandlers) deleteBuild(buildID int64) error {
+	if err := h.removeBuildObjects(buildID); err != nil {
+		return err
+	}
+
+	if err := h.db.DeleteBuild(buildID); err != nil {
+		return fmt.Errorf("failed to delete build %d: %w", buildID, err)
+	}
+
+	h.unpackStateMu.Lock()
+	delete(h.unpackFailures, buildID)
+	h.unpackStateMu.Unlock()
+	return nil
+}
+
+// removeBuildObjects removes everything stored under a build's prefix
+func (h *WharfHandlers) removeBuildObjects(buildID int64) error {
+	ctx := context.Background()
+	prefix := fmt.Sprintf("builds/%d/", buildID)
+	for object := range h.minioClient.ListObjects(ctx, h.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list storage of build %d: %w", buildID, object.Err)
+		}
+		if err := h.minioClient.RemoveObject(ctx, h.bucketName, object.Key, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to remove %s from storage: %w", object.Key, err)
+		}
+	}
+	return nil
+}
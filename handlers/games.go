@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// gameResponse formats a game for API responses, like GET /games/{id}
+func gameResponse(owner *models.User, game *models.Game) map[string]interface{} {
+	data := map[string]interface{}{
+		"id":              game.ID,
+		"title":           game.Title,
+		"short_text":      game.ShortText,
+		"type":            game.Type,
+		"classification":  game.Classification,
+		"url":             game.URL,
+		"visibility":      game.Visibility,
+		"default_channel": game.DefaultChannel,
+		"user": map[string]interface{}{
+			"id":           owner.ID,
+			"username":     owner.Username,
+			"display_name": owner.DisplayName,
+		},
+	}
+	if game.Type == models.GameTypeHTML {
+		data["web_channel"] = game.WebChannel
+		data["play_url"] = fmt.Sprintf("/play/%d/", game.ID)
+	}
+	return data
+}
+
+// validateGame checks the editable fields of a game
+func validateGame(game *models.Game) error {
+	if game.Title == "" {
+		return fmt.Errorf("missing title")
+	}
+	if len(game.Title) > 255 {
+		return fmt.Errorf("title is longer than 255 characters")
+	}
+	if len(game.DefaultChannel) > 255 {
+		return fmt.Errorf("default_channel is longer than 255 characters")
+	}
+	// The title is the game part of username/gamename push targets
+	if strings.Contains(game.Title, "/") {
+		return fmt.Errorf("title may not contain '/'")
+	}
+
+	if game.Type != models.GameTypeDefault && game.Type != models.GameTypeHTML {
+		return fmt.Errorf("invalid type '%s', expected '%s' or '%s'", game.Type, models.GameTypeDefault, models.GameTypeHTML)
+	}
+
+	if !models.Contains(models.GameClassifications, game.Classification) {
+		return fmt.Errorf("invalid classification '%s', expected one of %s", game.Classification, strings.Join(models.GameClassifications, ", "))
+	}
+
+	if !models.Contains(models.GameVisibilities, game.Visibility) {
+		return fmt.Errorf("invalid visibility '%s', expected one of %s", game.Visibility, strings.Join(models.GameVisibilities, ", "))
+	}
+
+	if game.URL != "" {
+		u, err := url.Parse(game.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url '%s', expected an http or https URL", game.URL)
+		}
+	}
+
+	return nil
+}
+
+// POST /wharf/games - Create a game in a namespace, e.g. {"target": "alice/my-game"}
+func (h *WharfHandlers) CreateGame(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Target         string `json:"target"`
+		ShortText      string `json:"short_text"`
+		Type           string `json:"type"`
+		Classification string `json:"classification"`
+		URL            string `json:"url"`
+		Visibility     string `json:"visibility"`
+		DefaultChannel string `json:"default_channel"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	bt, err := h.resolveTarget(user, req.Target, "", true)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	if bt.Game != nil {
+		writeErrors(w, http.StatusConflict, fmt.Sprintf("game '%s' already exists", req.Target))
+		return
+	}
+
+	// Same defaults as games created by a first push
+	game := &models.Game{
+		UserID:         bt.Owner.ID,
+		Title:          bt.GameName,
+		ShortText:      req.ShortText,
+		Type:           models.GameTypeDefault,
+		Classification: "game",
+		URL:            req.URL,
+		WebChannel:     "web",
+		DefaultChannel: strings.TrimSpace(req.DefaultChannel),
+		Visibility:     models.GameVisibilityPublic,
+	}
+	if req.Type != "" {
+		game.Type = req.Type
+	}
+	if req.Classification != "" {
+		game.Classification = req.Classification
+	}
+	if req.Visibility != "" {
+		game.Visibility = req.Visibility
+	}
+
+	if err := validateGame(game); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.db.CreateGame(game); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s created game %d '%s' for %s\n", user.Username, game.ID, game.Title, bt.Owner.Username)
+
+	response := map[string]interface{}{
+		"game": gameResponse(bt.Owner, game),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PATCH /wharf/games/{id} - Edit a game. Fields left out keep their value.
+// Renaming a game changes the target butler pushes to.
+func (h *WharfHandlers) UpdateGame(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Title          *string `json:"title"`
+		ShortText      *string `json:"short_text"`
+		Type           *string `json:"type"`
+		Classification *string `json:"classification"`
+		URL            *string `json:"url"`
+		Visibility     *string `json:"visibility"`
+		DefaultChannel *string `json:"default_channel"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	bt, err := h.resolveTarget(user, "", mux.Vars(r)["id"], false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+	previousTitle := game.Title
+
+	if req.Title != nil {
+		game.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.ShortText != nil {
+		game.ShortText = *req.ShortText
+	}
+	if req.Type != nil {
+		game.Type = *req.Type
+	}
+	if req.Classification != nil {
+		game.Classification = *req.Classification
+	}
+	if req.URL != nil {
+		game.URL = *req.URL
+	}
+	if req.Visibility != nil {
+		game.Visibility = *req.Visibility
+	}
+	if req.DefaultChannel != nil {
+		game.DefaultChannel = strings.TrimSpace(*req.DefaultChannel)
+	}
+
+	if err := validateGame(game); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if game.Title != previousTitle {
+		_, err := h.db.GetGameByUserAndTitle(game.UserID, game.Title)
+		if err == nil {
+			writeErrors(w, http.StatusConflict, fmt.Sprintf("game '%s/%s' already exists", bt.Owner.Username, game.Title))
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := h.db.UpdateGame(game); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s updated game %d '%s'\n", user.Username, game.ID, game.Title)
+
+	response := map[string]interface{}{
+		"game": gameResponse(bt.Owner, game),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/games/{id} - Delete a game with its uploads, channels, builds and stored files
+func (h *WharfHandlers) DeleteGame(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	bt, err := h.resolveTarget(user, "", mux.Vars(r)["id"], false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	if err := h.deleteGame(game); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s deleted game %d '%s' of %s\n", user.Username, game.ID, game.Title, bt.Owner.Username)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// deleteGame deletes everything of a game. The stored objects of its builds go
+// first, then all rows in one transaction, so a failure leaves the game intact
+// for the delete to be retried.
+func (h *WharfHandlers) deleteGame(game *models.Game) error {
+	uploads, err := h.db.GetUploadsByGameID(game.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get uploads: %w", err)
+	}
+
+	var buildIDs []int64
+	for _, upload := range uploads {
+		builds, err := h.db.GetBuildsByUploadID(upload.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get builds: %w", err)
+		}
+		for _, build := range builds {
+			buildIDs = append(buildIDs, build.ID)
+		}
+	}
+
+	for _, buildID := range buildIDs {
+		if err := h.removeBuildObjects(buildID); err != nil {
+			return err
+		}
+	}
+
+	if err := h.db.DeleteGame(game.ID); err != nil {
+		return fmt.Errorf("failed to delete game %d: %w", game.ID, err)
+	}
+
+	h.unpackStateMu.Lock()
+	for _, buildID := range buildIDs {
+		delete(h.unpackFailures, buildID)
+	}
+	h.unpackStateMu.Unlock()
+	return nil
+}
+
+// deleteUploadContents deletes all channels and builds of an upload
+func (h *WharfHandlers) deleteUploadContents(upload *models.Upload) error {
+	channels, err := h.db.GetChannelsByUploadID(upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+	for _, channel := range channels {
+		if err := h.db.DeleteChannel(channel.ID); err != nil {
+			return fmt.Errorf("failed to delete channel %s: %w", channel.Name, err)
+		}
+	}
+
+	builds, err := h.db.GetBuildsByUploadID(upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get builds: %w", err)
+	}
+
+	// Children first, so no remaining build points at a deleted parent
+	sort.Slice(builds, func(i, j int) bool { return builds[i].ID > builds[j].ID })
+	for _, build := range builds {
+		if err := h.deleteBuild(build.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// recordHeadChange adds a change of the channel's head to its history. The
+// change itself already happened, so failing to record it is only logged.
+func (h *WharfHandlers) recordHeadChange(channel *models.Channel, previousBuildID *int64, reason, username string) {
+	if previousBuildID != nil && channel.CurrentBuildID != nil && *previousBuildID == *channel.CurrentBuildID {
+		return
+	}
+
+	entry := &models.ChannelHistoryEntry{
+		ChannelID:       channel.ID,
+		PreviousBuildID: previousBuildID,
+		BuildID:         channel.CurrentBuildID,
+		Reason:          reason,
+		Username:        username,
+	}
+	if err := h.db.CreateChannelHistoryEntry(entry); err != nil {
+		fmt.Printf("Warning: could not record head change of channel %s: %v\n", channel.Name, err)
+	}
+}
+
+// channelBuildIDs returns the ids of the builds a channel has held as its
+// head, from its history and its current head, in ascending order
+func channelBuildIDs(db models.Database, channel *models.Channel) ([]int64, error) {
+	entries, err := db.GetChannelHistory(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int64]bool{}
+	if channel.CurrentBuildID != nil {
+		seen[*channel.CurrentBuildID] = true
+	}
+	for _, entry := range entries {
+		if entry.BuildID != nil {
+			seen[*entry.BuildID] = true
+		}
+		if entry.PreviousBuildID != nil {
+			seen[*entry.PreviousBuildID] = true
+		}
+	}
+
+	ids := make([]int64, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// lastCompletedHead returns the newest build the channel has held as its head
+// that completed, or nil if none did. Heads move at the start of a push, so the
+// current one may still be uploading or have failed.
+func lastCompletedHead(db models.Database, channel *models.Channel) (*models.Build, error) {
+	entries, err := db.GetChannelHistory(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// History is newest first, and each entry's new head is newer than its previous one
+	var candidates []*int64
+	candidates = append(candidates, channel.CurrentBuildID)
+	for _, entry := range entries {
+		candidates = append(candidates, entry.BuildID, entry.PreviousBuildID)
+	}
+
+	for _, buildID := range candidates {
+		if buildID == nil {
+			continue
+		}
+		build, err := db.GetBuildByID(*buildID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Expired builds stay in the channel's history
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if build.State == "completed" {
+			return build, nil
+		}
+	}
+	return nil, nil
+}
+
+// GET /wharf/channels/{channel}/history - List the head changes of a channel, newest first
+func (h *WharfHandlers) GetChannelHistory(w http.ResponseWriter, r *http.Request) {
+	_, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.GetChannelHistory(channel.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []*models.ChannelHistoryEntry{}
+	}
+
+	response := map[string]interface{}{
+		"channel": channel.Name,
+		"history": entries,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+var labelRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// validateLabels checks build labels such as qa-approved or steam-submitted
+func validateLabels(labels []string) error {
+	for _, label := range labels {
+		if !labelRegex.MatchString(label) {
+			return fmt.Errorf("invalid label '%s', expected up to 64 letters, digits, '_', '.' or '-'", label)
+		}
+	}
+	return nil
+}
+
+// POST /wharf/builds/{id}/labels - Add labels to a build
+func (h *WharfHandlers) AddBuildLabels(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Labels []string `json:"labels"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if len(req.Labels) == 0 {
+		writeErrors(w, http.StatusBadRequest, "missing labels")
+		return
+	}
+	if err := validateLabels(req.Labels); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	build, _, err := h.resolveBuild(user, mux.Vars(r)["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	if err := h.db.AddBuildLabels(build.ID, req.Labels); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	labels, err := h.db.GetBuildLabels(build.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s labeled build %d with %v\n", user.Username, build.ID, req.Labels)
+
+	response := map[string]interface{}{
+		"build": map[string]interface{}{
+			"id":     build.ID,
+			"labels": labels,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/builds/{id}/labels/{label} - Remove a label from a build
+func (h *WharfHandlers) RemoveBuildLabel(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	user := auth.MustGetUser(r.Context())
+
+	build, _, err := h.resolveBuild(user, vars["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	removed, err := h.db.RemoveBuildLabel(build.ID, vars["label"])
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !removed {
+		writeErrors(w, http.StatusNotFound, fmt.Sprintf("build %d has no label '%s'", build.ID, vars["label"]))
+		return
+	}
+
+	labels, err := h.db.GetBuildLabels(build.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s removed label %s from build %d\n", user.Username, vars["label"], build.ID)
+
+	response := map[string]interface{}{
+		"build": map[string]interface{}{
+			"id":     build.ID,
+			"labels": labels,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"archive/zip"
+	"butler-server/models"
+	"butler-server/wharf"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// manifestEntry is one file, directory or symlink of a build
+type manifestEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"` // "file", "dir" or "symlink"
+	Size int64  `json:"size,omitempty"`
+	Mode string `json:"mode"`
+	Hash string `json:"hash,omitempty"`
+	Dest string `json:"dest,omitempty"`
+
+	perm os.FileMode // permission bits, for archives
+}
+
+// buildManifest is the content tree of a build
+type buildManifest struct {
+	BuildID int64            `json:"build_id"`
+	Source  string           `json:"source"` // build file type the manifest was read from
+	Size    int64            `json:"size"`
+	Entries []*manifestEntry `json:"entries"`
+}
+
+// errNoManifestSource is returned when a build has no signature, patch or archive to read the manifest from
+var errNoManifestSource = errors.New("build has no uploaded signature, patch or archive")
+
+// openBuildFile opens a build file's object in storage
+func (h *WharfHandlers) openBuildFile(buildFile *models.BuildFile) (io.ReadCloser, error) {
+	object, err := h.minioClient.GetObject(context.Background(), h.bucketName, buildFile.StoragePath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s from storage: %w", buildFile.StoragePath, err)
+	}
+	return object, nil
+}
+
+// findBuildFile returns the uploaded build file of the given type, or nil
+func findBuildFile(buildFiles []*models.BuildFile, fileType string) *models.BuildFile {
+	for _, buildFile := range buildFiles {
+		if buildFile.Type == fileType && buildFile.State == "uploaded" {
+			return buildFile
+		}
+	}
+	return nil
+}
+
+// loadManifest reads the content tree of a build from its wharf signature. Builds
+// without a signature fall back to the new container stored in their patch,
+// then to the entries of their archive; neither has per-file hashes.
+func (h *WharfHandlers) loadManifest(build *models.Build) (*buildManifest, error) {
+	buildFiles, err := h.db.GetBuildFilesByBuildID(build.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build files: %w", err)
+	}
+
+	manifest := &buildManifest{BuildID: build.ID, Entries: []*manifestEntry{}}
+
+	var container *wharf.Container
+	var signature *wharf.Signature
+
+	if sigFile := findBuildFile(buildFiles, "signature"); sigFile != nil {
+		object, err := h.openBuildFile(sigFile)
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+
+		signature, err = wharf.ReadSignature(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signature: %w", err)
+		}
+		container = signature.Container
+		manifest.Source = "signature"
+	} else if patchFile := findBuildFile(buildFiles, "patch"); patchFile != nil {
+		object, err := h.openBuildFile(patchFile)
+		if err != nil {
+			return nil, err
+		}
+		defer object.Close()
+
+		patch, err := wharf.OpenPatch(object)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read patch: %w", err)
+		}
+		patch.Close()
+		container = patch.Source
+		manifest.Source = "patch"
+	} else if archiveFile := findBuildFile(buildFiles, "archive"); archiveFile != nil {
+		container, err = h.archiveContainer(archiveFile)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Source = "archive"
+	} else {
+		return nil, errNoManifestSource
+	}
+
+	manifest.Size = container.Size
+
+	for _, dir := range container.Dirs {
+		manifest.Entries = append(manifest.Entries, &manifestEntry{
+			Path: dir.Path,
+			Type: "dir",
+			Mode: formatMode(dir.Mode),
+			perm: os.FileMode(dir.Mode & 0777),
+		})
+	}
+
+	for i, file := range container.Files {
+		entry := &manifestEntry{
+			Path: file.Path,
+			Type: "file",
+			Size: file.Size,
+			Mode: formatMode(file.Mode),
+			perm: os.FileMode(file.Mode & 0777),
+		}
+		if signature != nil {
+			entry.Hash = signature.FileHash(i)
+		}
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	for _, symlink := range container.Symlinks {
+		manifest.Entries = append(manifest.Entries, &manifestEntry{
+			Path: symlink.Path,
+			Type: "symlink",
+			Mode: formatMode(symlink.Mode),
+			Dest: symlink.Dest,
+			perm: os.FileMode(symlink.Mode & 0777),
+		})
+	}
+
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Path < manifest.Entries[j].Path
+	})
+
+	return manifest, nil
+}
+
+// archiveContainer reads the files, directories and symlinks of a build's zip archive
+func (h *WharfHandlers) archiveContainer(archiveFile *models.BuildFile) (*wharf.Container, error) {
+	object, err := h.minioClient.GetObject(context.Background(), h.bucketName, archiveFile.StoragePath, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s from storage: %w", archiveFile.StoragePath, err)
+	}
+	defer object.Close()
+
+	stat, err := object.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", archiveFile.StoragePath, err)
+	}
+	archive, err := zip.NewReader(object, stat.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	container := &wharf.Container{}
+	for _, entry := range archive.File {
+		mode := entry.Mode()
+		entryPath := strings.TrimSuffix(entry.Name, "/")
+		switch {
+		case mode.IsDir():
+			container.Dirs = append(container.Dirs, &wharf.Dir{Path: entryPath, Mode: uint32(mode.Perm())})
+		case mode&os.ModeSymlink != 0:
+			// The link target is the content of the entry
+			r, err := entry.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read symlink %s: %w", entry.Name, err)
+			}
+			dest, err := io.ReadAll(io.LimitReader(r, 4096))
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read symlink %s: %w", entry.Name, err)
+			}
+			container.Symlinks = append(container.Symlinks, &wharf.Symlink{Path: entryPath, Mode: uint32(mode.Perm()), Dest: string(dest)})
+		default:
+			size := int64(entry.UncompressedSize64)
+			container.Files = append(container.Files, &wharf.File{Path: entryPath, Mode: uint32(mode.Perm()), Size: size})
+			container.Size += size
+		}
+	}
+	return container, nil
+}
+
+// formatMode formats the permission bits of a container entry the way ls does
+func formatMode(mode uint32) string {
+	return os.FileMode(mode & 0777).String()
+}
+
+// matchesPrefix reports whether a manifest path is inside the given path prefix
+func matchesPrefix(path, prefix string) bool {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// GET /builds/{id}/manifest - List the files, directories and symlinks inside a build
+func (h *WharfHandlers) GetBuildManifest(w http.ResponseWriter, r *http.Request) {
+	buildIDStr := mux.Vars(r)["id"]
+	buildID, err := strconv.ParseInt(buildIDStr, 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "text" {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid format '%s', expected json or text", format))
+		return
+	}
+
+	build, err := viewableBuild(h.db, r, buildID)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	manifest, err := h.loadManifest(build)
+	if err != nil {
+		if errors.Is(err, errNoManifestSource) {
+			writeErrors(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if prefix := r.URL.Query().Get("prefix"); prefix != "" {
+		var filtered []*manifestEntry
+		for _, entry := range manifest.Entries {
+			if matchesPrefix(entry.Path, prefix) {
+				filtered = append(filtered, entry)
+			}
+		}
+		manifest.Entries = filtered
+		if manifest.Entries == nil {
+			manifest.Entries = []*manifestEntry{}
+		}
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, entry := range manifest.Entries {
+			line := fmt.Sprintf("%s %-7s %12d %s", entry.Mode, entry.Type, entry.Size, entry.Path)
+			if entry.Hash != "" {
+				line += "  " + entry.Hash
+			}
+			if entry.Dest != "" {
+				line += " -> " + entry.Dest
+			}
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"manifest": manifest,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits on the free-form metadata CI attaches to a build
+const (
+	maxBuildMetadataKeys  = 50
+	maxBuildMetadataValue = 2048
+)
+
+var metadataKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// validateBuildMetadata checks the keys and values being set on a build
+func validateBuildMetadata(metadata map[string]string) error {
+	for key, value := range metadata {
+		if !metadataKeyRegex.MatchString(key) {
+			return fmt.Errorf("invalid metadata key '%s', expected up to 64 letters, digits, '_', '.' or '-'", key)
+		}
+		if len(value) > maxBuildMetadataValue {
+			return fmt.Errorf("metadata value of '%s' is longer than %d bytes", key, maxBuildMetadataValue)
+		}
+	}
+	if len(metadata) > maxBuildMetadataKeys {
+		return fmt.Errorf("a build can have at most %d metadata keys", maxBuildMetadataKeys)
+	}
+	return nil
+}
+
+// formMetadata collects the metadata[key]=value fields of a form
+func formMetadata(form url.Values) map[string]string {
+	metadata := map[string]string{}
+	for field, values := range form {
+		if strings.HasPrefix(field, "metadata[") && strings.HasSuffix(field, "]") && len(values) > 0 {
+			metadata[field[len("metadata["):len(field)-1]] = values[0]
+		}
+	}
+	return metadata
+}
+
+// PUT /wharf/builds/{id}/metadata - Add to or change the metadata of a build.
+// Keys set to null are removed, keys left out are kept.
+func (h *WharfHandlers) UpdateBuildMetadata(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Metadata map[string]*string `json:"metadata"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if len(req.Metadata) == 0 {
+		writeErrors(w, http.StatusBadRequest, "missing metadata")
+		return
+	}
+
+	build, _, err := h.resolveBuild(user, mux.Vars(r)["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	metadata, err := h.db.GetBuildMetadata(build.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	set := map[string]string{}
+	var remove []string
+	for key, value := range req.Metadata {
+		if value == nil {
+			remove = append(remove, key)
+			delete(metadata, key)
+		} else {
+			set[key] = *value
+			metadata[key] = *value
+		}
+	}
+
+	if err := validateBuildMetadata(set); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(metadata) > maxBuildMetadataKeys {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("a build can have at most %d metadata keys", maxBuildMetadataKeys))
+		return
+	}
+
+	if err := h.db.UpdateBuildMetadata(build.ID, set, remove); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s updated metadata of build %d: %d set, %d removed\n", user.Username, build.ID, len(set), len(remove))
+
+	response := map[string]interface{}{
+		"build": map[string]interface{}{
+			"id":       build.ID,
+			"metadata": metadata,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /wharf/builds/search - Find a game's builds by metadata, e.g. ?key=git_sha&value=abc123.
+// Values match by prefix, so short commit hashes work; without key any key matches.
+// Results are paged like other lists, newest first by default.
+func (h *WharfHandlers) SearchBuilds(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+	query := r.URL.Query()
+
+	key, value := query.Get("key"), query.Get("value")
+	if value == "" {
+		writeErrors(w, http.StatusBadRequest, "missing value")
+		return
+	}
+
+	page, err := parseListPage(r, []string{"id", "created_at"}, "-id", defaultPageLimit)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	bt, err := h.resolveTarget(user, query.Get("target"), query.Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	builds, err := h.db.FindBuildsByMetadata(bt.Game.ID, key, value, page.fetchOptions())
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	n, more := page.trim(len(builds))
+	builds = builds[:n]
+
+	var next string
+	if more {
+		last := builds[n-1]
+		var cursorValue string
+		if page.options.Sort == "created_at" {
+			cursorValue = cursorTime(last.CreatedAt)
+		}
+		next = page.cursorAfter(cursorValue, last.ID)
+	}
+
+	// Metadata is loaded per upload rather than per build
+	metadata := map[int64]map[int64]map[string]string{}
+	buildsResponse := []map[string]interface{}{}
+	for _, build := range builds {
+		uploadMetadata, ok := metadata[build.UploadID]
+		if !ok {
+			uploadMetadata, err = h.db.GetBuildMetadataByUploadID(build.UploadID)
+			if err != nil {
+				writeErrors(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			metadata[build.UploadID] = uploadMetadata
+		}
+
+		buildData := map[string]interface{}{
+			"id":           build.ID,
+			"upload_id":    build.UploadID,
+			"user_version": build.UserVersion,
+			"state":        build.State,
+			"created_at":   build.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			"metadata":     uploadMetadata[build.ID],
+		}
+		if build.ParentBuildID != nil {
+			buildData["parent_build_id"] = *build.ParentBuildID
+		}
+
+		buildsResponse = append(buildsResponse, buildData)
+	}
+
+	response := map[string]interface{}{
+		"builds":     buildsResponse,
+		"pagination": page.response(next, map[string]string{"key": key, "value": value}),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// RecoveryMiddleware turns a panic in a handler into a JSON 500 response
+// instead of a dropped connection, logging the stack trace
+func RecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// Aborted responses are meant to stop the handler silently
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+				fmt.Printf("PANIC: %s %s: %v\n%s", r.Method, r.URL.String(), err, debug.Stack())
+				writeErrors(w, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes of list endpoints
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// pageCursor is what an opaque ?cursor= holds: the sort it was made for and
+// the position of the last row of the previous page
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// listPage is the paging of a list request, parsed from ?limit=, ?sort= and ?cursor=
+type listPage struct {
+	sort    string // as given, e.g. -created_at
+	options models.ListOptions
+}
+
+// parseListPage reads the paging parameters of a list endpoint. sorts are the
+// sort fields the endpoint accepts, each also allowed with a leading '-' for
+// descending order. A defaultLimit of 0 lists everything unless ?limit= is given.
+func parseListPage(r *http.Request, sorts []string, defaultSort string, defaultLimit int) (*listPage, error) {
+	query := r.URL.Query()
+	page := &listPage{sort: defaultSort}
+
+	page.options.Limit = defaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, fmt.Errorf("invalid limit, expected 1 to %d", maxPageLimit)
+		}
+		page.options.Limit = limit
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		page.sort = sort
+	}
+	field := strings.TrimPrefix(page.sort, "-")
+	if !models.Contains(sorts, field) {
+		return nil, fmt.Errorf("invalid sort '%s', expected one of %s, optionally prefixed with '-'", page.sort, strings.Join(sorts, ", "))
+	}
+	page.options.Sort = field
+	page.options.Descending = strings.HasPrefix(page.sort, "-")
+
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		data, err := base64.RawURLEncoding.DecodeString(cursorStr)
+		var cursor pageCursor
+		if err != nil || json.Unmarshal(data, &cursor) != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		if cursor.Sort != page.sort {
+			return nil, fmt.Errorf("cursor is for sort '%s', not '%s'", cursor.Sort, page.sort)
+		}
+		page.options.After = &models.ListCursor{Value: cursor.Value, ID: cursor.ID}
+	}
+
+	return page, nil
+}
+
+// fetchOptions are the options to query the database with: one row more than
+// the limit, so trim can tell whether another page follows
+func (p *listPage) fetchOptions() models.ListOptions {
+	options := p.options
+	if options.Limit > 0 {
+		options.Limit++
+	}
+	return options
+}
+
+// trim cuts n fetched rows down to the page size and reports whether more follow
+func (p *listPage) trim(n int) (int, bool) {
+	if p.options.Limit > 0 && n > p.options.Limit {
+		return p.options.Limit, true
+	}
+	return n, false
+}
+
+// cursorAfter encodes the cursor of the page following a row
+func (p *listPage) cursorAfter(value string, id int64) string {
+	data, _ := json.Marshal(pageCursor{Sort: p.sort, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// response reports the paging and the filters in use of a list response.
+// next is the cursor of the following page, empty on the last one.
+func (p *listPage) response(next string, filters map[string]string) map[string]interface{} {
+	applied := map[string]string{}
+	for name, value := range filters {
+		if value != "" {
+			applied[name] = value
+		}
+	}
+
+	pagination := map[string]interface{}{
+		"sort":     p.sort,
+		"has_more": next != "",
+		"filters":  applied,
+	}
+	if p.options.Limit > 0 {
+		pagination["limit"] = p.options.Limit
+	}
+	if next != "" {
+		pagination["next_cursor"] = next
+	}
+	return pagination
+}
+
+// cursorTime formats a timestamp as a cursor value
+func cursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTimeFilter reads a date range filter given as an RFC 3339 time or a plain date
+func parseTimeFilter(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s '%s', expected a date like 2024-05-01 or an RFC 3339 time", name, value)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseListPage(t *testing.T) {
+	sorts := []string{"id", "created_at", "version"}
+	cursorFor := func(sort, value string, id int64) string {
+		return (&listPage{sort: sort}).cursorAfter(value, id)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    models.ListOptions
+		wantErr string
+	}{
+		{name: "defaults", query: "", want: models.ListOptions{Sort: "id", Descending: true, Limit: defaultPageLimit}},
+		{name: "ascending", query: "sort=created_at&limit=10", want: models.ListOptions{Sort: "created_at", Limit: 10}},
+		{name: "descending", query: "sort=-version", want: models.ListOptions{Sort: "version", Descending: true, Limit: defaultPageLimit}},
+		{
+			name:  "cursor round trip",
+			query: "sort=-created_at&cursor=" + cursorFor("-created_at", "2024-05-01T10:00:00Z", 42),
+			want:  models.ListOptions{Sort: "created_at", Descending: true, Limit: defaultPageLimit, After: &models.ListCursor{Value: "2024-05-01T10:00:00Z", ID: 42}},
+		},
+		{
+			name:  "id cursor",
+			query: "cursor=" + cursorFor("-id", "", 7),
+			want:  models.ListOptions{Sort: "id", Descending: true, Limit: defaultPageLimit, After: &models.ListCursor{ID: 7}},
+		},
+		{name: "cursor of another sort", query: "sort=created_at&cursor=" + cursorFor("-created_at", "2024-05-01T10:00:00Z", 42), wantErr: "cursor is for sort '-created_at'"},
+		{name: "garbage cursor", query: "cursor=not-a-cursor!", wantErr: "invalid cursor"},
+		{name: "unknown sort", query: "sort=title", wantErr: "invalid sort 'title'"},
+		{name: "limit too small", query: "limit=0", wantErr: "invalid limit"},
+		{name: "limit too large", query: fmt.Sprintf("limit=%d", maxPageLimit+1), wantErr: "invalid limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/list?"+tt.query, nil)
+			page, err := parseListPage(req, sorts, "-id", defaultPageLimit)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(page.options, tt.want) {
+				t.Fatalf("expected options %+v, got %+v", tt.want, page.options)
+			}
+		})
+	}
+}
+
+func TestUploadBuildsVersionPaging(t *testing.T) {
+	db, err := models.NewSQLiteDatabase(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	user := &models.User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &models.Game{UserID: user.ID, Title: "space-game", Visibility: models.GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+	upload := &models.Upload{GameID: game.ID, Filename: "game.zip"}
+	if err := db.CreateUpload(upload); err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+
+	ids := map[string]int64{}
+	for _, version := range []string{"1.10.0", "1.2.0", "1.2.0 again", "2.0.0-beta.1", "nightly", "2.0.0", "1.9.0"} {
+		// Two builds share 1.2.0, so the version alone can't be the cursor
+		build := &models.Build{UploadID: upload.ID, UserVersion: strings.TrimSuffix(version, " again"), State: "completed"}
+		if err := db.CreateBuild(build); err != nil {
+			t.Fatalf("failed to create build: %v", err)
+		}
+		ids[version] = build.ID
+	}
+
+	h := NewCoreHandlers(db, nil, "bucket")
+	r := mux.NewRouter()
+	r.HandleFunc("/uploads/{id}/builds", h.GetUploadBuilds)
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		// Equal versions list the newer build first; builds without a semver come last
+		{sort: "version", want: []string{"1.2.0 again", "1.2.0", "1.9.0", "1.10.0", "2.0.0-beta.1", "2.0.0", "nightly"}},
+		{sort: "-version", want: []string{"2.0.0", "2.0.0-beta.1", "1.10.0", "1.9.0", "1.2.0 again", "1.2.0", "nightly"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			var got []int64
+			cursor := ""
+			for page := 0; page <= len(ids); page++ {
+				path := fmt.Sprintf("/uploads/%d/builds?sort=%s&limit=2&cursor=%s", upload.ID, tt.sort, cursor)
+				rec := httptest.NewRecorder()
+				r.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+				}
+
+				var response struct {
+					Builds     []struct{ ID int64 }
+					Pagination struct {
+						HasMore    bool   `json:"has_more"`
+						NextCursor string `json:"next_cursor"`
+					}
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatalf("invalid response: %v", err)
+				}
+				for _, build := range response.Builds {
+					got = append(got, build.ID)
+				}
+				if !response.Pagination.HasMore {
+					break
+				}
+				cursor = response.Pagination.NextCursor
+			}
+
+			var want []int64
+			for _, version := range tt.want {
+				want = append(want, ids[version])
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("expected builds %v across pages, got %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// maxSniffedFiles bounds how many executables are read per build
+const maxSniffedFiles = 64
+
+// sniffHeaderSize is how much of a file is read to identify it; enough for
+// the PE header offset of common Windows executables
+const sniffHeaderSize = 4096
+
+// sniffExtensions are file types worth reading even without an execute bit,
+// since Windows builds are usually pushed without one
+var sniffExtensions = map[string]bool{
+	".exe": true, ".dll": true, ".so": true, ".dylib": true, ".x86_64": true, ".x86": true,
+}
+
+// platformSet collects platforms and architectures found in a build
+type platformSet struct {
+	platforms []string
+	archs     []string
+}
+
+func (p *platformSet) add(info models.ExecutableInfo) {
+	if info.Platform != "" && !models.Contains(p.platforms, info.Platform) {
+		p.platforms = append(p.platforms, info.Platform)
+	}
+	for _, arch := range info.Archs {
+		if !models.Contains(p.archs, arch) {
+			p.archs = append(p.archs, arch)
+		}
+	}
+}
+
+// readFileHeader reads the first bytes of a file of an unpacked build
+func (h *WharfHandlers) readFileHeader(buildID int64, filePath string) ([]byte, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(0, sniffHeaderSize-1); err != nil {
+		return nil, err
+	}
+	object, err := h.minioClient.GetObject(context.Background(), h.bucketName, contentPath(buildID, filePath), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return io.ReadAll(io.LimitReader(object, sniffHeaderSize))
+}
+
+// detectPlatforms works out which platforms and architectures a build runs on
+// and stores them on its upload. Executable headers are only read once the
+// build is unpacked; before that, file names and the channel name are used.
+func (h *WharfHandlers) detectPlatforms(build *models.Build) error {
+	upload, err := h.db.GetUploadByID(build.UploadID)
+	if err != nil {
+		return fmt.Errorf("failed to get upload: %w", err)
+	}
+
+	// The owner set the platforms themselves
+	if upload.PlatformsLocked {
+		return nil
+	}
+
+	var binaries, scripts platformSet
+
+	manifest, err := h.loadManifest(build)
+	if err != nil && !errors.Is(err, errNoManifestSource) {
+		return err
+	}
+
+	if manifest != nil {
+		sniffed := 0
+		for _, entry := range manifest.Entries {
+			if entry.Type != "file" {
+				continue
+			}
+
+			var info models.ExecutableInfo
+			found := false
+
+			executable := strings.Contains(entry.Mode, "x") || sniffExtensions[strings.ToLower(path.Ext(entry.Path))]
+			if build.Unpacked && executable && entry.Size > 0 && sniffed < maxSniffedFiles {
+				sniffed++
+				header, err := h.readFileHeader(build.ID, entry.Path)
+				if err != nil {
+					fmt.Printf("Warning: could not read %s of build %d: %v\n", entry.Path, build.ID, err)
+				} else {
+					info, found = models.SniffExecutable(header)
+				}
+			}
+			if !found {
+				info, found = models.PlatformFromPath(entry.Path)
+			}
+			if !found {
+				continue
+			}
+
+			if info.Script {
+				scripts.add(info)
+			} else {
+				binaries.add(info)
+			}
+		}
+	}
+
+	detected := binaries
+	if len(detected.platforms) == 0 {
+		detected = scripts
+	}
+
+	// Channel names fill in whatever the content didn't tell us
+	channels, err := h.db.GetChannelsByUploadID(upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get channels: %w", err)
+	}
+	var fromChannels platformSet
+	for _, channel := range channels {
+		platforms, archs := models.PlatformsFromChannel(channel.Name)
+		for _, platform := range platforms {
+			fromChannels.add(models.ExecutableInfo{Platform: platform})
+		}
+		fromChannels.add(models.ExecutableInfo{Archs: archs})
+	}
+	if len(detected.platforms) == 0 {
+		detected.platforms = fromChannels.platforms
+	}
+	if len(detected.archs) == 0 {
+		detected.archs = fromChannels.archs
+	}
+
+	if len(detected.platforms) == 0 && len(detected.archs) == 0 {
+		return nil
+	}
+
+	sort.Strings(detected.platforms)
+	sort.Strings(detected.archs)
+
+	if slices.Equal(detected.platforms, upload.Platforms) && slices.Equal(detected.archs, upload.Architectures) {
+		return nil
+	}
+
+	fmt.Printf("Detected platforms %v and architectures %v for upload %d from build %d\n", detected.platforms, detected.archs, upload.ID, build.ID)
+	return h.db.UpdateUploadPlatforms(upload.ID, detected.platforms, detected.archs)
+}
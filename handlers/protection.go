@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// channelProtectionResponse formats a protection for API responses
+func channelProtectionResponse(channelName string, protection *models.ChannelProtection) map[string]interface{} {
+	return map[string]interface{}{
+		"channel":              channelName,
+		"restrict_push":        protection.RestrictPush,
+		"user_version_pattern": protection.UserVersionPattern,
+		"promotion_only":       protection.PromotionOnly,
+		"required_labels":      protection.RequiredLabels,
+	}
+}
+
+// checkChannelProtection returns an error if the channel's protection rules forbid
+// the user from putting a build with the given user version and labels on it
+func (h *WharfHandlers) checkChannelProtection(user *models.User, channel *models.Channel, userVersion string, labels []string, promoted bool) error {
+	protection, err := h.db.GetChannelProtection(channel.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("could not load protection for channel '%s': %v", channel.Name, err)
+	}
+	return protection.CheckPush(user, channel.Name, userVersion, labels, promoted)
+}
+
+// GET /wharf/channels/{channel}/protection - Get the protection settings of a channel
+func (h *WharfHandlers) GetChannelProtection(w http.ResponseWriter, r *http.Request) {
+	_, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	protection, err := h.db.GetChannelProtection(channel.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Unprotected channels report the permissive defaults
+		protection = &models.ChannelProtection{ChannelID: channel.ID, RequiredLabels: []string{}}
+	}
+
+	response := map[string]interface{}{
+		"protection": channelProtectionResponse(channel.Name, protection),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /wharf/channels/{channel}/protection - Set the protection settings of a channel
+func (h *WharfHandlers) SetChannelProtection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RestrictPush       bool     `json:"restrict_push"`
+		UserVersionPattern string   `json:"user_version_pattern"`
+		PromotionOnly      bool     `json:"promotion_only"`
+		RequiredLabels     []string `json:"required_labels"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if req.UserVersionPattern != "" {
+		if _, err := regexp.Compile(req.UserVersionPattern); err != nil {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid user_version_pattern: %s", err.Error()))
+			return
+		}
+	}
+
+	if err := validateLabels(req.RequiredLabels); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	// Owners are the ones protection guards against, so they can't lift it
+	if !user.IsAdmin() {
+		writeErrors(w, http.StatusForbidden, "only admins may change channel protection")
+		return
+	}
+
+	protection := &models.ChannelProtection{
+		ChannelID:          channel.ID,
+		RestrictPush:       req.RestrictPush,
+		UserVersionPattern: req.UserVersionPattern,
+		PromotionOnly:      req.PromotionOnly,
+		RequiredLabels:     req.RequiredLabels,
+	}
+	if protection.RequiredLabels == nil {
+		protection.RequiredLabels = []string{}
+	}
+
+	if err := h.db.SaveChannelProtection(protection); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s updated protection for channel %s (channel ID %d)\n", user.Username, channel.Name, channel.ID)
+
+	response := map[string]interface{}{
+		"protection": channelProtectionResponse(channel.Name, protection),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/channels/{channel}/protection - Remove all protection from a channel
+func (h *WharfHandlers) DeleteChannelProtection(w http.ResponseWriter, r *http.Request) {
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if !user.IsAdmin() {
+		writeErrors(w, http.StatusForbidden, "only admins may change channel protection")
+		return
+	}
+
+	if err := h.db.DeleteChannelProtection(channel.ID); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s removed protection from channel %s (channel ID %d)\n", user.Username, channel.Name, channel.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// POST /wharf/channels/{channel}/promote - Point a channel at an existing build of the same game
+func (h *WharfHandlers) PromoteBuild(w http.ResponseWriter, r *http.Request) {
+	channelName := mux.Vars(r)["channel"]
+	user := auth.MustGetUser(r.Context())
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "could not read request body")
+		return
+	}
+
+	// Parse request body - JSON or form data like the other wharf endpoints
+	var req struct {
+		Target  string `json:"target"`
+		GameID  int64  `json:"game_id"`
+		BuildID int64  `json:"build_id"`
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		if err = json.Unmarshal(body, &req); err != nil {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+			return
+		}
+	} else {
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		if err = r.ParseForm(); err != nil {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid form data: %s", err.Error()))
+			return
+		}
+		req.Target = r.Form.Get("target")
+		if gameIDStr := r.Form.Get("game_id"); gameIDStr != "" {
+			req.GameID, err = strconv.ParseInt(gameIDStr, 10, 64)
+			if err != nil {
+				writeErrors(w, http.StatusBadRequest, "invalid game_id")
+				return
+			}
+		}
+		if buildIDStr := r.Form.Get("build_id"); buildIDStr != "" {
+			req.BuildID, err = strconv.ParseInt(buildIDStr, 10, 64)
+			if err != nil {
+				writeErrors(w, http.StatusBadRequest, "invalid build id")
+				return
+			}
+		}
+	}
+
+	if req.BuildID == 0 {
+		writeErrors(w, http.StatusBadRequest, "missing build_id")
+		return
+	}
+
+	var gameIDStr string
+	if req.GameID != 0 {
+		gameIDStr = strconv.FormatInt(req.GameID, 10)
+	}
+
+	bt, err := h.resolveTarget(user, req.Target, gameIDStr, false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	build, err := h.db.GetBuildByID(req.BuildID)
+	if err != nil {
+		writeErrors(w, http.StatusNotFound, "build not found")
+		return
+	}
+
+	buildUpload, err := h.db.GetUploadByID(build.UploadID)
+	if err != nil || buildUpload.GameID != game.ID {
+		writeErrors(w, http.StatusBadRequest, "build does not belong to this game")
+		return
+	}
+
+	if build.State != "completed" {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("build %d is not completed (state: %s)", build.ID, build.State))
+		return
+	}
+
+	channel, _, err := h.findGameChannel(game.ID, channelName)
+	if err != nil && !errors.Is(err, errChannelNotFound) {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := h.checkVersionPolicy(game, channelName, channel, build.UserVersion, build.ID); err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	var previousBuildID *int64
+	if channel != nil {
+		labels, err := h.db.GetBuildLabels(build.ID)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := h.checkChannelProtection(user, channel, build.UserVersion, labels, true); err != nil {
+			writeErrors(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		previousBuildID = channel.CurrentBuildID
+		channel.CurrentBuildID = &build.ID
+		// Promoting the rollout candidate completes the rollout
+		if channel.CandidateBuildID != nil && *channel.CandidateBuildID == build.ID {
+			channel.ClearRollout()
+		}
+		err = h.db.UpdateChannel(channel)
+	} else {
+		// Promoting into a channel that doesn't exist yet creates it on the build's upload
+		channel = &models.Channel{
+			Name:           channelName,
+			UploadID:       buildUpload.ID,
+			CurrentBuildID: &build.ID,
+		}
+		err = h.db.CreateChannel(channel)
+	}
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.recordHeadChange(channel, previousBuildID, models.HeadChangePromote, user.Username)
+	fmt.Printf("User %s promoted build %d to channel %s\n", user.Username, build.ID, channel.Name)
+
+	buildData := map[string]interface{}{
+		"id":    build.ID,
+		"state": build.State,
+	}
+
+	if build.UserVersion != "" {
+		buildData["user_version"] = build.UserVersion
+	}
+
+	if build.ParentBuildID != nil {
+		buildData["parent_build_id"] = *build.ParentBuildID
+	}
+
+	response := map[string]interface{}{
+		"channel": map[string]interface{}{
+			"name": channel.Name,
+			"upload": map[string]interface{}{
+				"id": channel.UploadID,
+			},
+			"head": buildData,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
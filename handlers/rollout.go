@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// channelRolloutData formats a channel's staged rollout for API responses
+func channelRolloutData(channel *models.Channel) map[string]interface{} {
+	data := map[string]interface{}{
+		"channel":            channel.Name,
+		"candidate_build_id": channel.CandidateBuildID,
+		"head_build_id":      channel.CurrentBuildID,
+		"percent":            channel.RolloutPercent,
+		"paused":             channel.RolloutPaused,
+		"state":              "in_progress",
+	}
+	if channel.RolloutPaused {
+		data["state"] = "paused"
+	}
+	return data
+}
+
+// checkRolloutProtection applies the channel's protection rules to a change of
+// its rollout. Rollouts put the candidate on the channel much like a promotion.
+func (h *WharfHandlers) checkRolloutProtection(user *models.User, channel *models.Channel, candidateBuildID int64) error {
+	candidate, err := h.db.GetBuildByID(candidateBuildID)
+	if err != nil {
+		return fmt.Errorf("failed to get candidate build %d: %v", candidateBuildID, err)
+	}
+	labels, err := h.db.GetBuildLabels(candidate.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get labels of candidate build %d: %v", candidateBuildID, err)
+	}
+	return h.checkChannelProtection(user, channel, candidate.UserVersion, labels, true)
+}
+
+// GET /wharf/channels/{channel}/rollout - Get the staged rollout of a channel
+func (h *WharfHandlers) GetChannelRollout(w http.ResponseWriter, r *http.Request) {
+	_, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if channel.CandidateBuildID == nil {
+		writeErrors(w, http.StatusNotFound, fmt.Sprintf("channel '%s' has no rollout in progress", channel.Name))
+		return
+	}
+
+	response := map[string]interface{}{
+		"rollout": channelRolloutData(channel),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /wharf/channels/{channel}/rollout - Start a staged rollout or change its percentage.
+// Reaching 100 percent makes the candidate the channel's head.
+func (h *WharfHandlers) SetChannelRollout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		BuildID int64 `json:"build_id"`
+		Percent *int  `json:"percent"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if req.Percent == nil {
+		writeErrors(w, http.StatusBadRequest, "missing percent")
+		return
+	}
+	if *req.Percent < 0 || *req.Percent > 100 {
+		writeErrors(w, http.StatusBadRequest, "percent must be between 0 and 100")
+		return
+	}
+
+	user, game, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if req.BuildID != 0 && (channel.CandidateBuildID == nil || *channel.CandidateBuildID != req.BuildID) {
+		// Starting a rollout, or replacing the candidate of a running one
+		if channel.CurrentBuildID == nil {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("channel '%s' has no head to roll out from, promote the build instead", channel.Name))
+			return
+		}
+		if *channel.CurrentBuildID == req.BuildID {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("build %d is already the head of channel '%s'", req.BuildID, channel.Name))
+			return
+		}
+
+		build, err := h.db.GetBuildByID(req.BuildID)
+		if err != nil {
+			writeErrors(w, http.StatusNotFound, "build not found")
+			return
+		}
+
+		buildUpload, err := h.db.GetUploadByID(build.UploadID)
+		if err != nil || buildUpload.GameID != game.ID {
+			writeErrors(w, http.StatusBadRequest, "build does not belong to this game")
+			return
+		}
+
+		if build.State != "completed" {
+			writeErrors(w, http.StatusBadRequest, fmt.Sprintf("build %d is not completed (state: %s)", build.ID, build.State))
+			return
+		}
+
+		channel.CandidateBuildID = &build.ID
+		channel.RolloutPaused = false
+	} else if channel.CandidateBuildID == nil {
+		writeErrors(w, http.StatusBadRequest, "missing build_id")
+		return
+	} else if channel.RolloutPaused && *req.Percent > channel.RolloutPercent {
+		writeErrors(w, http.StatusConflict, fmt.Sprintf("the rollout on channel '%s' is paused, resume it before raising the percentage", channel.Name))
+		return
+	}
+
+	if err := h.checkRolloutProtection(user, channel, *channel.CandidateBuildID); err != nil {
+		writeErrors(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	// The head may have moved on since the rollout started, so the policy is checked on every change
+	candidate, err := h.db.GetBuildByID(*channel.CandidateBuildID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := h.checkVersionPolicy(game, channel.Name, channel, candidate.UserVersion, candidate.ID); err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	previousBuildID := channel.CurrentBuildID
+	var data map[string]interface{}
+	if *req.Percent == 100 {
+		channel.CurrentBuildID = channel.CandidateBuildID
+		channel.ClearRollout()
+		data = map[string]interface{}{
+			"channel":       channel.Name,
+			"head_build_id": channel.CurrentBuildID,
+			"state":         "completed",
+		}
+	} else {
+		channel.RolloutPercent = *req.Percent
+		data = channelRolloutData(channel)
+	}
+
+	if err := h.db.UpdateChannel(channel); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if channel.CandidateBuildID == nil {
+		h.recordHeadChange(channel, previousBuildID, models.HeadChangeRollout, user.Username)
+		fmt.Printf("User %s completed the rollout of build %d on channel %s\n", user.Username, *channel.CurrentBuildID, channel.Name)
+	} else {
+		fmt.Printf("User %s set the rollout of build %d on channel %s to %d%%\n", user.Username, *channel.CandidateBuildID, channel.Name, channel.RolloutPercent)
+	}
+
+	response := map[string]interface{}{
+		"rollout": data,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /wharf/channels/{channel}/rollout/pause - Stop offering the candidate to more installs
+func (h *WharfHandlers) PauseChannelRollout(w http.ResponseWriter, r *http.Request) {
+	h.setRolloutPaused(w, r, true)
+}
+
+// POST /wharf/channels/{channel}/rollout/resume - Resume a paused rollout
+func (h *WharfHandlers) ResumeChannelRollout(w http.ResponseWriter, r *http.Request) {
+	h.setRolloutPaused(w, r, false)
+}
+
+func (h *WharfHandlers) setRolloutPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if channel.CandidateBuildID == nil {
+		writeErrors(w, http.StatusConflict, fmt.Sprintf("channel '%s' has no rollout in progress", channel.Name))
+		return
+	}
+
+	if err := h.checkRolloutProtection(user, channel, *channel.CandidateBuildID); err != nil {
+		writeErrors(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	channel.RolloutPaused = paused
+	if err := h.db.UpdateChannel(channel); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	action := "resumed"
+	if paused {
+		action = "paused"
+	}
+	fmt.Printf("User %s %s the rollout of build %d on channel %s\n", user.Username, action, *channel.CandidateBuildID, channel.Name)
+
+	response := map[string]interface{}{
+		"rollout": channelRolloutData(channel),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/channels/{channel}/rollout - Abort a rollout, sending every install back to the head
+func (h *WharfHandlers) AbortChannelRollout(w http.ResponseWriter, r *http.Request) {
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	if channel.CandidateBuildID == nil {
+		writeErrors(w, http.StatusConflict, fmt.Sprintf("channel '%s' has no rollout in progress", channel.Name))
+		return
+	}
+
+	if err := h.checkRolloutProtection(user, channel, *channel.CandidateBuildID); err != nil {
+		writeErrors(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	candidateBuildID := *channel.CandidateBuildID
+	channel.ClearRollout()
+	if err := h.db.UpdateChannel(channel); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s aborted the rollout of build %d on channel %s\n", user.Username, candidateBuildID, channel.Name)
+
+	response := map[string]interface{}{
+		"rollout": map[string]interface{}{
+			"channel":            channel.Name,
+			"candidate_build_id": candidateBuildID,
+			"head_build_id":      channel.CurrentBuildID,
+			"state":              "aborted",
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
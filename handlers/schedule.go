@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RunReleaseScheduler applies scheduled releases as they fall due, until ctx
+// is cancelled. Pending releases live in the database, so releases that fell
+// due while the server was down are applied on the first pass.
+func (h *WharfHandlers) RunReleaseScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		h.applyDueReleases(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyDueReleases applies every pending release whose time has come
+func (h *WharfHandlers) applyDueReleases(now time.Time) {
+	releases, err := h.db.GetPendingScheduledReleases()
+	if err != nil {
+		fmt.Printf("Warning: could not load scheduled releases: %v\n", err)
+		return
+	}
+
+	for _, release := range releases {
+		if release.ReleaseAt.After(now) {
+			continue
+		}
+		if err := h.applyScheduledRelease(release); err != nil {
+			fmt.Printf("Warning: scheduled release %d failed: %v\n", release.ID, err)
+		}
+	}
+}
+
+// applyScheduledRelease makes the release's build the head of its channel.
+// Releases whose build is still processing stay pending until it completes.
+func (h *WharfHandlers) applyScheduledRelease(release *models.ScheduledRelease) error {
+	fail := func(err error) error {
+		if _, setErr := h.db.SetScheduledReleaseState(release.ID, models.ReleaseStateApplied, models.ReleaseStateFailed, err.Error()); setErr != nil {
+			fmt.Printf("Warning: could not mark scheduled release %d as failed: %v\n", release.ID, setErr)
+		}
+		return err
+	}
+
+	build, buildErr := h.db.GetBuildByID(release.BuildID)
+	if buildErr == nil && build.State != "completed" {
+		fmt.Printf("Scheduled release %d is due but build %d is still %s\n", release.ID, build.ID, build.State)
+		return nil
+	}
+
+	// Claim the release so that another server instance doesn't apply it too
+	claimed, err := h.db.SetScheduledReleaseState(release.ID, models.ReleaseStatePending, models.ReleaseStateApplied, "")
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	if buildErr != nil {
+		return fail(fmt.Errorf("build %d not found", release.BuildID))
+	}
+
+	channel, err := h.db.GetChannelByID(release.ChannelID)
+	if err != nil {
+		return fail(fmt.Errorf("channel %d not found", release.ChannelID))
+	}
+
+	upload, err := h.db.GetUploadByID(channel.UploadID)
+	if err != nil {
+		return fail(fmt.Errorf("upload %d not found", channel.UploadID))
+	}
+	_, game, err := h.db.GetGameByID(upload.GameID)
+	if err != nil {
+		return fail(fmt.Errorf("game %d not found", upload.GameID))
+	}
+
+	// Labels, protection and the scheduling user may have changed since the
+	// release was scheduled, so the checks of ScheduleRelease are run again
+	user, err := h.db.GetUserByUsername(release.CreatedBy)
+	if err != nil || !user.IsActive {
+		return fail(fmt.Errorf("user '%s' who scheduled the release no longer exists", release.CreatedBy))
+	}
+	labels, err := h.db.GetBuildLabels(build.ID)
+	if err != nil {
+		return fail(fmt.Errorf("failed to get labels of build %d: %v", build.ID, err))
+	}
+	if err := h.checkChannelProtection(user, channel, build.UserVersion, labels, true); err != nil {
+		return fail(err)
+	}
+
+	// Other builds may have reached the channel since the release was scheduled
+	if err := h.checkVersionPolicy(game, channel.Name, channel, build.UserVersion, build.ID); err != nil {
+		return fail(err)
+	}
+
+	previousBuildID := channel.CurrentBuildID
+	channel.CurrentBuildID = &build.ID
+	if channel.CandidateBuildID != nil && *channel.CandidateBuildID == build.ID {
+		channel.ClearRollout()
+	}
+	if err := h.db.UpdateChannel(channel); err != nil {
+		return fail(fmt.Errorf("failed to update channel: %v", err))
+	}
+
+	h.recordHeadChange(channel, previousBuildID, models.HeadChangeSchedule, release.CreatedBy)
+	fmt.Printf("Applied scheduled release %d: build %d is now the head of channel %s\n", release.ID, build.ID, channel.Name)
+	return nil
+}
+
+// POST /wharf/channels/{channel}/schedule - Make a build the channel's head at a set time
+func (h *WharfHandlers) ScheduleRelease(w http.ResponseWriter, r *http.Request) {
+	channelName := mux.Vars(r)["channel"]
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		BuildID   int64  `json:"build_id"`
+		ReleaseAt string `json:"release_at"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if req.BuildID == 0 {
+		writeErrors(w, http.StatusBadRequest, "missing build_id")
+		return
+	}
+
+	releaseAt, err := time.Parse(time.RFC3339, req.ReleaseAt)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "release_at must be an RFC 3339 time, like 2025-06-01T17:00:00Z")
+		return
+	}
+	if !releaseAt.After(time.Now()) {
+		writeErrors(w, http.StatusBadRequest, "release_at must be in the future")
+		return
+	}
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	// The build may still be processing, the scheduler waits for it
+	build, err := h.db.GetBuildByID(req.BuildID)
+	if err != nil {
+		writeErrors(w, http.StatusNotFound, "build not found")
+		return
+	}
+
+	buildUpload, err := h.db.GetUploadByID(build.UploadID)
+	if err != nil || buildUpload.GameID != game.ID {
+		writeErrors(w, http.StatusBadRequest, "build does not belong to this game")
+		return
+	}
+
+	channel, _, err := h.findGameChannel(game.ID, channelName)
+	if err != nil && !errors.Is(err, errChannelNotFound) {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := h.checkVersionPolicy(game, channelName, channel, build.UserVersion, build.ID); err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	if channel != nil {
+		labels, err := h.db.GetBuildLabels(build.ID)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := h.checkChannelProtection(user, channel, build.UserVersion, labels, true); err != nil {
+			writeErrors(w, http.StatusForbidden, err.Error())
+			return
+		}
+	} else {
+		// Launching on a new channel: create it without a head until the release
+		channel = &models.Channel{
+			Name:     channelName,
+			UploadID: buildUpload.ID,
+		}
+		if err := h.db.CreateChannel(channel); err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	release := &models.ScheduledRelease{
+		ChannelID: channel.ID,
+		BuildID:   build.ID,
+		ReleaseAt: releaseAt.UTC(),
+		State:     models.ReleaseStatePending,
+		CreatedBy: user.Username,
+	}
+	if err := h.db.CreateScheduledRelease(release); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s scheduled build %d for channel %s at %s\n", user.Username, build.ID, channel.Name, release.ReleaseAt.Format(time.RFC3339))
+
+	response := map[string]interface{}{
+		"release": release,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /wharf/channels/{channel}/schedule - List the scheduled releases of a channel
+func (h *WharfHandlers) ListScheduledReleases(w http.ResponseWriter, r *http.Request) {
+	_, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	releases, err := h.db.GetScheduledReleasesByChannelID(channel.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if releases == nil {
+		releases = []*models.ScheduledRelease{}
+	}
+
+	response := map[string]interface{}{
+		"channel":  channel.Name,
+		"releases": releases,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/channels/{channel}/schedule/{id} - Cancel a pending scheduled release
+func (h *WharfHandlers) CancelScheduledRelease(w http.ResponseWriter, r *http.Request) {
+	releaseID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid release id")
+		return
+	}
+
+	user, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
+		return
+	}
+
+	release, err := h.db.GetScheduledReleaseByID(releaseID)
+	if err != nil || release.ChannelID != channel.ID {
+		writeErrors(w, http.StatusNotFound, "scheduled release not found")
+		return
+	}
+
+	cancelled, err := h.db.SetScheduledReleaseState(release.ID, models.ReleaseStatePending, models.ReleaseStateCancelled, "")
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !cancelled {
+		writeErrors(w, http.StatusConflict, fmt.Sprintf("scheduled release %d is no longer pending", release.ID))
+		return
+	}
+
+	fmt.Printf("User %s cancelled scheduled release %d of build %d on channel %s\n", user.Username, release.ID, release.BuildID, channel.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// buildTarget is a wharf build target resolved to its namespace owner and game
+type buildTarget struct {
+	Owner    *models.User
+	Game     *models.Game // nil if the game doesn't exist yet and that was allowed
+	GameName string
+}
+
+// targetError is returned by resolveTarget with the status code to respond with
+type targetError struct {
+	status  int
+	message string
+}
+
+func (e *targetError) Error() string {
+	return e.message
+}
+
+// writeTargetError writes the response for an error returned by resolveTarget
+func writeTargetError(w http.ResponseWriter, err error) {
+	if te, ok := err.(*targetError); ok {
+		writeErrors(w, te.status, te.message)
+		return
+	}
+	writeErrors(w, http.StatusInternalServerError, err.Error())
+}
+
+// resolveTarget resolves either a numeric game_id or a "username/gamename"
+// target to the namespace owner and game, checking that the user may access
+// the owner's namespace. The game_id takes precedence when both are given.
+// With allowMissingGame, a target naming a game that doesn't exist yet
+// resolves with a nil Game so the caller can create it.
+func (h *WharfHandlers) resolveTarget(user *models.User, target, gameIDStr string, allowMissingGame bool) (*buildTarget, error) {
+	if gameIDStr != "" {
+		gameID, err := strconv.ParseInt(gameIDStr, 10, 64)
+		if err != nil {
+			return nil, &targetError{http.StatusBadRequest, "invalid game_id"}
+		}
+
+		owner, game, err := h.db.GetGameByID(gameID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, &targetError{http.StatusNotFound, "game not found"}
+		}
+		if err != nil {
+			return nil, &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to look up game: %v", err)}
+		}
+
+		if err := h.validateNamespaceAccess(user, owner.Username); err != nil {
+			fmt.Printf("Namespace access denied: %v\n", err)
+			return nil, &targetError{http.StatusForbidden, "access denied"}
+		}
+
+		return &buildTarget{Owner: owner, Game: game, GameName: game.Title}, nil
+	}
+
+	if target == "" {
+		return nil, &targetError{http.StatusBadRequest, "missing build target (need game_id or target)"}
+	}
+
+	// Parse target format: "username/gamename"
+	parts := strings.Split(target, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, &targetError{http.StatusBadRequest, "invalid target format, expected username/gamename"}
+	}
+	username, gameName := parts[0], parts[1]
+
+	if err := h.validateNamespaceAccess(user, username); err != nil {
+		fmt.Printf("Namespace access denied: %v\n", err)
+		return nil, &targetError{http.StatusForbidden, "access denied"}
+	}
+
+	// Games belong to the namespace owner, not to whoever is making the request
+	owner, err := h.db.GetUserByUsername(username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &targetError{http.StatusNotFound, fmt.Sprintf("namespace owner not found: %s", username)}
+	}
+	if err != nil {
+		return nil, &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to look up namespace owner: %v", err)}
+	}
+
+	game, err := h.db.GetGameByUserAndTitle(owner.ID, gameName)
+	if err != nil {
+		// Only a game that really doesn't exist may be created, not one that failed to load
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to look up game: %v", err)}
+		}
+		if !allowMissingGame {
+			return nil, &targetError{http.StatusNotFound, "game not found"}
+		}
+		game = nil
+	}
+
+	return &buildTarget{Owner: owner, Game: game, GameName: gameName}, nil
+}
+
+// resolveBuild looks up a build by its id string and checks that the user may
+// access the namespace of the game it belongs to
+func (h *WharfHandlers) resolveBuild(user *models.User, buildIDStr string) (*models.Build, *buildTarget, error) {
+	buildID, err := strconv.ParseInt(buildIDStr, 10, 64)
+	if err != nil {
+		return nil, nil, &targetError{http.StatusBadRequest, "invalid build id"}
+	}
+
+	build, err := h.db.GetBuildByID(buildID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, &targetError{http.StatusNotFound, "build not found"}
+	}
+	if err != nil {
+		return nil, nil, &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to look up build: %v", err)}
+	}
+
+	upload, err := h.db.GetUploadByID(build.UploadID)
+	if err != nil {
+		return nil, nil, &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to look up upload of build %d: %v", build.ID, err)}
+	}
+
+	bt, err := h.resolveTarget(user, "", strconv.FormatInt(upload.GameID, 10), false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return build, bt, nil
+}
+
+// resolveUpload looks up an upload by its id string and checks that the user
+// may access the namespace of the game it belongs to
+func (h *WharfHandlers) resolveUpload(user *models.User, uploadIDStr string) (*models.Upload, *buildTarget, error) {
+	uploadID, err := strconv.ParseInt(uploadIDStr, 10, 64)
+	if err != nil {
+		return nil, nil, &targetError{http.StatusBadRequest, "invalid upload id"}
+	}
+
+	upload, err := h.db.GetUploadByID(uploadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, &targetError{http.StatusNotFound, "upload not found"}
+	}
+	if err != nil {
+		return nil, nil, &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to look up upload: %v", err)}
+	}
+
+	bt, err := h.resolveTarget(user, "", strconv.FormatInt(upload.GameID, 10), false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return upload, bt, nil
+}
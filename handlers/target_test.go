@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// fakeDB is an in-memory models.Database covering the lookups target resolution needs.
+// Unimplemented methods come from the embedded nil interface and panic if called.
+type fakeDB struct {
+	models.Database
+	users    []*models.User
+	games    []*models.Game
+	uploads  []*models.Upload
+	channels []*models.Channel
+	// dbErr is returned by lookups of the failing username, game id, game
+	// title and channel name
+	failingUsername string
+	failingGameID   int64
+	failingTitle    string
+	failingChannel  string
+	dbErr           error
+}
+
+func (f *fakeDB) GetUserByUsername(username string) (*models.User, error) {
+	if username == f.failingUsername {
+		return nil, f.dbErr
+	}
+	for _, u := range f.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeDB) GetGameByID(id int64) (*models.User, *models.Game, error) {
+	if id == f.failingGameID {
+		return nil, nil, f.dbErr
+	}
+	for _, g := range f.games {
+		if g.ID == id {
+			for _, u := range f.users {
+				if u.ID == g.UserID {
+					return u, g, nil
+				}
+			}
+		}
+	}
+	return nil, nil, sql.ErrNoRows
+}
+
+func (f *fakeDB) GetGameByUserAndTitle(userID int64, title string) (*models.Game, error) {
+	if title == f.failingTitle {
+		return nil, f.dbErr
+	}
+	for _, g := range f.games {
+		if g.UserID == userID && g.Title == title {
+			return g, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeDB) GetUploadsByGameID(gameID int64) ([]*models.Upload, error) {
+	var uploads []*models.Upload
+	for _, u := range f.uploads {
+		if u.GameID == gameID {
+			uploads = append(uploads, u)
+		}
+	}
+	return uploads, nil
+}
+
+func (f *fakeDB) GetChannelByName(name string, uploadID int64) (*models.Channel, error) {
+	if name == f.failingChannel {
+		return nil, f.dbErr
+	}
+	for _, c := range f.channels {
+		if c.Name == name && c.UploadID == uploadID {
+			return c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeDB) SaveChannelProtection(protection *models.ChannelProtection) error {
+	return nil
+}
+
+func (f *fakeDB) DeleteChannelProtection(channelID int64) error {
+	return nil
+}
+
+func (f *fakeDB) ListChannelsByGameID(gameID int64, opts models.ListOptions) ([]*models.Channel, error) {
+	return nil, nil
+}
+
+var (
+	testAlice = &models.User{ID: 1, Username: "alice", Role: "user", IsActive: true}
+	testBob   = &models.User{ID: 2, Username: "bob", Role: "user", IsActive: true}
+	testAdmin = &models.User{ID: 3, Username: "root", Role: "admin", IsActive: true}
+)
+
+func newTestWharfHandlers() *WharfHandlers {
+	db := &fakeDB{
+		users: []*models.User{testAlice, testBob, testAdmin},
+		games: []*models.Game{
+			{ID: 10, UserID: testAlice.ID, Title: "space-game"},
+			{ID: 20, UserID: testBob.ID, Title: "puzzle"},
+		},
+		uploads: []*models.Upload{
+			{ID: 100, GameID: 10, Filename: "windows.zip"},
+			{ID: 101, GameID: 10, Filename: "linux.zip"},
+		},
+		channels: []*models.Channel{
+			{ID: 1000, Name: "linux", UploadID: 101},
+		},
+		failingUsername: "flaky",
+		failingGameID:   30,
+		failingTitle:    "flaky-game",
+		failingChannel:  "flaky-channel",
+		dbErr:           errors.New("database is locked"),
+	}
+	return NewWharfHandlers(db, nil, "")
+}
+
+func TestResolveTarget(t *testing.T) {
+	h := newTestWharfHandlers()
+
+	tests := []struct {
+		name         string
+		user         *models.User
+		target       string
+		gameID       string
+		allowMissing bool
+		wantStatus   int // 0 means success
+		wantOwner    string
+		wantGameID   int64
+	}{
+		{name: "owner by target", user: testAlice, target: "alice/space-game", wantOwner: "alice", wantGameID: 10},
+		{name: "owner by game_id", user: testAlice, gameID: "10", wantOwner: "alice", wantGameID: 10},
+		{name: "admin foreign namespace by target", user: testAdmin, target: "alice/space-game", wantOwner: "alice", wantGameID: 10},
+		{name: "admin foreign namespace by game_id", user: testAdmin, gameID: "20", wantOwner: "bob", wantGameID: 20},
+		{name: "non-admin foreign namespace by target", user: testBob, target: "alice/space-game", wantStatus: http.StatusForbidden},
+		{name: "non-admin foreign namespace by game_id", user: testBob, gameID: "10", wantStatus: http.StatusForbidden},
+		{name: "non-admin foreign missing game", user: testBob, target: "alice/new-game", allowMissing: true, wantStatus: http.StatusForbidden},
+		{name: "game_id takes precedence", user: testAlice, target: "bob/puzzle", gameID: "10", wantOwner: "alice", wantGameID: 10},
+		{name: "missing game", user: testAlice, target: "alice/unknown", wantStatus: http.StatusNotFound},
+		{name: "missing game allowed", user: testAlice, target: "alice/new-game", allowMissing: true, wantOwner: "alice"},
+		{name: "lookup error", user: testAlice, target: "alice/flaky-game", wantStatus: http.StatusInternalServerError},
+		{name: "lookup error with missing game allowed", user: testAlice, target: "alice/flaky-game", allowMissing: true, wantStatus: http.StatusInternalServerError},
+		{name: "admin creating in foreign namespace", user: testAdmin, target: "bob/new-game", allowMissing: true, wantOwner: "bob"},
+		{name: "unknown game_id", user: testAdmin, gameID: "99", wantStatus: http.StatusNotFound},
+		{name: "unknown namespace owner", user: testAdmin, target: "carol/game", wantStatus: http.StatusNotFound},
+		{name: "game_id lookup error", user: testAdmin, gameID: "30", wantStatus: http.StatusInternalServerError},
+		{name: "namespace owner lookup error", user: testAdmin, target: "flaky/game", wantStatus: http.StatusInternalServerError},
+		{name: "invalid game_id", user: testAlice, gameID: "abc", wantStatus: http.StatusBadRequest},
+		{name: "invalid target", user: testAlice, target: "alice", wantStatus: http.StatusBadRequest},
+		{name: "empty target part", user: testAlice, target: "alice/", wantStatus: http.StatusBadRequest},
+		{name: "no target", user: testAlice, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bt, err := h.resolveTarget(tt.user, tt.target, tt.gameID, tt.allowMissing)
+
+			if tt.wantStatus != 0 {
+				te, ok := err.(*targetError)
+				if !ok {
+					t.Fatalf("expected targetError with status %d, got %v", tt.wantStatus, err)
+				}
+				if te.status != tt.wantStatus {
+					t.Fatalf("expected status %d, got %d (%s)", tt.wantStatus, te.status, te.message)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if bt.Owner.Username != tt.wantOwner {
+				t.Errorf("expected owner %s, got %s", tt.wantOwner, bt.Owner.Username)
+			}
+			if tt.wantGameID == 0 {
+				if bt.Game != nil {
+					t.Errorf("expected no game, got game %d", bt.Game.ID)
+				}
+			} else if bt.Game == nil || bt.Game.ID != tt.wantGameID {
+				t.Errorf("expected game %d, got %+v", tt.wantGameID, bt.Game)
+			}
+		})
+	}
+}
+
+func TestListChannelsNamespaceAccess(t *testing.T) {
+	h := newTestWharfHandlers()
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		query      string
+		wantStatus int
+	}{
+		{name: "owner", user: testAlice, query: "target=alice/space-game", wantStatus: http.StatusOK},
+		{name: "admin foreign namespace", user: testAdmin, query: "target=alice/space-game", wantStatus: http.StatusOK},
+		{name: "admin foreign namespace by game_id", user: testAdmin, query: "game_id=10", wantStatus: http.StatusOK},
+		{name: "non-admin foreign namespace", user: testBob, query: "target=alice/space-game", wantStatus: http.StatusForbidden},
+		{name: "non-admin foreign namespace by game_id", user: testBob, query: "game_id=10", wantStatus: http.StatusForbidden},
+		{name: "missing target", user: testAlice, query: "", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/wharf/channels?"+tt.query, nil)
+			req = req.WithContext(auth.SetUser(req.Context(), tt.user))
+			rec := httptest.NewRecorder()
+
+			h.ListChannels(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetChannelLookup(t *testing.T) {
+	h := newTestWharfHandlers()
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		channel    string
+		query      string
+		wantStatus int
+	}{
+		{name: "channel on a later upload", user: testAlice, channel: "linux", query: "target=alice/space-game", wantStatus: http.StatusOK},
+		{name: "missing channel", user: testAlice, channel: "beta", query: "target=alice/space-game", wantStatus: http.StatusNotFound},
+		{name: "channel lookup error", user: testAlice, channel: "flaky-channel", query: "target=alice/space-game", wantStatus: http.StatusInternalServerError},
+		{name: "game lookup error", user: testAdmin, channel: "linux", query: "game_id=30", wantStatus: http.StatusInternalServerError},
+		{name: "non-admin foreign namespace", user: testBob, channel: "linux", query: "target=alice/space-game", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/wharf/channels/"+tt.channel+"?"+tt.query, nil)
+			req = mux.SetURLVars(req, map[string]string{"channel": tt.channel})
+			req = req.WithContext(auth.SetUser(req.Context(), tt.user))
+			rec := httptest.NewRecorder()
+
+			h.GetChannel(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestChannelProtectionAdminOnly(t *testing.T) {
+	h := newTestWharfHandlers()
+
+	tests := []struct {
+		name       string
+		method     string
+		user       *models.User
+		wantStatus int
+	}{
+		{name: "owner sets", method: "PUT", user: testAlice, wantStatus: http.StatusForbidden},
+		{name: "owner removes", method: "DELETE", user: testAlice, wantStatus: http.StatusForbidden},
+		{name: "admin sets", method: "PUT", user: testAdmin, wantStatus: http.StatusOK},
+		{name: "admin removes", method: "DELETE", user: testAdmin, wantStatus: http.StatusOK},
+		{name: "non-admin foreign namespace", method: "PUT", user: testBob, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/wharf/channels/linux/protection?target=alice/space-game", strings.NewReader(`{"restrict_push": true}`))
+			req = mux.SetURLVars(req, map[string]string{"channel": "linux"})
+			req = req.WithContext(auth.SetUser(req.Context(), tt.user))
+			rec := httptest.NewRecorder()
+
+			if tt.method == "PUT" {
+				h.SetChannelProtection(rec, req)
+			} else {
+				h.DeleteChannelProtection(rec, req)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
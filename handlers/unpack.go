@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"butler-server/wharf"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// SetUnpackBuilds enables unpacking every build into per-file objects once it completes
+func (h *WharfHandlers) SetUnpackBuilds(enabled bool) {
+	h.unpackBuilds = enabled
+}
+
+// contentPath returns the storage path of a file of an unpacked build
+func contentPath(buildID int64, filePath string) string {
+	return fmt.Sprintf("builds/%d/content/%s", buildID, filePath)
+}
+
+// storageFileWriter buffers a file on local disk and uploads it to storage when closed
+type storageFileWriter struct {
+	h          *WharfHandlers
+	objectName string
+	file       *os.File
+}
+
+func (h *WharfHandlers) newStorageFileWriter(objectName string) (*storageFileWriter, error) {
+	file, err := os.CreateTemp("", "unpack-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &storageFileWriter{h: h, objectName: objectName, file: file}, nil
+}
+
+func (s *storageFileWriter) Write(p []byte) (int, error) {
+	return s.file.Write(p)
+}
+
+func (s *storageFileWriter) Close() error {
+	defer os.Remove(s.file.Name())
+	defer s.file.Close()
+
+	size, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	_, err = s.h.minioClient.PutObject(context.Background(), s.h.bucketName, s.objectName, s.file, size, minio.PutObjectOptions{
+		ContentType: contentType(s.objectName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.objectName, err)
+	}
+	return nil
+}
+
+// contentType guesses the MIME type of a build file from its extension
+func contentType(filePath string) string {
+	if t := mime.TypeByExtension(path.Ext(filePath)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// unpackBuild extracts a completed build into one storage object per file by
+// applying its patch to the unpacked files of its parent, then archives those
+// files for downloads. Parents that aren't unpacked yet are unpacked first.
+func (h *WharfHandlers) unpackBuild(build *models.Build) error {
+	h.unpackMu.Lock()
+	defer h.unpackMu.Unlock()
+
+	// Another unpack may have finished while we were waiting
+	current, err := h.db.GetBuildByID(build.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get build %d: %w", build.ID, err)
+	}
+	if current.Unpacked {
+		build.Unpacked = true
+		return h.ensureArchive(build)
+	}
+
+	if err := h.unpackBuildLocked(build); err != nil {
+		return err
+	}
+	// The archive is made of the unpacked files, the patch and signature only describe them
+	return h.generateArchiveFile(build)
+}
+
+// ensureArchive generates the archive of an unpacked build unless it has one,
+// e.g. when generating it failed before
+func (h *WharfHandlers) ensureArchive(build *models.Build) error {
+	buildFiles, err := h.db.GetBuildFilesByBuildID(build.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get build files: %w", err)
+	}
+	if findBuildFile(buildFiles, "archive") != nil {
+		return nil
+	}
+	return h.generateArchiveFile(build)
+}
+
+func (h *WharfHandlers) unpackBuildLocked(build *models.Build) error {
+	if build.Unpacked {
+		return nil
+	}
+	if build.State != "completed" {
+		return fmt.Errorf("build %d is not completed (state: %s)", build.ID, build.State)
+	}
+
+	var parent *models.Build
+	if build.ParentBuildID != nil {
+		var err error
+		parent, err = h.db.GetBuildByID(*build.ParentBuildID)
+		if err != nil {
+			return fmt.Errorf("failed to get parent build %d: %w", *build.ParentBuildID, err)
+		}
+		if err := h.unpackBuildLocked(parent); err != nil {
+			return fmt.Errorf("failed to unpack parent build %d: %w", parent.ID, err)
+		}
+	}
+
+	buildFiles, err := h.db.GetBuildFilesByBuildID(build.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get build files: %w", err)
+	}
+	patchFile := findBuildFile(buildFiles, "patch")
+	if patchFile == nil {
+		return fmt.Errorf("build %d has no uploaded patch", build.ID)
+	}
+
+	object, err := h.openBuildFile(patchFile)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	patch, err := wharf.OpenPatch(object)
+	if err != nil {
+		return fmt.Errorf("failed to read patch: %w", err)
+	}
+	defer patch.Close()
+
+	if parent == nil && len(patch.Target.Files) > 0 {
+		return fmt.Errorf("build %d has no parent but its patch references %d old files", build.ID, len(patch.Target.Files))
+	}
+
+	fmt.Printf("Unpacking build %d (%d files)\n", build.ID, len(patch.Source.Files))
+
+	var opened []*minio.Object
+	defer func() {
+		for _, o := range opened {
+			o.Close()
+		}
+	}()
+
+	openTarget := func(index int64) (io.ReaderAt, error) {
+		objectName := contentPath(parent.ID, patch.Target.Files[index].Path)
+		o, err := h.minioClient.GetObject(context.Background(), h.bucketName, objectName, minio.GetObjectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", objectName, err)
+		}
+		opened = append(opened, o)
+		return o, nil
+	}
+
+	create := func(file *wharf.File) (io.WriteCloser, error) {
+		return h.newStorageFileWriter(contentPath(build.ID, file.Path))
+	}
+
+	if err := patch.Apply(openTarget, create); err != nil {
+		return err
+	}
+
+	build.Unpacked = true
+	if err := h.db.UpdateBuild(build); err != nil {
+		return fmt.Errorf("failed to mark build as unpacked: %w", err)
+	}
+
+	fmt.Printf("Unpacked build %d\n", build.ID)
+
+	// Executable headers can be read now that files are stored individually
+	if err := h.detectPlatforms(build); err != nil {
+		fmt.Printf("Warning: Failed to detect platforms for build %d: %v\n", build.ID, err)
+	}
+	return nil
+}
+
+// startUnpack unpacks a build in the background, unless it is being unpacked
+// already. Builds that can never be unpacked, such as optimized patches, are
+// remembered so that requests for them don't start over every time: the
+// earlier failure is returned instead, until the build completes again or is
+// unpacked through UnpackBuild. Other failures are retried by the next call.
+func (h *WharfHandlers) startUnpack(buildID int64) error {
+	h.unpackStateMu.Lock()
+	defer h.unpackStateMu.Unlock()
+
+	if err, failed := h.unpackFailures[buildID]; failed {
+		return err
+	}
+	if !h.unpacking[buildID] {
+		h.unpacking[buildID] = true
+		go h.unpackBuildInBackground(buildID)
+	}
+	return nil
+}
+
+// unpackBuildInBackground unpacks a build started by startUnpack, logging failures
+func (h *WharfHandlers) unpackBuildInBackground(buildID int64) {
+	build, err := h.db.GetBuildByID(buildID)
+	if err == nil {
+		err = h.unpackBuild(build)
+	}
+	if err != nil {
+		fmt.Printf("Warning: Failed to unpack build %d: %v\n", buildID, err)
+	}
+
+	h.unpackStateMu.Lock()
+	defer h.unpackStateMu.Unlock()
+	delete(h.unpacking, buildID)
+	h.setUnpackFailure(buildID, err)
+}
+
+// setUnpackFailure records the outcome of unpacking a build, nil on success.
+// Only failures retrying can't fix are kept. The caller holds unpackStateMu.
+func (h *WharfHandlers) setUnpackFailure(buildID int64, err error) {
+	if errors.Is(err, wharf.ErrBsdiffUnsupported) {
+		h.unpackFailures[buildID] = err
+	} else {
+		delete(h.unpackFailures, buildID)
+	}
+}
+
+// POST /wharf/builds/{id}/unpack - Unpack a completed build into per-file storage
+func (h *WharfHandlers) UnpackBuild(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	build, _, err := h.resolveBuild(user, mux.Vars(r)["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	if build.State != "completed" {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("build %d is not completed (state: %s)", build.ID, build.State))
+		return
+	}
+
+	// Retrying here replaces any failure remembered by startUnpack
+	err = h.unpackBuild(build)
+	h.unpackStateMu.Lock()
+	h.setUnpackFailure(build.ID, err)
+	h.unpackStateMu.Unlock()
+	if err != nil {
+		if errors.Is(err, wharf.ErrBsdiffUnsupported) {
+			writeErrors(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := map[string]interface{}{
+		"build": map[string]interface{}{
+			"id":       build.ID,
+			"state":    build.State,
+			"unpacked": build.Unpacked,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /builds/{id}/files/{path} - Serve a single file of an unpacked build
+func (h *WharfHandlers) GetBuildContentFile(w http.ResponseWriter, r *http.Request) {
+	buildID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid build id")
+		return
+	}
+
+	filePath := strings.TrimPrefix(path.Clean("/"+mux.Vars(r)["path"]), "/")
+	if filePath == "" {
+		writeErrors(w, http.StatusBadRequest, "missing file path")
+		return
+	}
+
+	build, err := viewableBuild(h.db, r, buildID)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	if !build.Unpacked {
+		writeErrors(w, http.StatusNotFound, "build is not unpacked")
+		return
+	}
+
+	h.serveContentFile(w, r, build.ID, filePath)
+}
+
+// serveContentFile streams a file of an unpacked build, with range and conditional request support
+func (h *WharfHandlers) serveContentFile(w http.ResponseWriter, r *http.Request, buildID int64, filePath string) {
+	object, err := h.minioClient.GetObject(r.Context(), h.bucketName, contentPath(buildID, filePath), minio.GetObjectOptions{})
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer object.Close()
+
+	stat, err := object.Stat()
+	if err != nil {
+		writeErrors(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType(filePath))
+	if stat.ETag != "" {
+		w.Header().Set("ETag", `"`+stat.ETag+`"`)
+	}
+	http.ServeContent(w, r, path.Base(filePath), stat.LastModified, object)
+}
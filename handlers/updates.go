@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"butler-server/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// updateCheckRequest is what a launcher polls the update check with
+type updateCheckRequest struct {
+	GameID         int64  `json:"game_id"`
+	UploadID       int64  `json:"upload_id"`
+	Channel        string `json:"channel"`
+	CurrentBuildID int64  `json:"current_build_id"`
+	InstallID      string `json:"install_id"` // stable per-install ID that places the client in staged rollouts
+}
+
+// parseUpdateCheckRequest reads the update check parameters from a JSON body or the query string
+func parseUpdateCheckRequest(r *http.Request) (*updateCheckRequest, error) {
+	req := &updateCheckRequest{}
+
+	if r.Method == http.MethodPost && strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("could not read request body")
+		}
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %s", err.Error())
+		}
+		return req, nil
+	}
+
+	query := r.URL.Query()
+	req.Channel = query.Get("channel")
+	req.InstallID = query.Get("install_id")
+	for name, target := range map[string]*int64{
+		"game_id":          &req.GameID,
+		"upload_id":        &req.UploadID,
+		"current_build_id": &req.CurrentBuildID,
+	} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s", name)
+			}
+			*target = parsed
+		}
+	}
+	return req, nil
+}
+
+// resolveUpdateChannel finds the channel a launcher follows from an upload id,
+// a game id and channel name, or both, checking that the requesting user may
+// see the game. An upload without a channel name follows the game's default
+// channel, or the channel with the newest completed build.
+func (h *WharfHandlers) resolveUpdateChannel(r *http.Request, req *updateCheckRequest) (*models.Channel, error) {
+	if req.UploadID != 0 {
+		upload, err := viewableUpload(h.db, r, req.UploadID)
+		if err != nil {
+			return nil, err
+		}
+		if req.Channel != "" {
+			channel, err := h.db.GetChannelByName(req.Channel, upload.ID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, &targetError{http.StatusNotFound, "channel not found"}
+			}
+			if err != nil {
+				return nil, err
+			}
+			return channel, nil
+		}
+		_, game, err := h.db.GetGameByID(upload.GameID)
+		if err != nil {
+			return nil, err
+		}
+		// A channel whose head is still being pushed counts with its previous head
+		channel, _, err := findChannelHead(h.db, upload, game.DefaultChannel)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			return nil, &targetError{http.StatusNotFound, "upload has no completed build"}
+		}
+		return channel, nil
+	}
+
+	if req.Channel == "" || req.GameID == 0 {
+		return nil, &targetError{http.StatusBadRequest, "need upload_id, or game_id and channel"}
+	}
+	if _, _, err := viewableGame(h.db, r, req.GameID); err != nil {
+		return nil, err
+	}
+	channel, _, err := h.findGameChannel(req.GameID, req.Channel)
+	if err != nil {
+		if errors.Is(err, errChannelNotFound) {
+			return nil, &targetError{http.StatusNotFound, err.Error()}
+		}
+		return nil, err
+	}
+	return channel, nil
+}
+
+// buildFileDownload formats a build file for download instructions
+func buildFileDownload(file *models.BuildFile) map[string]interface{} {
+	return map[string]interface{}{
+		"build_id":     file.BuildID,
+		"file_id":      file.ID,
+		"type":         file.Type,
+		"size":         file.Size,
+		"download_url": fmt.Sprintf("/builds/%d/downloads/%d", file.BuildID, file.ID),
+	}
+}
+
+// GET|POST /updates/check - Tell a launcher whether a newer build is available and how to get it
+func (h *WharfHandlers) CheckForUpdate(w http.ResponseWriter, r *http.Request) {
+	req, err := parseUpdateCheckRequest(r)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	channel, err := h.resolveUpdateChannel(r, req)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	// Installs already running the rollout candidate keep it, even once the
+	// rollout no longer covers them
+	headID := channel.HeadForInstall(req.InstallID)
+	if channel.CandidateBuildID != nil && *channel.CandidateBuildID == req.CurrentBuildID {
+		headID = channel.CandidateBuildID
+	}
+
+	if headID == nil {
+		writeErrors(w, http.StatusNotFound, fmt.Sprintf("channel '%s' has no build", channel.Name))
+		return
+	}
+
+	head, err := h.db.GetBuildByID(*headID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// A head still being pushed, or whose push failed, has no files to offer yet
+	if head.State != "completed" {
+		head, err = lastCompletedHead(h.db, channel)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if head == nil {
+			writeErrors(w, http.StatusNotFound, fmt.Sprintf("channel '%s' has no completed build", channel.Name))
+			return
+		}
+	}
+
+	buildData := map[string]interface{}{
+		"id":           head.ID,
+		"user_version": head.UserVersion,
+		"created_at":   head.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if channel.CandidateBuildID != nil && *channel.CandidateBuildID == head.ID {
+		buildData["rollout_candidate"] = true
+	}
+	if head.ReleaseNotes != "" {
+		buildData["release_notes"] = head.ReleaseNotes
+	}
+
+	response := map[string]interface{}{
+		"channel":   channel.Name,
+		"upload_id": channel.UploadID,
+		"build":     buildData,
+	}
+
+	if req.CurrentBuildID == head.ID {
+		response["status"] = "up_to_date"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response["status"] = "update_available"
+
+	// Prefer patching when the installed build is an ancestor of the head
+	// and the patches are smaller than downloading everything again
+	var patches []*models.BuildFile
+	if req.CurrentBuildID != 0 {
+		current, err := h.db.GetBuildByID(req.CurrentBuildID)
+		if err == nil && current.UploadID == head.UploadID {
+			patches, err = h.patchChain(current, head)
+			if err != nil {
+				writeErrors(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+	}
+
+	// Release notes of everything the player gets since the build they have
+	if req.CurrentBuildID != 0 {
+		changelog, found, err := h.buildChangelog(head, req.CurrentBuildID, 0)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if found {
+			response["changelog"] = changelog
+		}
+	}
+
+	fullSize, err := h.fullDownloadSize(head)
+	if err != nil {
+		fmt.Printf("Warning: could not determine full size of build %d: %v\n", head.ID, err)
+		fullSize = -1
+	}
+
+	var patchSize int64
+	for _, patch := range patches {
+		patchSize += patch.Size
+	}
+
+	if len(patches) > 0 && (fullSize < 0 || patchSize < fullSize) {
+		var steps []map[string]interface{}
+		for _, patch := range patches {
+			steps = append(steps, buildFileDownload(patch))
+		}
+		response["update"] = map[string]interface{}{
+			"method":    "patch",
+			"size":      patchSize,
+			"full_size": fullSize,
+			"patches":   steps,
+		}
+	} else {
+		buildFiles, err := h.db.GetBuildFilesByBuildID(head.ID)
+		if err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		files := []map[string]interface{}{}
+		for _, file := range buildFiles {
+			if file.State == "uploaded" && file.Type != "patch" {
+				files = append(files, buildFileDownload(file))
+			}
+		}
+		response["update"] = map[string]interface{}{
+			"method": "full",
+			"size":   fullSize,
+			"files":  files,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
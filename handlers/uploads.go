@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/minio/minio-go/v7"
+)
+
+// downloadURLExpiry is how long the signed URLs handed out by GET /uploads/{id}/download stay valid
+const downloadURLExpiry = 15 * time.Minute
+
+// uploadResponse formats an upload for API responses, like GET /uploads/{id}
+func uploadResponse(upload *models.Upload) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               upload.ID,
+		"filename":         upload.Filename,
+		"display_name":     upload.DisplayName,
+		"size":             upload.Size,
+		"storage":          upload.Storage,
+		"type":             upload.Type,
+		"platforms":        upload.Platforms,
+		"architectures":    upload.Architectures,
+		"platforms_locked": upload.PlatformsLocked,
+	}
+}
+
+// validateUpload checks the editable fields of an upload
+func validateUpload(upload *models.Upload) error {
+	if upload.Filename == "" {
+		return fmt.Errorf("missing filename")
+	}
+	if len(upload.Filename) > 255 || len(upload.DisplayName) > 255 {
+		return fmt.Errorf("filename and display_name may be at most 255 characters")
+	}
+	if strings.ContainsAny(upload.Filename, `/\`) {
+		return fmt.Errorf("filename may not contain slashes")
+	}
+
+	valid := false
+	for _, uploadType := range models.UploadTypes {
+		if upload.Type == uploadType {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("invalid type '%s', expected one of %s", upload.Type, strings.Join(models.UploadTypes, ", "))
+	}
+
+	return models.ValidatePlatforms(upload.Platforms, upload.Architectures)
+}
+
+// POST /wharf/uploads - Create an upload for a game. Giving platforms or
+// architectures locks them, so processing won't replace them.
+func (h *WharfHandlers) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Target        string   `json:"target"`
+		GameID        int64    `json:"game_id"`
+		Filename      string   `json:"filename"`
+		DisplayName   string   `json:"display_name"`
+		Type          string   `json:"type"`
+		Platforms     []string `json:"platforms"`
+		Architectures []string `json:"architectures"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	var gameIDStr string
+	if req.GameID != 0 {
+		gameIDStr = strconv.FormatInt(req.GameID, 10)
+	}
+
+	bt, err := h.resolveTarget(user, req.Target, gameIDStr, false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	// Same defaults as uploads created by a push
+	upload := &models.Upload{
+		GameID:          game.ID,
+		Filename:        req.Filename,
+		DisplayName:     req.DisplayName,
+		Storage:         "hosted",
+		Type:            req.Type,
+		Platforms:       req.Platforms,
+		Architectures:   req.Architectures,
+		PlatformsLocked: req.Platforms != nil || req.Architectures != nil,
+	}
+	if upload.Filename == "" {
+		upload.Filename = fmt.Sprintf("%s.zip", game.Title)
+	}
+	if upload.DisplayName == "" {
+		upload.DisplayName = game.Title
+	}
+	if upload.Type == "" {
+		upload.Type = "default"
+	}
+	if upload.Platforms == nil {
+		upload.Platforms = []string{}
+	}
+	if upload.Architectures == nil {
+		upload.Architectures = []string{}
+	}
+	sort.Strings(upload.Platforms)
+	sort.Strings(upload.Architectures)
+
+	if err := validateUpload(upload); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.db.CreateUpload(upload); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s created upload %d '%s' for game %d\n", user.Username, upload.ID, upload.DisplayName, game.ID)
+
+	response := map[string]interface{}{
+		"upload": uploadResponse(upload),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PATCH /wharf/uploads/{id} - Rename or retype an upload, or set its platforms.
+// Fields left out keep their value. Setting platforms or architectures locks
+// them; "platforms_locked": false hands them back to detection.
+func (h *WharfHandlers) UpdateUpload(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Filename        *string   `json:"filename"`
+		DisplayName     *string   `json:"display_name"`
+		Type            *string   `json:"type"`
+		Platforms       *[]string `json:"platforms"`
+		Architectures   *[]string `json:"architectures"`
+		PlatformsLocked *bool     `json:"platforms_locked"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	upload, _, err := h.resolveUpload(user, mux.Vars(r)["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	if req.Filename != nil {
+		upload.Filename = strings.TrimSpace(*req.Filename)
+	}
+	if req.DisplayName != nil {
+		upload.DisplayName = *req.DisplayName
+	}
+	if req.Type != nil {
+		upload.Type = *req.Type
+	}
+	if req.Platforms != nil {
+		upload.Platforms = *req.Platforms
+		upload.PlatformsLocked = true
+	}
+	if req.Architectures != nil {
+		upload.Architectures = *req.Architectures
+		upload.PlatformsLocked = true
+	}
+	if req.PlatformsLocked != nil {
+		upload.PlatformsLocked = *req.PlatformsLocked
+	}
+	if upload.Platforms == nil {
+		upload.Platforms = []string{}
+	}
+	if upload.Architectures == nil {
+		upload.Architectures = []string{}
+	}
+	sort.Strings(upload.Platforms)
+	sort.Strings(upload.Architectures)
+
+	if err := validateUpload(upload); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.db.UpdateUpload(upload); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s updated upload %d '%s'\n", user.Username, upload.ID, upload.DisplayName)
+
+	response := map[string]interface{}{
+		"upload": uploadResponse(upload),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /uploads/{id}/download - Get a short-lived signed URL for the archive of the
+// upload's current build. Takes the last completed head of ?channel= if given,
+// otherwise of the game's default channel or the channel with the newest one.
+func (h *WharfHandlers) GetUploadDownload(w http.ResponseWriter, r *http.Request) {
+	uploadID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, "invalid upload id")
+		return
+	}
+
+	upload, err := viewableUpload(h.db, r, uploadID)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	_, game, err := h.db.GetGameByID(upload.GameID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Only completed builds are downloadable; while a push is in progress the
+	// channel's previous completed head is served
+	channelName := r.URL.Query().Get("channel")
+	channel, head, err := uploadChannelHead(h.db, upload, channelName, game.DefaultChannel)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if head == nil {
+		if channelName != "" {
+			writeErrors(w, http.StatusNotFound, fmt.Sprintf("channel '%s' of upload %d has no downloadable build", channelName, upload.ID))
+			return
+		}
+		writeErrors(w, http.StatusNotFound, "upload has no downloadable build")
+		return
+	}
+
+	buildFiles, err := h.db.GetBuildFilesByBuildID(head.ID)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var archive *models.BuildFile
+	for _, file := range buildFiles {
+		if file.Type == "archive" && file.SubType == "default" && file.State == "uploaded" {
+			archive = file
+			break
+		}
+	}
+	// Archives are made of the unpacked files, so builds that aren't unpacked yet
+	// are unpacked now, the client is asked to come back once that's done
+	if archive == nil || !head.Unpacked {
+		if err := h.startUnpack(head.ID); err != nil {
+			writeErrors(w, http.StatusUnprocessableEntity, fmt.Sprintf("build %d can't be archived: %v", head.ID, err))
+			return
+		}
+		w.Header().Set("Retry-After", "10")
+		writeErrors(w, http.StatusServiceUnavailable, fmt.Sprintf("the archive of build %d is being prepared, try again shortly", head.ID))
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := h.minioClient.StatObject(ctx, h.bucketName, archive.StoragePath, minio.StatObjectOptions{}); err != nil {
+		writeErrors(w, http.StatusNotFound, "archive not found in storage")
+		return
+	}
+
+	// Name the download after the upload rather than the storage path
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", upload.Filename))
+
+	signedURL, err := h.minioClient.PresignedGetObject(ctx, h.bucketName, archive.StoragePath, downloadURLExpiry, params)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, "could not generate download URL")
+		return
+	}
+
+	response := map[string]interface{}{
+		"url":        signedURL.String(),
+		"expires_at": time.Now().Add(downloadURLExpiry).UTC().Format("2006-01-02T15:04:05Z"),
+		"channel":    channel.Name,
+		"build": map[string]interface{}{
+			"id":           head.ID,
+			"user_version": head.UserVersion,
+		},
+		"file": map[string]interface{}{
+			"id":   archive.ID,
+			"size": archive.Size,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DELETE /wharf/uploads/{id} - Delete an upload with its channels, builds and stored files,
+// unless channels of other uploads still use its builds
+func (h *WharfHandlers) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	upload, _, err := h.resolveUpload(user, mux.Vars(r)["id"])
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+
+	// Promotions can put builds of this upload on channels of other uploads
+	users, err := h.channelsUsingUpload(upload)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(users) > 0 {
+		writeErrors(w, http.StatusConflict, fmt.Sprintf("builds of upload %d are used by channels %s, move them to other builds first", upload.ID, strings.Join(users, ", ")))
+		return
+	}
+
+	if err := h.deleteUploadContents(upload); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := h.db.DeleteUpload(upload.ID); err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s deleted upload %d '%s' of game %d\n", user.Username, upload.ID, upload.DisplayName, upload.GameID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// channelsUsingUpload returns the names of channels on other uploads of the
+// game whose head, rollout candidate or pending scheduled release is a build of
+// the upload or builds upon one
+func (h *WharfHandlers) channelsUsingUpload(upload *models.Upload) ([]string, error) {
+	builds, err := h.db.GetBuildsByUploadID(upload.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get builds: %w", err)
+	}
+	own := make(map[int64]bool, len(builds))
+	for _, build := range builds {
+		own[build.ID] = true
+	}
+
+	releases, err := h.db.GetPendingScheduledReleases()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled releases: %w", err)
+	}
+
+	uploads, err := h.db.GetUploadsByGameID(upload.GameID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploads: %w", err)
+	}
+
+	var names []string
+	for _, other := range uploads {
+		if other.ID == upload.ID {
+			continue
+		}
+		channels, err := h.db.GetChannelsByUploadID(other.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get channels: %w", err)
+		}
+		for _, channel := range channels {
+			var served []int64
+			if channel.CurrentBuildID != nil {
+				served = append(served, *channel.CurrentBuildID)
+			}
+			if channel.CandidateBuildID != nil {
+				served = append(served, *channel.CandidateBuildID)
+			}
+			for _, release := range releases {
+				if release.ChannelID == channel.ID {
+					served = append(served, release.BuildID)
+				}
+			}
+
+			for buildID := range h.withAncestors(served) {
+				if own[buildID] {
+					names = append(names, channel.Name)
+					break
+				}
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// PUT /wharf/channels/{channel}/upload - Bind a channel to an upload, so pushes to it
+// go there. A channel that doesn't exist yet is created without a head.
+func (h *WharfHandlers) BindChannelUpload(w http.ResponseWriter, r *http.Request) {
+	channelName := mux.Vars(r)["channel"]
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		UploadID int64 `json:"upload_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if req.UploadID == 0 {
+		writeErrors(w, http.StatusBadRequest, "missing upload_id")
+		return
+	}
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	upload, err := h.db.GetUploadByID(req.UploadID)
+	if err != nil || upload.GameID != game.ID {
+		writeErrors(w, http.StatusNotFound, "upload not found")
+		return
+	}
+
+	channel, _, err := h.findGameChannel(game.ID, channelName)
+	if err != nil && !errors.Is(err, errChannelNotFound) {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if channel == nil {
+		channel = &models.Channel{
+			Name:     channelName,
+			UploadID: upload.ID,
+		}
+		err = h.db.CreateChannel(channel)
+	} else if channel.UploadID != upload.ID {
+		// The builds of a channel belong to its upload, so only empty channels can move
+		releases, releasesErr := h.db.GetScheduledReleasesByChannelID(channel.ID)
+		if releasesErr != nil {
+			writeErrors(w, http.StatusInternalServerError, releasesErr.Error())
+			return
+		}
+		pending := false
+		for _, release := range releases {
+			if release.State == models.ReleaseStatePending {
+				pending = true
+			}
+		}
+		if channel.CurrentBuildID != nil || channel.CandidateBuildID != nil || pending {
+			writeErrors(w, http.StatusConflict, fmt.Sprintf("channel '%s' already has builds on upload %d, only channels without builds can be bound to another upload", channel.Name, channel.UploadID))
+			return
+		}
+
+		channel.UploadID = upload.ID
+		err = h.db.UpdateChannel(channel)
+	}
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s bound channel %s to upload %d\n", user.Username, channel.Name, upload.ID)
+
+	response := map[string]interface{}{
+		"channel": map[string]interface{}{
+			"name":   channel.Name,
+			"upload": uploadResponse(upload),
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
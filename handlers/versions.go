@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// checkVersionPolicy checks that making a build with userVersion the head of
+// a channel keeps the game's version policy, comparing with the builds the
+// channel held before. buildID is the build taking over, 0 for a new push;
+// a build coming back to a channel isn't a duplicate of itself. channel is
+// nil when the build creates it.
+func (h *WharfHandlers) checkVersionPolicy(game *models.Game, channelName string, channel *models.Channel, userVersion string, buildID int64) error {
+	if game.VersionPolicy == models.VersionPolicyNone {
+		return nil
+	}
+
+	var head *models.Build
+	var channelBuilds []*models.Build
+	if channel != nil {
+		if channel.CurrentBuildID != nil {
+			if *channel.CurrentBuildID == buildID {
+				return nil
+			}
+			var err error
+			head, err = h.db.GetBuildByID(*channel.CurrentBuildID)
+			if err != nil {
+				return &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to get head build: %v", err)}
+			}
+		}
+
+		ids, err := channelBuildIDs(h.db, channel)
+		if err != nil {
+			return &targetError{http.StatusInternalServerError, fmt.Sprintf("failed to get channel history: %v", err)}
+		}
+		for _, id := range ids {
+			if id == buildID {
+				continue
+			}
+			// Builds deleted since have nothing to compare with
+			if build, err := h.db.GetBuildByID(id); err == nil {
+				channelBuilds = append(channelBuilds, build)
+			}
+		}
+	}
+
+	if err := models.CheckVersionPolicy(game.VersionPolicy, channelName, userVersion, head, channelBuilds); err != nil {
+		return &targetError{http.StatusBadRequest, err.Error()}
+	}
+	return nil
+}
+
+// GET /wharf/version-policy - Get the user_version policy of a game
+func (h *WharfHandlers) GetVersionPolicy(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	response := map[string]interface{}{
+		"game_id":        game.ID,
+		"version_policy": game.VersionPolicy,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /wharf/version-policy - Set the user_version policy of a game
+func (h *WharfHandlers) SetVersionPolicy(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		VersionPolicy string `json:"version_policy"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if !models.ValidVersionPolicy(req.VersionPolicy) {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid version_policy '%s', expected '', '%s' or '%s'",
+			req.VersionPolicy, models.VersionPolicyUnique, models.VersionPolicyMonotonic))
+		return
+	}
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	err = h.db.SetGameVersionPolicy(game.ID, req.VersionPolicy)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s set version policy of game %d to '%s'\n", user.Username, game.ID, req.VersionPolicy)
+
+	response := map[string]interface{}{
+		"game_id":        game.ID,
+		"version_policy": req.VersionPolicy,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"net/http"
+)
+
+// requestUser returns the user of a request under OptionalAuthMiddleware, or nil if anonymous
+func requestUser(r *http.Request) *models.User {
+	user, _ := auth.GetUser(r.Context())
+	return user
+}
+
+// viewableGame looks up a game for a read endpoint. Games the requesting user
+// may not see are reported as missing, so private games can't be probed by id.
+func viewableGame(db models.Database, r *http.Request, gameID int64) (*models.User, *models.Game, error) {
+	owner, game, err := db.GetGameByID(gameID)
+	if err != nil || !game.VisibleTo(requestUser(r)) {
+		return nil, nil, &targetError{http.StatusNotFound, "game not found"}
+	}
+	return owner, game, nil
+}
+
+// viewableUpload looks up an upload for a read endpoint, checking that the
+// requesting user may see its game
+func viewableUpload(db models.Database, r *http.Request, uploadID int64) (*models.Upload, error) {
+	upload, err := db.GetUploadByID(uploadID)
+	if err != nil {
+		return nil, &targetError{http.StatusNotFound, "upload not found"}
+	}
+	if _, _, err := viewableGame(db, r, upload.GameID); err != nil {
+		return nil, &targetError{http.StatusNotFound, "upload not found"}
+	}
+	return upload, nil
+}
+
+// viewableBuild looks up a build for a read endpoint, checking that the
+// requesting user may see its game
+func viewableBuild(db models.Database, r *http.Request, buildID int64) (*models.Build, error) {
+	build, err := db.GetBuildByID(buildID)
+	if err != nil {
+		return nil, &targetError{http.StatusNotFound, "build not found"}
+	}
+	if _, err := viewableUpload(db, r, build.UploadID); err != nil {
+		return nil, &targetError{http.StatusNotFound, "build not found"}
+	}
+	return build, nil
+}
+
+// managesUpload reports whether the requesting user owns the game of an upload
+// or is an admin. Details such as build metadata are only shown to them, even
+// on public games.
+func managesUpload(db models.Database, r *http.Request, uploadID int64) bool {
+	user := requestUser(r)
+	if user == nil {
+		return false
+	}
+	if user.IsAdmin() {
+		return true
+	}
+	upload, err := db.GetUploadByID(uploadID)
+	if err != nil {
+		return false
+	}
+	_, game, err := db.GetGameByID(upload.GameID)
+	return err == nil && game.UserID == user.ID
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"butler-server/auth"
+	"butler-server/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// isHTMLGameBuild reports whether a build belongs to an html game
+func (h *WharfHandlers) isHTMLGameBuild(build *models.Build) bool {
+	upload, err := h.db.GetUploadByID(build.UploadID)
+	if err != nil {
+		return false
+	}
+	_, game, err := h.db.GetGameByID(upload.GameID)
+	if err != nil {
+		return false
+	}
+	return game.Type == models.GameTypeHTML
+}
+
+// GET /wharf/web - Get the web game settings of a game
+func (h *WharfHandlers) GetWebSettings(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	response := map[string]interface{}{
+		"game_id":     game.ID,
+		"type":        game.Type,
+		"web_channel": game.WebChannel,
+		"play_url":    fmt.Sprintf("/play/%d/", game.ID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// PUT /wharf/web - Set the game type and the channel served as the web game
+func (h *WharfHandlers) SetWebSettings(w http.ResponseWriter, r *http.Request) {
+	user := auth.MustGetUser(r.Context())
+
+	var req struct {
+		Type       string `json:"type"`
+		WebChannel string `json:"web_channel"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err.Error()))
+		return
+	}
+
+	if req.Type != models.GameTypeDefault && req.Type != models.GameTypeHTML {
+		writeErrors(w, http.StatusBadRequest, fmt.Sprintf("invalid type '%s', expected '%s' or '%s'",
+			req.Type, models.GameTypeDefault, models.GameTypeHTML))
+		return
+	}
+
+	if req.WebChannel == "" {
+		req.WebChannel = "web"
+	}
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	game := bt.Game
+
+	err = h.db.SetGameWebSettings(game.ID, req.Type, req.WebChannel)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	fmt.Printf("User %s set game %d to type '%s' with web channel '%s'\n", user.Username, game.ID, req.Type, req.WebChannel)
+
+	response := map[string]interface{}{
+		"game_id":     game.ID,
+		"type":        req.Type,
+		"web_channel": req.WebChannel,
+		"play_url":    fmt.Sprintf("/play/%d/", game.ID),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GET /play/{id}/{path} - Serve the head build of an html game's web channel as a static site
+func (h *WharfHandlers) PlayGame(w http.ResponseWriter, r *http.Request) {
+	gameID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Relative asset paths in index.html need the trailing slash
+	if !strings.HasPrefix(r.URL.Path, fmt.Sprintf("/play/%d/", gameID)) {
+		http.Redirect(w, r, fmt.Sprintf("/play/%d/", gameID), http.StatusMovedPermanently)
+		return
+	}
+
+	_, game, err := viewableGame(h.db, r, gameID)
+	if err != nil || game.Type != models.GameTypeHTML {
+		http.NotFound(w, r)
+		return
+	}
+
+	channel, _, err := h.findGameChannel(game.ID, game.WebChannel)
+	if err != nil {
+		if errors.Is(err, errChannelNotFound) {
+			http.Error(w, fmt.Sprintf("Nothing has been pushed to the '%s' channel yet", game.WebChannel), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if channel.CurrentBuildID == nil {
+		http.Error(w, fmt.Sprintf("The '%s' channel has no build", game.WebChannel), http.StatusNotFound)
+		return
+	}
+
+	build, err := h.db.GetBuildByID(*channel.CurrentBuildID)
+	if err != nil {
+		http.Error(w, "build not found", http.StatusNotFound)
+		return
+	}
+
+	// Heads move at the start of a push, its files aren't there yet
+	if build.State != "completed" {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "This build is still being pushed, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !build.Unpacked {
+		// Builds promoted from before the game was html may not be unpacked yet
+		if err := h.startUnpack(build.ID); err != nil {
+			http.Error(w, "This build could not be prepared for playing", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "This build is being prepared, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+
+	filePath := strings.TrimPrefix(path.Clean("/"+mux.Vars(r)["path"]), "/")
+	if filePath == "" || strings.HasSuffix(r.URL.Path, "/") {
+		filePath = path.Join(filePath, "index.html")
+	}
+
+	// Entry pages must be revalidated so a new push shows up right away;
+	// assets may be cached briefly and are revalidated by ETag afterwards
+	if path.Ext(filePath) == ".html" {
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	}
+	w.Header().Set("X-Build-Id", strconv.FormatInt(build.ID, 10))
+
+	h.serveContentFile(w, r, build.ID, filePath)
+}
@@ -5,14 +5,16 @@ import (
 	"butler-server/auth"
 	"butler-server/models"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,14 +30,86 @@ func (h *WharfHandlers) validateNamespaceAccess(user *models.User, namespace str
 	return nil
 }
 
+// writeErrors writes a wharf-style {"errors":[...]} response, escaping messages properly
+func writeErrors(w http.ResponseWriter, status int, messages ...string) {
+	body, err := json.Marshal(map[string]interface{}{"errors": messages})
+	if err != nil {
+		body = []byte(`{"errors":["internal error"]}`)
+	}
+	http.Error(w, string(body), status)
+}
+
+// errChannelNotFound is returned by findGameChannel when no upload has the channel
+var errChannelNotFound = errors.New("channel not found")
+
+// findGameChannel looks up a channel by name across all uploads of a game
+func (h *WharfHandlers) findGameChannel(gameID int64, channelName string) (*models.Channel, *models.Upload, error) {
+	uploads, err := h.db.GetUploadsByGameID(gameID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get uploads: %w", err)
+	}
+
+	for _, upload := range uploads {
+		channel, err := h.db.GetChannelByName(channelName, upload.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get channel %s: %w", channelName, err)
+		}
+		return channel, upload, nil
+	}
+
+	return nil, nil, errChannelNotFound
+}
+
+// findTargetChannel resolves the target game of a request and its channel
+// named in the URL, writing the error response itself when it fails
+func (h *WharfHandlers) findTargetChannel(w http.ResponseWriter, r *http.Request) (*models.User, *models.Game, *models.Channel, bool) {
+	channelName := mux.Vars(r)["channel"]
+	user := auth.MustGetUser(r.Context())
+
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
+	if err != nil {
+		writeTargetError(w, err)
+		return nil, nil, nil, false
+	}
+
+	channel, _, err := h.findGameChannel(bt.Game.ID, channelName)
+	if err != nil {
+		if errors.Is(err, errChannelNotFound) {
+			writeErrors(w, http.StatusNotFound, err.Error())
+			return nil, nil, nil, false
+		}
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return nil, nil, nil, false
+	}
+
+	return user, bt.Game, channel, true
+}
+
 type WharfHandlers struct {
 	db          models.Database
 	minioClient *minio.Client
 	bucketName  string
+
+	unpackBuilds bool       // unpack every build once it completes
+	unpackMu     sync.Mutex // serializes unpacking so parents aren't unpacked twice
+
+	// Background unpacks, see startUnpack
+	unpackStateMu  sync.Mutex
+	unpacking      map[int64]bool  // builds being unpacked in the background
+	unpackFailures map[int64]error // builds that can't be unpacked
 }
 
 func NewWharfHandlers(db models.Database, minioClient *minio.Client, bucketName string) *WharfHandlers {
-	return &WharfHandlers{db: db, minioClient: minioClient, bucketName: bucketName}
+	return &WharfHandlers{
+		db:             db,
+		minioClient:    minioClient,
+		bucketName:     bucketName,
+		unpacking:      map[int64]bool{},
+		unpackFailures: map[int64]error{},
+	}
 }
 
 // MinIO helper methods
@@ -84,100 +158,99 @@ func (h *WharfHandlers) GetWharfStatus(w http.ResponseWriter, r *http.Request) {
 
 // GET /wharf/channels - List all channels for a target
 func (h *WharfHandlers) ListChannels(w http.ResponseWriter, r *http.Request) {
-	target := r.URL.Query().Get("target")
-
-	if target == "" {
-		http.Error(w, `{"errors":["missing build target (need game_id or target)"]}`, http.StatusBadRequest)
-		return
-	}
-
-	// Parse target format: "username/gamename"
-	parts := strings.Split(target, "/")
-	if len(parts) != 2 {
-		http.Error(w, `{"errors":["invalid target format, expected username/gamename"]}`, http.StatusBadRequest)
-		return
-	}
-
-	username := parts[0]
-	gamename := parts[1]
-
 	// Get user from context (set by auth middleware)
 	user := auth.MustGetUser(r.Context())
 
-	// Validate namespace access
-	err := h.validateNamespaceAccess(user, username)
+	bt, err := h.resolveTarget(user, r.URL.Query().Get("target"), r.URL.Query().Get("game_id"), false)
 	if err != nil {
-		fmt.Printf("Namespace access denied: %v\n", err)
-		http.Error(w, `{"errors":["access denied"]}`, http.StatusForbidden)
+		writeTargetError(w, err)
 		return
 	}
+	game := bt.Game
 
-	// Note: User and namespace validation already done above
-
-	// Find the game
-	game, err := h.db.GetGameByUserAndTitle(user.ID, gamename)
+	// Butler expects every channel, so channels are only paged when ?limit= is given
+	page, err := parseListPage(r, []string{"name", "id", "created_at"}, "name", 0)
 	if err != nil {
-		http.Error(w, `{"errors":["game not found"]}`, http.StatusNotFound)
+		writeErrors(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Get all uploads for this game
-	uploads, err := h.db.GetUploadsByGameID(game.ID)
+	gameChannels, err := h.db.ListChannelsByGameID(game.ID, page.fetchOptions())
 	if err != nil {
-		http.Error(w, `{"errors":["failed to get uploads"]}`, http.StatusInternalServerError)
+		writeErrors(w, http.StatusInternalServerError, "failed to get channels")
 		return
 	}
+	n, more := page.trim(len(gameChannels))
+	gameChannels = gameChannels[:n]
+
+	// Installs taking part in a staged rollout see the candidate as the head
+	installID := r.URL.Query().Get("install_id")
 
-	// Build channels response
+	// Build channels response. The map is keyed by name, so order lists the
+	// names in the requested sort order.
 	channels := make(map[string]interface{})
+	order := []string{}
 
-	for _, upload := range uploads {
-		// Get actual channels for this upload from the channels table
-		uploadChannels, err := h.db.GetChannelsByUploadID(upload.ID)
-		if err != nil {
-			continue // Skip this upload if we can't get channels
+	for _, channel := range gameChannels {
+		var currentBuild *models.Build
+		if headID := channel.HeadForInstall(installID); headID != nil {
+			// Get the current build from the channel
+			currentBuild, err = h.db.GetBuildByID(*headID)
+			if err != nil {
+				continue // Skip this channel if we can't get the build
+			}
+		}
+
+		channelData := map[string]interface{}{
+			"name": channel.Name,
+			"upload": map[string]interface{}{
+				"id": channel.UploadID,
+			},
 		}
 
-		for _, channel := range uploadChannels {
-			var currentBuild *models.Build
-			if channel.CurrentBuildID != nil {
-				// Get the current build from the channel
-				currentBuild, err = h.db.GetBuildByID(*channel.CurrentBuildID)
-				if err != nil {
-					continue // Skip this channel if we can't get the build
-				}
+		if currentBuild != nil {
+			buildData := map[string]interface{}{
+				"id":    currentBuild.ID,
+				"state": currentBuild.State,
+			}
+
+			if currentBuild.UserVersion != "" {
+				buildData["user_version"] = currentBuild.UserVersion
 			}
 
-			channelData := map[string]interface{}{
-				"name": channel.Name,
-				"upload": map[string]interface{}{
-					"id": upload.ID,
-				},
+			if currentBuild.ParentBuildID != nil {
+				buildData["parent_build_id"] = *currentBuild.ParentBuildID
 			}
 
-			if currentBuild != nil {
-				buildData := map[string]interface{}{
-					"id":    currentBuild.ID,
-					"state": currentBuild.State,
-				}
+			channelData["head"] = buildData
+		}
 
-				if currentBuild.UserVersion != "" {
-					buildData["user_version"] = currentBuild.UserVersion
-				}
+		if channel.CandidateBuildID != nil {
+			channelData["rollout"] = channelRolloutData(channel)
+		}
 
-				if currentBuild.ParentBuildID != nil {
-					buildData["parent_build_id"] = *currentBuild.ParentBuildID
-				}
+		if channel.ExpiresAt != nil {
+			channelData["expires_at"] = channel.ExpiresAt
+		}
 
-				channelData["head"] = buildData
-			}
+		channels[channel.Name] = channelData
+		order = append(order, channel.Name)
+	}
 
-			channels[channel.Name] = channelData
+	var next string
+	if more {
+		last := gameChannels[n-1]
+		value := last.Name
+		if page.options.Sort == "created_at" {
+			value = cursorTime(last.CreatedAt)
 		}
+		next = page.cursorAfter(value, last.ID)
 	}
 
 	response := map[string]interface{}{
-		"channels": channels,
+		"channels":   channels,
+		"order":      order,
+		"pagination": page.response(next, map[string]string{}),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -186,106 +259,21 @@ func (h *WharfHandlers) ListChannels(w http.ResponseWriter, r *http.Request) {
 
 // GET /wharf/channels/{channel} - Get channel information
 func (h *WharfHandlers) GetChannel(w http.ResponseWriter, r *http.Request) {
-	channelName := mux.Vars(r)["channel"]
-	target := r.URL.Query().Get("target")
-
-	if target == "" {
-		http.Error(w, `{"errors":["missing build target (need game_id or target)"]}`, http.StatusBadRequest)
-		return
-	}
-
-	// Parse target format: "username/gamename"
-	parts := strings.Split(target, "/")
-	if len(parts) != 2 {
-		http.Error(w, `{"errors":["invalid target format, expected username/gamename"]}`, http.StatusBadRequest)
-		return
-	}
-
-	username := parts[0]
-	gamename := parts[1]
-
-	// Get user from context (set by auth middleware)
-	user, ok := auth.GetUser(r.Context())
-	if !ok || user == nil {
-		http.Error(w, `{"errors":["user not found in context"]}`, http.StatusInternalServerError)
-		return
-	}
-
-	// Validate namespace access
-	err := h.validateNamespaceAccess(user, username)
-	if err != nil {
-		fmt.Printf("Namespace access denied: %v\n", err)
-		http.Error(w, `{"errors":["access denied"]}`, http.StatusForbidden)
-		return
-	}
-
-	// Find the target user (for namespace access)
-	var targetUserID int64
-	if user.Username == username {
-		// User accessing their own namespace
-		targetUserID = user.ID
-	} else {
-		// Admin user accessing another user's namespace - look up the target user
-		targetUser, err := h.db.GetUserByUsername(username)
-		if err != nil {
-			http.Error(w, `{"errors":["target user not found"]}`, http.StatusNotFound)
-			return
-		}
-		targetUserID = targetUser.ID
-	}
-
-	// Find the game owned by the target user
-	game, err := h.db.GetGameByUserAndTitle(targetUserID, gamename)
-	if err != nil {
-		http.Error(w, `{"errors":["game not found"]}`, http.StatusNotFound)
-		return
-	}
-
-	// Get all uploads for this game
-	uploads, err := h.db.GetUploadsByGameID(game.ID)
-	if err != nil {
-		http.Error(w, `{"errors":["failed to get uploads"]}`, http.StatusInternalServerError)
-		return
-	}
-
-	// Find the channel across all uploads
-	var foundChannel *models.Channel
-	var foundUpload *models.Upload
-
-	for _, upload := range uploads {
-		channels, err := h.db.GetChannelsByUploadID(upload.ID)
-		if err != nil {
-			continue
-		}
-
-		for _, channel := range channels {
-			if channel.Name == channelName {
-				foundChannel = channel
-				foundUpload = upload
-				break
-			}
-		}
-
-		if foundChannel != nil {
-			break
-		}
-	}
-
-	if foundChannel == nil {
-		http.Error(w, `{"errors":["channel not found"]}`, http.StatusNotFound)
+	_, _, channel, ok := h.findTargetChannel(w, r)
+	if !ok {
 		return
 	}
 
 	channelData := map[string]interface{}{
-		"name": foundChannel.Name,
+		"name": channel.Name,
 		"upload": map[string]interface{}{
-			"id": foundUpload.ID,
+			"id": channel.UploadID,
 		},
 	}
 
-	// Get the current build if it exists
-	if foundChannel.CurrentBuildID != nil {
-		currentBuild, err := h.db.GetBuildByID(*foundChannel.CurrentBuildID)
+	// Get the current build if it exists, or the rollout candidate for installs taking part in it
+	if headID := channel.HeadForInstall(r.URL.Query().Get("install_id")); headID != nil {
+		currentBuild, err := h.db.GetBuildByID(*headID)
 		if err == nil {
 			buildData := map[string]interface{}{
 				"id":    currentBuild.ID,
@@ -304,6 +292,14 @@ func (h *WharfHandlers) GetChannel(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if channel.CandidateBuildID != nil {
+		channelData["rollout"] = channelRolloutData(channel)
+	}
+
+	if channel.ExpiresAt != nil {
+		channelData["expires_at"] = channel.ExpiresAt
+	}
+
 	response := map[string]interface{}{
 		"channel": channelData,
 	}
@@ -328,9 +324,13 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body - try JSON first, then form data
 	var req struct {
-		Target      string `json:"target"`
-		Channel     string `json:"channel"`
-		UserVersion string `json:"user_version"`
+		Target       string            `json:"target"`
+		GameID       int64             `json:"game_id"`
+		Channel      string            `json:"channel"`
+		UserVersion  string            `json:"user_version"`
+		ChannelTTL   string            `json:"channel_ttl"` // optional, makes the channel expire this long after the push
+		ReleaseNotes string            `json:"release_notes"`
+		Metadata     map[string]string `json:"metadata"` // provenance from CI, e.g. git_sha, branch, ci_job_url
 	}
 
 	contentType := r.Header.Get("Content-Type")
@@ -352,70 +352,57 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 		req.Target = r.Form.Get("target")
 		req.Channel = r.Form.Get("channel")
 		req.UserVersion = r.Form.Get("user_version")
+		req.ChannelTTL = r.Form.Get("channel_ttl")
+		req.ReleaseNotes = r.Form.Get("release_notes")
+		req.Metadata = formMetadata(r.Form)
+		if gameIDStr := r.Form.Get("game_id"); gameIDStr != "" {
+			req.GameID, err = strconv.ParseInt(gameIDStr, 10, 64)
+			if err != nil {
+				http.Error(w, `{"errors":["invalid game_id"]}`, http.StatusBadRequest)
+				return
+			}
+		}
 	}
 
-	fmt.Printf("Parsed request: target=%s, channel=%s, user_version=%s\n", req.Target, req.Channel, req.UserVersion)
+	fmt.Printf("Parsed request: target=%s, game_id=%d, channel=%s, user_version=%s\n", req.Target, req.GameID, req.Channel, req.UserVersion)
 
-	if req.Target == "" {
-		http.Error(w, `{"errors":["missing target"]}`, http.StatusBadRequest)
-		return
+	if req.ChannelTTL != "" {
+		if _, err := parseTTL(req.ChannelTTL); err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	// Parse target to find game/upload
-	parts := strings.Split(req.Target, "/")
-	if len(parts) != 2 {
-		http.Error(w, `{"errors":["invalid target format"]}`, http.StatusBadRequest)
+	if err := validateBuildMetadata(req.Metadata); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	username, gameName := parts[0], parts[1]
-
-	// Validate namespace access
-	err = h.validateNamespaceAccess(user, username)
-	if err != nil {
-		fmt.Printf("Namespace access denied: %v\n", err)
-		http.Error(w, `{"errors":["access denied"]}`, http.StatusForbidden)
-		return
+	var gameIDStr string
+	if req.GameID != 0 {
+		gameIDStr = strconv.FormatInt(req.GameID, 10)
 	}
 
-	// For this simple implementation, we'll create a game and upload if they don't exist
-	// In practice, you'd want better lookup logic
-
-	// Find the namespace owner (the user who owns this namespace)
-	namespaceOwner, err := h.db.GetUserByUsername(username)
+	// Resolve the namespace owner; pushing to a target whose game doesn't exist yet creates it
+	bt, err := h.resolveTarget(user, req.Target, gameIDStr, true)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"errors":["namespace owner not found: %s"]}`, username), http.StatusNotFound)
+		fmt.Printf("Target resolution failed: %v\n", err)
+		writeTargetError(w, err)
 		return
 	}
+	namespaceOwner, game, gameName := bt.Owner, bt.Game, bt.GameName
 
-	// Create or find game
-	fmt.Printf("Looking for existing game: namespace_owner_id=%d, title='%s'\n", namespaceOwner.ID, gameName)
-
-	// First try to find existing game owned by the namespace owner
-	var games []*models.Game
-	games, err = h.db.GetGamesByUserID(namespaceOwner.ID)
-	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
-		return
-	}
-
-	// Find game by title
-	var game *models.Game
-	for _, g := range games {
-		if g.Title == gameName {
-			game = g
-			fmt.Printf("Found existing game: ID=%d, Title='%s'\n", game.ID, game.Title)
-			break
-		}
-	}
-
-	if game == nil {
+	if game != nil {
+		fmt.Printf("Found existing game: ID=%d, Title='%s'\n", game.ID, game.Title)
+	} else {
 		// Create new game owned by the namespace owner
 		game = &models.Game{
 			UserID:         namespaceOwner.ID,
 			Title:          gameName,
 			Type:           "default",
 			Classification: "game",
+			WebChannel:     "web",
+			Visibility:     models.GameVisibilityPublic,
 		}
 
 		err = h.db.CreateGame(game)
@@ -426,6 +413,13 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 		fmt.Printf("Created new game: ID=%d, Title='%s', Owner='%s'\n", game.ID, game.Title, namespaceOwner.Username)
 	}
 
+	// Reject versions the game's policy can never accept before creating an upload for a new channel
+	if err := models.CheckVersionPolicy(game.VersionPolicy, req.Channel, req.UserVersion, nil, nil); err != nil {
+		fmt.Printf("Push rejected by version policy: %v\n", err)
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Create or find upload - look for existing upload that matches the channel
 	var uploads []*models.Upload
 	uploads, err = h.db.GetUploadsByGameID(game.ID)
@@ -461,8 +455,9 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 			DisplayName: gameName,
 			Storage:     "hosted",
 			Type:        "default",
-			Platforms:   `["windows","linux","osx"]`,
 		}
+		// Processing refines this from the build's executables once it completes
+		upload.Platforms, upload.Architectures = models.PlatformsFromChannel(req.Channel)
 
 		err = h.db.CreateUpload(upload)
 		if err != nil {
@@ -491,6 +486,22 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 		} else {
 			fmt.Printf("Existing channel has no current build\n")
 		}
+
+		// Enforce channel protection before creating anything for this push
+		if err := h.checkChannelProtection(user, existingChannel, req.UserVersion, nil, false); err != nil {
+			fmt.Printf("Push rejected by channel protection: %v\n", err)
+			writeErrors(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	// Enforce the game's version policy against what the channel already had
+	if existingChannel != nil {
+		if err := h.checkVersionPolicy(game, req.Channel, existingChannel, req.UserVersion, 0); err != nil {
+			fmt.Printf("Push rejected by version policy: %v\n", err)
+			writeTargetError(w, err)
+			return
+		}
 	}
 
 	// Create new build
@@ -499,6 +510,7 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 		UserVersion:   req.UserVersion,
 		ParentBuildID: parentBuildID,
 		State:         "started",
+		ReleaseNotes:  req.ReleaseNotes,
 	}
 
 	fmt.Printf("Creating build: UploadID=%d, ParentBuildID=%v, UserVersion='%s'\n",
@@ -512,15 +524,34 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Printf("Created build with ID: %d\n", build.ID)
 
+	if len(req.Metadata) > 0 {
+		if err := h.db.UpdateBuildMetadata(build.ID, req.Metadata, nil); err != nil {
+			writeErrors(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Ephemeral channels expire some time after their latest push
+	expiresAt, err := h.pushExpiry(game.ID, req.Channel, req.ChannelTTL)
+	if err != nil {
+		writeErrors(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Create or update channel to point to new build
 	if existingChannel != nil {
 		// Channel exists, update it to point to new build
+		previousBuildID := existingChannel.CurrentBuildID
 		existingChannel.CurrentBuildID = &build.ID
+		if expiresAt != nil {
+			existingChannel.ExpiresAt = expiresAt
+		}
 		err = h.db.UpdateChannel(existingChannel)
 		if err != nil {
 			http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
+		h.recordHeadChange(existingChannel, previousBuildID, models.HeadChangePush, user.Username)
 		fmt.Printf("Updated existing channel to point to build %d\n", build.ID)
 	} else {
 		// Channel doesn't exist, create it
@@ -528,12 +559,14 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 			Name:           req.Channel,
 			UploadID:       upload.ID,
 			CurrentBuildID: &build.ID,
+			ExpiresAt:      expiresAt,
 		}
 		err = h.db.CreateChannel(channel)
 		if err != nil {
 			http.Error(w, fmt.Sprintf(`{"errors":["%s"]}`, err.Error()), http.StatusInternalServerError)
 			return
 		}
+		h.recordHeadChange(channel, nil, models.HeadChangePush, user.Username)
 		fmt.Printf("Created new channel pointing to build %d\n", build.ID)
 	}
 
@@ -544,6 +577,10 @@ func (h *WharfHandlers) CreateBuild(w http.ResponseWriter, r *http.Request) {
 		"state":       build.State,
 	}
 
+	if len(req.Metadata) > 0 {
+		buildResponse["metadata"] = req.Metadata
+	}
+
 	if build.ParentBuildID != nil {
 		buildResponse["parentBuild"] = map[string]interface{}{
 			"id": *build.ParentBuildID,
@@ -888,11 +925,10 @@ func (h *WharfHandlers) checkAndUpdateBuildState(buildID int64) error {
 			return fmt.Errorf("failed to update build state to processing: %w", err)
 		}
 
-		// Generate archive file for fetch operations
-		err = h.generateArchiveFile(build)
+		// Work out which platforms the upload is for from the build's content
+		err = h.detectPlatforms(build)
 		if err != nil {
-			fmt.Printf("Warning: Failed to generate archive file for build %d: %v\n", buildID, err)
-			// Don't fail the build, just log the warning
+			fmt.Printf("Warning: Failed to detect platforms for build %d: %v\n", buildID, err)
 		}
 
 		build.State = "completed"
@@ -902,68 +938,86 @@ func (h *WharfHandlers) checkAndUpdateBuildState(buildID int64) error {
 		}
 
 		fmt.Printf("Build %d state updated to: %s\n", buildID, build.State)
+
+		// HTML games are played from unpacked builds, so theirs are always unpacked
+		if h.unpackBuilds || h.isHTMLGameBuild(build) {
+			// A play request during the push may have found nothing to unpack
+			h.unpackStateMu.Lock()
+			h.setUnpackFailure(build.ID, nil)
+			h.unpackStateMu.Unlock()
+			h.startUnpack(build.ID)
+		}
 	}
 
 	return nil
 }
 
-// generateArchiveFile creates a ZIP archive containing the full game content for fetch operations
+// generateArchiveFile creates a ZIP archive of the full game content of an
+// unpacked build, for fetch operations and plain downloads. An archive the
+// build already has is replaced.
 func (h *WharfHandlers) generateArchiveFile(build *models.Build) error {
 	fmt.Printf("Generating archive file for build %d\n", build.ID)
 
-	// Generate archive from all build files in MinIO
-	// This creates a ZIP archive containing all files from this build
-
-	archivePath, archiveSize, err := h.createArchiveFromBuildFiles(build.ID)
+	archivePath, archiveSize, err := h.createArchiveFromContent(build)
 	if err != nil {
 		return fmt.Errorf("failed to create archive: %w", err)
 	}
+	defer os.Remove(archivePath)
 
-	// Create a build file entry for the archive
-	archiveFile := &models.BuildFile{
-		BuildID:     build.ID,
-		Type:        "archive",
-		SubType:     "default",
-		State:       "uploaded",
-		Size:        archiveSize,
-		StoragePath: fmt.Sprintf("builds/%d/files", build.ID), // Will be updated after we get the file ID
-	}
-
-	err = h.db.CreateBuildFile(archiveFile)
+	buildFiles, err := h.db.GetBuildFilesByBuildID(build.ID)
 	if err != nil {
-		return fmt.Errorf("failed to create archive build file: %w", err)
+		return fmt.Errorf("failed to get build files: %w", err)
 	}
-
-	// Update the StoragePath with the correct file ID
-	archiveFile.StoragePath = fmt.Sprintf("builds/%d/files/%d", build.ID, archiveFile.ID)
-	err = h.db.UpdateBuildFile(archiveFile)
-	if err != nil {
-		return fmt.Errorf("failed to update archive build file storage path: %w", err)
+	archiveFile := findBuildFile(buildFiles, "archive")
+	if archiveFile == nil {
+		// Create a build file entry for the archive
+		archiveFile = &models.BuildFile{
+			BuildID:     build.ID,
+			Type:        "archive",
+			SubType:     "default",
+			State:       "uploading",
+			StoragePath: fmt.Sprintf("builds/%d/files", build.ID), // Will be updated after we get the file ID
+		}
+		err = h.db.CreateBuildFile(archiveFile)
+		if err != nil {
+			return fmt.Errorf("failed to create archive build file: %w", err)
+		}
+		archiveFile.StoragePath = fmt.Sprintf("builds/%d/files/%d", build.ID, archiveFile.ID)
 	}
 
-	// Move the archive to the proper storage location
-	finalPath := fmt.Sprintf("storage/builds/%d/files/%d", build.ID, archiveFile.ID)
-	err = os.MkdirAll(filepath.Dir(finalPath), 0755)
+	// Store the archive next to the build's other files, so it can be served with signed URLs
+	_, err = h.minioClient.FPutObject(context.Background(), h.bucketName, archiveFile.StoragePath, archivePath, minio.PutObjectOptions{
+		ContentType: "application/zip",
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create archive directory: %w", err)
+		archiveFile.State = "failed"
+		h.db.UpdateBuildFile(archiveFile)
+		return fmt.Errorf("failed to store archive: %w", err)
 	}
 
-	err = os.Rename(archivePath, finalPath)
+	archiveFile.State = "uploaded"
+	archiveFile.Size = archiveSize
+	err = h.db.UpdateBuildFile(archiveFile)
 	if err != nil {
-		return fmt.Errorf("failed to move archive to final location: %w", err)
+		return fmt.Errorf("failed to update archive build file: %w", err)
 	}
 
 	fmt.Printf("Generated archive file %d for build %d (size: %d bytes)\n", archiveFile.ID, build.ID, archiveSize)
 	return nil
 }
 
-// createArchiveFromBuildFiles creates a ZIP archive from all build files in MinIO
-func (h *WharfHandlers) createArchiveFromBuildFiles(buildID int64) (string, int64, error) {
-	// Get all build files for this build
-	buildFiles, err := h.db.GetBuildFilesByBuildID(buildID)
+// createArchiveFromContent creates a ZIP archive of the files, directories and
+// symlinks of an unpacked build, read from its per-file objects in MinIO
+func (h *WharfHandlers) createArchiveFromContent(build *models.Build) (string, int64, error) {
+	if !build.Unpacked {
+		return "", 0, fmt.Errorf("build %d is not unpacked", build.ID)
+	}
+
+	manifest, err := h.loadManifest(build)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to get build files: %w", err)
+		return "", 0, err
 	}
+
 	// Create a temporary file for the archive
 	tempFile, err := os.CreateTemp("", "archive-*.zip")
 	if err != nil {
@@ -971,77 +1025,84 @@ func (h *WharfHandlers) createArchiveFromBuildFiles(buildID int64) (string, int6
 	}
 	defer tempFile.Close()
 
-	// Create ZIP writer
 	zipWriter := zip.NewWriter(tempFile)
 	defer zipWriter.Close()
 
 	ctx := context.Background()
 
-	// Add each build file to the archive
-	for _, buildFile := range buildFiles {
-		if buildFile.State != "uploaded" {
-			continue // Skip files that aren't fully uploaded
-		}
-
-		// Get the file from MinIO
-		object, err := h.minioClient.GetObject(ctx, h.bucketName, buildFile.StoragePath, minio.GetObjectOptions{})
-		if err != nil {
-			fmt.Printf("Warning: failed to get file %s from MinIO: %v\n", buildFile.StoragePath, err)
-			continue
-		}
-
-		// Create entry in ZIP
-		filename := fmt.Sprintf("%s_%s", buildFile.Type, buildFile.SubType)
-		if buildFile.Type == "archive" {
-			filename += ".zip"
+	for _, entry := range manifest.Entries {
+		header := &zip.FileHeader{Name: entry.Path, Method: zip.Deflate, Modified: build.CreatedAt}
+		switch entry.Type {
+		case "dir":
+			header.Name += "/"
+			header.SetMode(os.ModeDir | entry.perm)
+		case "symlink":
+			header.SetMode(os.ModeSymlink | entry.perm)
+		default:
+			header.SetMode(entry.perm)
 		}
 
-		writer, err := zipWriter.Create(filename)
+		writer, err := zipWriter.CreateHeader(header)
 		if err != nil {
-			object.Close()
+			os.Remove(tempFile.Name())
 			return "", 0, fmt.Errorf("failed to create zip entry: %w", err)
 		}
 
-		// Copy file content to ZIP
-		_, err = io.Copy(writer, object)
-		object.Close()
-		if err != nil {
-			return "", 0, fmt.Errorf("failed to copy file to archive: %w", err)
-		}
-
-		fmt.Printf("Added file %s to archive\n", filename)
-	}
-
-	// If no files were added, create a placeholder
-	if len(buildFiles) == 0 {
-		writer, err := zipWriter.Create("README.txt")
-		if err != nil {
-			return "", 0, fmt.Errorf("failed to create placeholder: %w", err)
+		switch entry.Type {
+		case "symlink":
+			_, err = io.WriteString(writer, entry.Dest)
+		case "file":
+			err = h.copyContentFile(ctx, writer, build.ID, entry.Path)
 		}
-		content := fmt.Sprintf("Build %d\nGenerated at: %s\nNo files uploaded yet.\n", buildID, time.Now().Format(time.RFC3339))
-		_, err = writer.Write([]byte(content))
 		if err != nil {
-			return "", 0, fmt.Errorf("failed to write placeholder: %w", err)
+			os.Remove(tempFile.Name())
+			return "", 0, fmt.Errorf("failed to add %s to archive: %w", entry.Path, err)
 		}
 	}
 
 	// Close ZIP writer to finalize
 	err = zipWriter.Close()
 	if err != nil {
+		os.Remove(tempFile.Name())
 		return "", 0, fmt.Errorf("failed to close zip writer: %w", err)
 	}
 
 	// Get file size
 	stat, err := os.Stat(tempFile.Name())
 	if err != nil {
+		os.Remove(tempFile.Name())
 		return "", 0, fmt.Errorf("failed to get file size: %w", err)
 	}
 
 	return tempFile.Name(), stat.Size(), nil
 }
 
+// copyContentFile copies a file of an unpacked build from storage
+func (h *WharfHandlers) copyContentFile(ctx context.Context, dst io.Writer, buildID int64, filePath string) error {
+	object, err := h.minioClient.GetObject(ctx, h.bucketName, contentPath(buildID, filePath), minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	_, err = io.Copy(dst, object)
+	return err
+}
+
 // GET /wharf/builds/{buildId}/files/{fileId}/download - Download build file
 func (h *WharfHandlers) GetBuildFileDownload(w http.ResponseWriter, r *http.Request) {
+	h.redirectBuildFileDownload(w, r, false)
+}
+
+// GET /builds/{buildId}/downloads/{fileId} - Public download of a file of a completed build
+func (h *WharfHandlers) GetPublicBuildFileDownload(w http.ResponseWriter, r *http.Request) {
+	h.redirectBuildFileDownload(w, r, true)
+}
+
+// redirectBuildFileDownload redirects to a signed URL of a build file of a game
+// the user may see. Public downloads are limited to finished pushes, so the
+// patches of builds still being pushed or that failed aren't handed out.
+func (h *WharfHandlers) redirectBuildFileDownload(w http.ResponseWriter, r *http.Request, public bool) {
 	buildIDStr := mux.Vars(r)["buildId"]
 	fileIDStr := mux.Vars(r)["fileId"]
 
@@ -1060,6 +1121,16 @@ func (h *WharfHandlers) GetBuildFileDownload(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	build, err := viewableBuild(h.db, r, buildID)
+	if err != nil {
+		writeTargetError(w, err)
+		return
+	}
+	if public && build.State != "completed" {
+		http.Error(w, `{"errors":["build is not completed"]}`, http.StatusNotFound)
+		return
+	}
+
 	// Get build file
 	var buildFile *models.BuildFile
 	buildFile, err = h.db.GetBuildFileByID(fileID)
@@ -1073,6 +1144,11 @@ func (h *WharfHandlers) GetBuildFileDownload(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if public && buildFile.State != "uploaded" {
+		http.Error(w, `{"errors":["build file is not uploaded"]}`, http.StatusNotFound)
+		return
+	}
+
 	// Check if file exists in storage
 	if !h.FileExists(buildFile.StoragePath) {
 		http.Error(w, `{"errors":["file not found in storage"]}`, http.StatusNotFound)
@@ -73,6 +73,7 @@ func main() {
 		listUsers      = flag.Bool("list-users", false, "List all users in the database")
 		deactivateUser = flag.String("deactivate-user", "", "Deactivate user with the given username")
 		activateUser   = flag.String("activate-user", "", "Activate user with the given username")
+		unpackBuilds   = flag.Bool("unpack-builds", getEnvOrDefault("UNPACK_BUILDS", "false") == "true", "Unpack completed builds into per-file storage")
 	)
 	flag.Parse()
 
@@ -152,12 +153,22 @@ func main() {
 	}
 
 	// Initialize handlers
-	coreHandlers := handlers.NewCoreHandlers(db)
+	coreHandlers := handlers.NewCoreHandlers(db, minioClient, bucketName)
 	wharfHandlers := handlers.NewWharfHandlers(db, minioClient, bucketName)
+	wharfHandlers.SetUnpackBuilds(*unpackBuilds)
+
+	// Apply scheduled releases in the background, catching up on any that fell due while stopped
+	go wharfHandlers.RunReleaseScheduler(context.Background(), 15*time.Second)
+
+	// Delete expired channels and the builds nothing else uses
+	go wharfHandlers.RunChannelCleanup(context.Background(), 5*time.Minute)
 
 	// Setup router
 	r := mux.NewRouter()
 
+	// Answer panics with a JSON 500 instead of dropping the connection
+	r.Use(handlers.RecoveryMiddleware)
+
 	// Add CORS middleware for development and request logging
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -278,32 +289,84 @@ window.location.href = "%s";
 	r.HandleFunc("/oauth/authorize", oauthHandler).Methods("GET")
 	r.HandleFunc("/user/oauth", oauthHandler).Methods("GET")
 
-	// API routes with optional authentication
-	api := r.PathPrefix("/").Subrouter()
+	// Core API endpoints that need a user, answering 401 without a valid API key
+	authenticated := r.NewRoute().Subrouter()
+	authenticated.Use(auth.AuthMiddleware(db))
+
+	authenticated.HandleFunc("/profile", coreHandlers.GetProfile).Methods("GET")
+	authenticated.HandleFunc("/profile/games", coreHandlers.GetProfileGames).Methods("GET")
+
+	// Public endpoints with optional authentication; game visibility decides what a user may read
+	api := r.NewRoute().Subrouter()
 	api.Use(auth.OptionalAuthMiddleware(db))
 
+	// Web games are static sites, public unless the game is private
+	api.HandleFunc("/play/{id:[0-9]+}", wharfHandlers.PlayGame).Methods("GET", "HEAD")
+	api.HandleFunc("/play/{id:[0-9]+}/{path:.*}", wharfHandlers.PlayGame).Methods("GET", "HEAD")
+
 	// Core API endpoints
-	api.HandleFunc("/profile", coreHandlers.GetProfile).Methods("GET")
-	api.HandleFunc("/profile/games", coreHandlers.GetProfileGames).Methods("GET")
+	api.HandleFunc("/games/search", coreHandlers.SearchGames).Methods("GET")
 	api.HandleFunc("/games/{id}", coreHandlers.GetGame).Methods("GET")
 	api.HandleFunc("/games/{id}/uploads", coreHandlers.GetGameUploads).Methods("GET")
+	api.HandleFunc("/games/{id}/uploads/best", coreHandlers.GetBestUpload).Methods("GET")
+	api.HandleFunc("/games/{id}/builds/latest", coreHandlers.GetLatestBuild).Methods("GET")
+	api.HandleFunc("/games/{id}/channels/{channel}/changelog", wharfHandlers.GetChannelChangelog).Methods("GET")
 	api.HandleFunc("/uploads/{id}", coreHandlers.GetUpload).Methods("GET")
 	api.HandleFunc("/uploads/{id}/builds", coreHandlers.GetUploadBuilds).Methods("GET")
-	api.HandleFunc("/uploads/{id}/download", coreHandlers.GetUploadDownload).Methods("GET")
+	api.HandleFunc("/uploads/{id}/download", wharfHandlers.GetUploadDownload).Methods("GET")
 	api.HandleFunc("/builds/{id}", coreHandlers.GetBuild).Methods("GET")
+	api.HandleFunc("/builds/{id}/manifest", wharfHandlers.GetBuildManifest).Methods("GET")
+	api.HandleFunc("/builds/{id}/diff", wharfHandlers.GetBuildDiff).Methods("GET")
+	api.HandleFunc("/builds/{id}/files/{path:.+}", wharfHandlers.GetBuildContentFile).Methods("GET", "HEAD")
+	api.HandleFunc("/builds/{buildId}/downloads/{fileId}", wharfHandlers.GetPublicBuildFileDownload).Methods("GET", "HEAD")
+	api.HandleFunc("/updates/check", wharfHandlers.CheckForUpdate).Methods("GET", "POST")
 
 	// Wharf API endpoints
 	wharf := r.PathPrefix("/wharf").Subrouter()
 	wharf.Use(auth.AuthMiddleware(db))
 
 	wharf.HandleFunc("/status", wharfHandlers.GetWharfStatus).Methods("GET")
+	wharf.HandleFunc("/games", wharfHandlers.CreateGame).Methods("POST")
+	wharf.HandleFunc("/games/{id}", wharfHandlers.UpdateGame).Methods("PATCH")
+	wharf.HandleFunc("/games/{id}", wharfHandlers.DeleteGame).Methods("DELETE")
+	wharf.HandleFunc("/uploads", wharfHandlers.CreateUpload).Methods("POST")
+	wharf.HandleFunc("/uploads/{id}", wharfHandlers.UpdateUpload).Methods("PATCH")
+	wharf.HandleFunc("/uploads/{id}", wharfHandlers.DeleteUpload).Methods("DELETE")
 	wharf.HandleFunc("/channels", wharfHandlers.ListChannels).Methods("GET")
 	wharf.HandleFunc("/channels/{channel}", wharfHandlers.GetChannel).Methods("GET")
+	wharf.HandleFunc("/channels/{channel}/protection", wharfHandlers.GetChannelProtection).Methods("GET")
+	wharf.HandleFunc("/channels/{channel}/protection", wharfHandlers.SetChannelProtection).Methods("PUT")
+	wharf.HandleFunc("/channels/{channel}/protection", wharfHandlers.DeleteChannelProtection).Methods("DELETE")
+	wharf.HandleFunc("/channels/{channel}/promote", wharfHandlers.PromoteBuild).Methods("POST")
+	wharf.HandleFunc("/channels/{channel}/upload", wharfHandlers.BindChannelUpload).Methods("PUT")
+	wharf.HandleFunc("/channels/{channel}/rollout", wharfHandlers.GetChannelRollout).Methods("GET")
+	wharf.HandleFunc("/channels/{channel}/rollout", wharfHandlers.SetChannelRollout).Methods("PUT")
+	wharf.HandleFunc("/channels/{channel}/rollout", wharfHandlers.AbortChannelRollout).Methods("DELETE")
+	wharf.HandleFunc("/channels/{channel}/rollout/pause", wharfHandlers.PauseChannelRollout).Methods("POST")
+	wharf.HandleFunc("/channels/{channel}/rollout/resume", wharfHandlers.ResumeChannelRollout).Methods("POST")
+	wharf.HandleFunc("/channels/{channel}/schedule", wharfHandlers.ListScheduledReleases).Methods("GET")
+	wharf.HandleFunc("/channels/{channel}/schedule", wharfHandlers.ScheduleRelease).Methods("POST")
+	wharf.HandleFunc("/channels/{channel}/schedule/{id}", wharfHandlers.CancelScheduledRelease).Methods("DELETE")
+	wharf.HandleFunc("/channels/{channel}/history", wharfHandlers.GetChannelHistory).Methods("GET")
+	wharf.HandleFunc("/channels/{channel}/expiry", wharfHandlers.SetChannelExpiry).Methods("PUT")
+	wharf.HandleFunc("/channels/{channel}/expiry", wharfHandlers.DeleteChannelExpiry).Methods("DELETE")
+	wharf.HandleFunc("/channel-ttl-rules", wharfHandlers.GetChannelTTLRules).Methods("GET")
+	wharf.HandleFunc("/channel-ttl-rules", wharfHandlers.SetChannelTTLRules).Methods("PUT")
+	wharf.HandleFunc("/version-policy", wharfHandlers.GetVersionPolicy).Methods("GET")
+	wharf.HandleFunc("/version-policy", wharfHandlers.SetVersionPolicy).Methods("PUT")
+	wharf.HandleFunc("/web", wharfHandlers.GetWebSettings).Methods("GET")
+	wharf.HandleFunc("/web", wharfHandlers.SetWebSettings).Methods("PUT")
 	wharf.HandleFunc("/builds", wharfHandlers.CreateBuild).Methods("POST")
+	wharf.HandleFunc("/builds/search", wharfHandlers.SearchBuilds).Methods("GET")
 	wharf.HandleFunc("/builds/{id}/files", wharfHandlers.GetBuildFiles).Methods("GET")
 	wharf.HandleFunc("/builds/{id}/files", wharfHandlers.CreateBuildFile).Methods("POST")
 	wharf.HandleFunc("/builds/{buildId}/files/{fileId}", wharfHandlers.FinalizeBuildFile).Methods("POST")
 	wharf.HandleFunc("/builds/{buildId}/files/{fileId}/download", wharfHandlers.GetBuildFileDownload).Methods("GET", "HEAD")
+	wharf.HandleFunc("/builds/{id}/unpack", wharfHandlers.UnpackBuild).Methods("POST")
+	wharf.HandleFunc("/builds/{id}/release-notes", wharfHandlers.SetBuildReleaseNotes).Methods("PUT")
+	wharf.HandleFunc("/builds/{id}/metadata", wharfHandlers.UpdateBuildMetadata).Methods("PUT")
+	wharf.HandleFunc("/builds/{id}/labels", wharfHandlers.AddBuildLabels).Methods("POST")
+	wharf.HandleFunc("/builds/{id}/labels/{label}", wharfHandlers.RemoveBuildLabel).Methods("DELETE")
 
 	// Start server
 	fmt.Printf("Starting server on port %s\n", *port)
@@ -2,6 +2,9 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -108,12 +111,12 @@ func (d *SQLiteDatabase) GetGameByID(id int64) (*User, *Game, error) {
 
 	err := d.db.QueryRow(`
 		SELECT
-			g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.created_at, g.updated_at,
+			g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.version_policy, g.web_channel, g.default_channel, g.visibility, g.created_at, g.updated_at,
 			u.id, u.username, u.display_name, u.api_key, u.role, u.is_active, u.created_at, u.updated_at
 		FROM games g
 		JOIN users u ON g.user_id = u.id
 		WHERE g.id = ?`, id).Scan(
-		&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type, &game.Classification, &game.URL, &game.CreatedAt, &game.UpdatedAt,
+		&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type, &game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt,
 		&user.ID, &user.Username, &user.DisplayName, &user.APIKey, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -124,9 +127,20 @@ func (d *SQLiteDatabase) GetGameByID(id int64) (*User, *Game, error) {
 }
 
 func (d *SQLiteDatabase) GetGamesByUserID(userID int64) ([]*Game, error) {
+	return d.ListGamesByUserID(userID, ListOptions{})
+}
+
+func (d *SQLiteDatabase) ListGamesByUserID(userID int64, opts ListOptions) ([]*Game, error) {
+	q := &listQuery{}
+	q.where("user_id = " + q.arg(userID))
+	clauses, err := q.clauses(opts, gameListColumns)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.db.Query(`
-		SELECT id, user_id, title, short_text, type, classification, url, created_at, updated_at
-		FROM games WHERE user_id = ?`, userID)
+		SELECT id, user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at
+		FROM games`+clauses, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -136,22 +150,22 @@ func (d *SQLiteDatabase) GetGamesByUserID(userID int64) ([]*Game, error) {
 	for rows.Next() {
 		game := &Game{}
 		err := rows.Scan(&game.ID, &game.UserID, &game.Title, &game.ShortText,
-			&game.Type, &game.Classification, &game.URL, &game.CreatedAt, &game.UpdatedAt)
+			&game.Type, &game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
 		games = append(games, game)
 	}
-	return games, nil
+	return games, rows.Err()
 }
 
 func (d *SQLiteDatabase) GetGameByUserAndTitle(userID int64, title string) (*Game, error) {
 	game := &Game{}
 	err := d.db.QueryRow(`
-		SELECT id, user_id, title, short_text, type, classification, url, created_at, updated_at
+		SELECT id, user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at
 		FROM games WHERE user_id = ? AND title = ?`, userID, title).Scan(
 		&game.ID, &game.UserID, &game.Title, &game.ShortText,
-		&game.Type, &game.Classification, &game.URL, &game.CreatedAt, &game.UpdatedAt)
+		&game.Type, &game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -160,9 +174,9 @@ func (d *SQLiteDatabase) GetGameByUserAndTitle(userID int64, title string) (*Gam
 
 func (d *SQLiteDatabase) CreateGame(game *Game) error {
 	result, err := d.db.Exec(`
-		INSERT INTO games (user_id, title, short_text, type, classification, url, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
-		game.UserID, game.Title, game.ShortText, game.Type, game.Classification, game.URL)
+		INSERT INTO games (user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
+		game.UserID, game.Title, game.ShortText, game.Type, game.Classification, game.URL, game.VersionPolicy, game.WebChannel, game.DefaultChannel, game.Visibility)
 	if err != nil {
 		return err
 	}
@@ -175,25 +189,136 @@ func (d *SQLiteDatabase) CreateGame(game *Game) error {
 	return nil
 }
 
+func (d *SQLiteDatabase) SetGameVersionPolicy(gameID int64, policy string) error {
+	_, err := d.db.Exec(`
+		UPDATE games SET version_policy = ?, updated_at = datetime('now') WHERE id = ?`, policy, gameID)
+	return err
+}
+
+func (d *SQLiteDatabase) SetGameWebSettings(gameID int64, gameType, webChannel string) error {
+	_, err := d.db.Exec(`
+		UPDATE games SET type = ?, web_channel = ?, updated_at = datetime('now') WHERE id = ?`, gameType, webChannel, gameID)
+	return err
+}
+
+func (d *SQLiteDatabase) UpdateGame(game *Game) error {
+	_, err := d.db.Exec(`
+		UPDATE games SET title = ?, short_text = ?, type = ?, classification = ?, url = ?, visibility = ?, default_channel = ?, updated_at = datetime('now')
+		WHERE id = ?`,
+		game.Title, game.ShortText, game.Type, game.Classification, game.URL, game.Visibility, game.DefaultChannel, game.ID)
+	return err
+}
+
+// DeleteGame deletes a game with all its uploads, channels and builds in one
+// transaction. Parent links are cleared first so builds patched across uploads
+// can be deleted in a single statement.
+func (d *SQLiteDatabase) DeleteGame(id int64) error {
+	const uploads = `SELECT id FROM uploads WHERE game_id = ?`
+	const builds = `SELECT id FROM builds WHERE upload_id IN (` + uploads + `)`
+	const channels = `SELECT id FROM channels WHERE upload_id IN (` + uploads + `)`
+	return execInTx(d.db,
+		statement{`DELETE FROM upload_sessions WHERE build_file_id IN (SELECT id FROM build_files WHERE build_id IN (` + builds + `))`, []interface{}{id}},
+		statement{`DELETE FROM build_files WHERE build_id IN (` + builds + `)`, []interface{}{id}},
+		statement{`DELETE FROM build_metadata WHERE build_id IN (` + builds + `)`, []interface{}{id}},
+		statement{`DELETE FROM build_labels WHERE build_id IN (` + builds + `)`, []interface{}{id}},
+		statement{`DELETE FROM scheduled_releases WHERE build_id IN (` + builds + `) OR channel_id IN (` + channels + `)`, []interface{}{id, id}},
+		statement{`DELETE FROM channel_protections WHERE channel_id IN (` + channels + `)`, []interface{}{id}},
+		statement{`DELETE FROM channel_history WHERE channel_id IN (` + channels + `)`, []interface{}{id}},
+		statement{`DELETE FROM channels WHERE upload_id IN (` + uploads + `)`, []interface{}{id}},
+		statement{`UPDATE builds SET parent_build_id = NULL WHERE upload_id IN (` + uploads + `)`, []interface{}{id}},
+		statement{`DELETE FROM builds WHERE upload_id IN (` + uploads + `)`, []interface{}{id}},
+		statement{`DELETE FROM uploads WHERE game_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM channel_ttl_rules WHERE game_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM games WHERE id = ?`, []interface{}{id}},
+	)
+}
+
+func (d *SQLiteDatabase) SearchGames(search GameSearch, opts ListOptions) ([]*GameSearchResult, error) {
+	terms := searchTerms(search.Query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	q := &listQuery{}
+	var results string
+	if d.fullText {
+		match := make([]string, len(terms))
+		for i, term := range terms {
+			match[i] = `"` + term + `"*`
+		}
+		// bm25 ranks better matches lower; title matches weigh most
+		results = `
+			SELECT g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.version_policy, g.web_channel, g.default_channel, g.visibility, g.created_at, g.updated_at,
+				u.username, u.display_name, bm25(games_fts, 4.0, 2.0, 1.0) AS score
+			FROM games_fts
+			JOIN games g ON g.id = games_fts.rowid
+			JOIN users u ON g.user_id = u.id
+			WHERE games_fts MATCH ` + q.arg(strings.Join(match, " "))
+	} else {
+		// Without FTS5 every word has to appear somewhere, and all results rank the same
+		var conditions []string
+		for _, term := range terms {
+			pattern := "%" + term + "%"
+			conditions = append(conditions, fmt.Sprintf("(g.title LIKE %s OR g.short_text LIKE %s OR u.username LIKE %s)",
+				q.arg(pattern), q.arg(pattern), q.arg(pattern)))
+		}
+		results = `
+			SELECT g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.version_policy, g.web_channel, g.default_channel, g.visibility, g.created_at, g.updated_at,
+				u.username, u.display_name, 0.0 AS score
+			FROM games g
+			JOIN users u ON g.user_id = u.id
+			WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	q.gameVisibilityCondition(search)
+	clauses, err := q.clauses(opts, gameSearchColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at,
+			username, display_name, score
+		FROM (`+results+`) AS results`+clauses, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanGameSearchResults(rows)
+}
+
 // Upload database methods
 func (d *SQLiteDatabase) GetUploadByID(id int64) (*Upload, error) {
 	upload := &Upload{}
+	var platforms, architectures sql.NullString
 	err := d.db.QueryRow(`
-		SELECT id, game_id, filename, display_name, size, storage, type, platforms, created_at, updated_at
+		SELECT id, game_id, filename, display_name, size, storage, type, platforms, architectures, platforms_locked, created_at, updated_at
 		FROM uploads WHERE id = ?`, id).Scan(
 		&upload.ID, &upload.GameID, &upload.Filename, &upload.DisplayName,
-		&upload.Size, &upload.Storage, &upload.Type, &upload.Platforms,
+		&upload.Size, &upload.Storage, &upload.Type, &platforms, &architectures, &upload.PlatformsLocked,
 		&upload.CreatedAt, &upload.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	upload.Platforms = decodeStringList(platforms.String)
+	upload.Architectures = decodeStringList(architectures.String)
 	return upload, nil
 }
 
 func (d *SQLiteDatabase) GetUploadsByGameID(gameID int64) ([]*Upload, error) {
+	return d.ListUploadsByGameID(gameID, ListOptions{})
+}
+
+func (d *SQLiteDatabase) ListUploadsByGameID(gameID int64, opts ListOptions) ([]*Upload, error) {
+	q := &listQuery{}
+	q.where("game_id = " + q.arg(gameID))
+	clauses, err := q.clauses(opts, uploadListColumns)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.db.Query(`
-		SELECT id, game_id, filename, display_name, size, storage, type, platforms, created_at, updated_at
-		FROM uploads WHERE game_id = ?`, gameID)
+		SELECT id, game_id, filename, display_name, size, storage, type, platforms, architectures, platforms_locked, created_at, updated_at
+		FROM uploads`+clauses, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -202,23 +327,26 @@ func (d *SQLiteDatabase) GetUploadsByGameID(gameID int64) ([]*Upload, error) {
 	var uploads []*Upload
 	for rows.Next() {
 		upload := &Upload{}
+		var platforms, architectures sql.NullString
 		err := rows.Scan(&upload.ID, &upload.GameID, &upload.Filename, &upload.DisplayName,
-			&upload.Size, &upload.Storage, &upload.Type, &upload.Platforms,
+			&upload.Size, &upload.Storage, &upload.Type, &platforms, &architectures, &upload.PlatformsLocked,
 			&upload.CreatedAt, &upload.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		upload.Platforms = decodeStringList(platforms.String)
+		upload.Architectures = decodeStringList(architectures.String)
 		uploads = append(uploads, upload)
 	}
-	return uploads, nil
+	return uploads, rows.Err()
 }
 
 func (d *SQLiteDatabase) CreateUpload(upload *Upload) error {
 	result, err := d.db.Exec(`
-		INSERT INTO uploads (game_id, filename, display_name, size, storage, type, platforms, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
+		INSERT INTO uploads (game_id, filename, display_name, size, storage, type, platforms, architectures, platforms_locked, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
 		upload.GameID, upload.Filename, upload.DisplayName, upload.Size,
-		upload.Storage, upload.Type, upload.Platforms)
+		upload.Storage, upload.Type, encodeStringList(upload.Platforms), encodeStringList(upload.Architectures), upload.PlatformsLocked)
 	if err != nil {
 		return err
 	}
@@ -231,16 +359,38 @@ func (d *SQLiteDatabase) CreateUpload(upload *Upload) error {
 	return nil
 }
 
+func (d *SQLiteDatabase) UpdateUploadPlatforms(uploadID int64, platforms, architectures []string) error {
+	_, err := d.db.Exec(`
+		UPDATE uploads SET platforms = ?, architectures = ?, updated_at = datetime('now') WHERE id = ?`,
+		encodeStringList(platforms), encodeStringList(architectures), uploadID)
+	return err
+}
+
+func (d *SQLiteDatabase) UpdateUpload(upload *Upload) error {
+	_, err := d.db.Exec(`
+		UPDATE uploads SET filename = ?, display_name = ?, type = ?, platforms = ?, architectures = ?, platforms_locked = ?,
+		       updated_at = datetime('now')
+		WHERE id = ?`,
+		upload.Filename, upload.DisplayName, upload.Type, encodeStringList(upload.Platforms),
+		encodeStringList(upload.Architectures), upload.PlatformsLocked, upload.ID)
+	return err
+}
+
+func (d *SQLiteDatabase) DeleteUpload(id int64) error {
+	_, err := d.db.Exec(`DELETE FROM uploads WHERE id = ?`, id)
+	return err
+}
+
 // Build database methods
 func (d *SQLiteDatabase) GetBuildByID(id int64) (*Build, error) {
 	build := &Build{}
 	var parentBuildID sql.NullInt64
 
 	err := d.db.QueryRow(`
-		SELECT id, upload_id, user_version, parent_build_id, state, created_at, updated_at
+		SELECT id, upload_id, user_version, parent_build_id, state, unpacked, release_notes, created_at, updated_at
 		FROM builds WHERE id = ?`, id).Scan(
 		&build.ID, &build.UploadID, &build.UserVersion, &parentBuildID,
-		&build.State, &build.CreatedAt, &build.UpdatedAt)
+		&build.State, &build.Unpacked, &build.ReleaseNotes, &build.CreatedAt, &build.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -253,9 +403,21 @@ func (d *SQLiteDatabase) GetBuildByID(id int64) (*Build, error) {
 }
 
 func (d *SQLiteDatabase) GetBuildsByUploadID(uploadID int64) ([]*Build, error) {
+	return d.ListBuilds(uploadID, BuildFilter{}, ListOptions{Descending: true})
+}
+
+func (d *SQLiteDatabase) ListBuilds(uploadID int64, filter BuildFilter, opts ListOptions) ([]*Build, error) {
+	q := &listQuery{}
+	q.where("upload_id = " + q.arg(uploadID))
+	q.buildFilterConditions(filter)
+	clauses, err := q.clauses(opts, buildListColumns)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.db.Query(`
-		SELECT id, upload_id, user_version, parent_build_id, state, created_at, updated_at
-		FROM builds WHERE upload_id = ? ORDER BY id DESC`, uploadID)
+		SELECT id, upload_id, user_version, parent_build_id, state, unpacked, release_notes, created_at, updated_at
+		FROM builds`+clauses, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -267,7 +429,7 @@ func (d *SQLiteDatabase) GetBuildsByUploadID(uploadID int64) ([]*Build, error) {
 		var parentBuildID sql.NullInt64
 
 		err := rows.Scan(&build.ID, &build.UploadID, &build.UserVersion, &parentBuildID,
-			&build.State, &build.CreatedAt, &build.UpdatedAt)
+			&build.State, &build.Unpacked, &build.ReleaseNotes, &build.CreatedAt, &build.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -278,7 +440,7 @@ func (d *SQLiteDatabase) GetBuildsByUploadID(uploadID int64) ([]*Build, error) {
 
 		builds = append(builds, build)
 	}
-	return builds, nil
+	return builds, rows.Err()
 }
 
 func (d *SQLiteDatabase) CreateBuild(build *Build) error {
@@ -288,9 +450,9 @@ func (d *SQLiteDatabase) CreateBuild(build *Build) error {
 	}
 
 	result, err := d.db.Exec(`
-		INSERT INTO builds (upload_id, user_version, parent_build_id, state, created_at, updated_at)
-		VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))`,
-		build.UploadID, build.UserVersion, parentBuildID, build.State)
+		INSERT INTO builds (upload_id, user_version, parent_build_id, state, unpacked, release_notes, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
+		build.UploadID, build.UserVersion, parentBuildID, build.State, build.Unpacked, build.ReleaseNotes)
 	if err != nil {
 		return err
 	}
@@ -310,12 +472,191 @@ func (d *SQLiteDatabase) UpdateBuild(build *Build) error {
 	}
 
 	_, err := d.db.Exec(`
-		UPDATE builds SET upload_id = ?, user_version = ?, parent_build_id = ?, state = ?, updated_at = datetime('now')
+		UPDATE builds SET upload_id = ?, user_version = ?, parent_build_id = ?, state = ?, unpacked = ?, release_notes = ?,
+		       updated_at = datetime('now')
 		WHERE id = ?`,
-		build.UploadID, build.UserVersion, parentBuildID, build.State, build.ID)
+		build.UploadID, build.UserVersion, parentBuildID, build.State, build.Unpacked, build.ReleaseNotes, build.ID)
 	return err
 }
 
+func (d *SQLiteDatabase) DeleteBuild(id int64) error {
+	return execInTx(d.db,
+		statement{`DELETE FROM upload_sessions WHERE build_file_id IN (SELECT id FROM build_files WHERE build_id = ?)`, []interface{}{id}},
+		statement{`DELETE FROM build_files WHERE build_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM build_metadata WHERE build_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM build_labels WHERE build_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM scheduled_releases WHERE build_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM builds WHERE id = ?`, []interface{}{id}},
+	)
+}
+
+// BuildMetadata database methods
+func (d *SQLiteDatabase) GetBuildMetadata(buildID int64) (map[string]string, error) {
+	rows, err := d.db.Query(`
+		SELECT key, value FROM build_metadata WHERE build_id = ? ORDER BY key`, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+	return metadata, rows.Err()
+}
+
+func (d *SQLiteDatabase) GetBuildMetadataByUploadID(uploadID int64) (map[int64]map[string]string, error) {
+	rows, err := d.db.Query(`
+		SELECT m.build_id, m.key, m.value FROM build_metadata m
+		JOIN builds b ON b.id = m.build_id
+		WHERE b.upload_id = ?`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := map[int64]map[string]string{}
+	for rows.Next() {
+		var buildID int64
+		var key, value string
+		if err := rows.Scan(&buildID, &key, &value); err != nil {
+			return nil, err
+		}
+		if metadata[buildID] == nil {
+			metadata[buildID] = map[string]string{}
+		}
+		metadata[buildID][key] = value
+	}
+	return metadata, rows.Err()
+}
+
+func (d *SQLiteDatabase) UpdateBuildMetadata(buildID int64, set map[string]string, remove []string) error {
+	var statements []statement
+	for key, value := range set {
+		statements = append(statements, statement{`
+			INSERT INTO build_metadata (build_id, key, value, created_at, updated_at)
+			VALUES (?, ?, ?, datetime('now'), datetime('now'))
+			ON CONFLICT (build_id, key) DO UPDATE SET value = excluded.value, updated_at = datetime('now')`,
+			[]interface{}{buildID, key, value}})
+	}
+	for _, key := range remove {
+		statements = append(statements, statement{`DELETE FROM build_metadata WHERE build_id = ? AND key = ?`, []interface{}{buildID, key}})
+	}
+	return execInTx(d.db, statements...)
+}
+
+func (d *SQLiteDatabase) FindBuildsByMetadata(gameID int64, key, value string, opts ListOptions) ([]*Build, error) {
+	// LIKE ignores case in SQLite, so the prefix is compared exactly with substr
+	q := &listQuery{}
+	gameCondition := "u.game_id = " + q.arg(gameID)
+	var match string
+	if key != "" {
+		match = "m.key = " + q.arg(key) + " AND "
+	}
+	match += fmt.Sprintf("substr(m.value, 1, %s) = %s", q.arg(utf8.RuneCountInString(value)), q.arg(value))
+	found := `
+		SELECT b.id, b.upload_id, b.user_version, b.parent_build_id, b.state, b.unpacked, b.release_notes, b.created_at, b.updated_at
+		FROM builds b
+		JOIN uploads u ON u.id = b.upload_id
+		WHERE ` + gameCondition + ` AND EXISTS (
+			SELECT 1 FROM build_metadata m WHERE m.build_id = b.id AND ` + match + `)`
+	clauses, err := q.clauses(opts, buildListColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, upload_id, user_version, parent_build_id, state, unpacked, release_notes, created_at, updated_at
+		FROM (`+found+`)`+clauses, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var builds []*Build
+	for rows.Next() {
+		build := &Build{}
+		var parentBuildID sql.NullInt64
+
+		err := rows.Scan(&build.ID, &build.UploadID, &build.UserVersion, &parentBuildID,
+			&build.State, &build.Unpacked, &build.ReleaseNotes, &build.CreatedAt, &build.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if parentBuildID.Valid {
+			build.ParentBuildID = &parentBuildID.Int64
+		}
+		builds = append(builds, build)
+	}
+	return builds, rows.Err()
+}
+
+// BuildLabel database methods
+func (d *SQLiteDatabase) GetBuildLabels(buildID int64) ([]string, error) {
+	rows, err := d.db.Query(`SELECT label FROM build_labels WHERE build_id = ? ORDER BY label`, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []string{}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+func (d *SQLiteDatabase) GetBuildLabelsByUploadID(uploadID int64) (map[int64][]string, error) {
+	rows, err := d.db.Query(`
+		SELECT l.build_id, l.label FROM build_labels l
+		JOIN builds b ON b.id = l.build_id
+		WHERE b.upload_id = ? ORDER BY l.label`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := map[int64][]string{}
+	for rows.Next() {
+		var buildID int64
+		var label string
+		if err := rows.Scan(&buildID, &label); err != nil {
+			return nil, err
+		}
+		labels[buildID] = append(labels[buildID], label)
+	}
+	return labels, rows.Err()
+}
+
+func (d *SQLiteDatabase) AddBuildLabels(buildID int64, labels []string) error {
+	var statements []statement
+	for _, label := range labels {
+		statements = append(statements, statement{`
+			INSERT INTO build_labels (build_id, label, created_at) VALUES (?, ?, datetime('now'))
+			ON CONFLICT (build_id, label) DO NOTHING`, []interface{}{buildID, label}})
+	}
+	return execInTx(d.db, statements...)
+}
+
+func (d *SQLiteDatabase) RemoveBuildLabel(buildID int64, label string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM build_labels WHERE build_id = ? AND label = ?`, buildID, label)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
 // BuildFile database methods
 func (d *SQLiteDatabase) GetBuildFileByID(id int64) (*BuildFile, error) {
 	buildFile := &BuildFile{}
@@ -385,13 +726,16 @@ func (d *SQLiteDatabase) UpdateBuildFile(buildFile *BuildFile) error {
 // Channel database methods
 func (d *SQLiteDatabase) GetChannelByName(name string, uploadID int64) (*Channel, error) {
 	channel := &Channel{}
-	var currentBuildID sql.NullInt64
+	var currentBuildID, candidateBuildID sql.NullInt64
+	var expiresAt sql.NullTime
 
 	err := d.db.QueryRow(`
-		SELECT id, name, upload_id, current_build_id, created_at, updated_at
+		SELECT id, name, upload_id, current_build_id, candidate_build_id, rollout_percent, rollout_paused,
+		       expires_at, created_at, updated_at
 		FROM channels WHERE name = ? AND upload_id = ?`, name, uploadID).Scan(
 		&channel.ID, &channel.Name, &channel.UploadID, &currentBuildID,
-		&channel.CreatedAt, &channel.UpdatedAt)
+		&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+		&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -399,13 +743,20 @@ func (d *SQLiteDatabase) GetChannelByName(name string, uploadID int64) (*Channel
 	if currentBuildID.Valid {
 		channel.CurrentBuildID = &currentBuildID.Int64
 	}
+	if candidateBuildID.Valid {
+		channel.CandidateBuildID = &candidateBuildID.Int64
+	}
+	if expiresAt.Valid {
+		channel.ExpiresAt = &expiresAt.Time
+	}
 
 	return channel, nil
 }
 
 func (d *SQLiteDatabase) GetChannelsByUploadID(uploadID int64) ([]*Channel, error) {
 	rows, err := d.db.Query(`
-		SELECT id, name, upload_id, current_build_id, created_at, updated_at
+		SELECT id, name, upload_id, current_build_id, candidate_build_id, rollout_percent, rollout_paused,
+		       expires_at, created_at, updated_at
 		FROM channels WHERE upload_id = ?`, uploadID)
 	if err != nil {
 		return nil, err
@@ -415,10 +766,12 @@ func (d *SQLiteDatabase) GetChannelsByUploadID(uploadID int64) ([]*Channel, erro
 	var channels []*Channel
 	for rows.Next() {
 		channel := &Channel{}
-		var currentBuildID sql.NullInt64
+		var currentBuildID, candidateBuildID sql.NullInt64
+		var expiresAt sql.NullTime
 
 		err := rows.Scan(&channel.ID, &channel.Name, &channel.UploadID, &currentBuildID,
-			&channel.CreatedAt, &channel.UpdatedAt)
+			&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+			&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -426,6 +779,12 @@ func (d *SQLiteDatabase) GetChannelsByUploadID(uploadID int64) ([]*Channel, erro
 		if currentBuildID.Valid {
 			channel.CurrentBuildID = &currentBuildID.Int64
 		}
+		if candidateBuildID.Valid {
+			channel.CandidateBuildID = &candidateBuildID.Int64
+		}
+		if expiresAt.Valid {
+			channel.ExpiresAt = &expiresAt.Time
+		}
 
 		channels = append(channels, channel)
 	}
@@ -433,16 +792,71 @@ func (d *SQLiteDatabase) GetChannelsByUploadID(uploadID int64) ([]*Channel, erro
 	return channels, nil
 }
 
+func (d *SQLiteDatabase) ListChannelsByGameID(gameID int64, opts ListOptions) ([]*Channel, error) {
+	q := &listQuery{}
+	q.where("u.game_id = " + q.arg(gameID))
+	clauses, err := q.clauses(opts, channelListColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT c.id, c.name, c.upload_id, c.current_build_id, c.candidate_build_id, c.rollout_percent, c.rollout_paused,
+		       c.expires_at, c.created_at, c.updated_at
+		FROM channels c
+		JOIN uploads u ON u.id = c.upload_id`+clauses, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*Channel
+	for rows.Next() {
+		channel := &Channel{}
+		var currentBuildID, candidateBuildID sql.NullInt64
+		var expiresAt sql.NullTime
+
+		err := rows.Scan(&channel.ID, &channel.Name, &channel.UploadID, &currentBuildID,
+			&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+			&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if currentBuildID.Valid {
+			channel.CurrentBuildID = &currentBuildID.Int64
+		}
+		if candidateBuildID.Valid {
+			channel.CandidateBuildID = &candidateBuildID.Int64
+		}
+		if expiresAt.Valid {
+			channel.ExpiresAt = &expiresAt.Time
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
 func (d *SQLiteDatabase) CreateChannel(channel *Channel) error {
-	var currentBuildID interface{}
+	var currentBuildID, candidateBuildID, expiresAt interface{}
 	if channel.CurrentBuildID != nil {
 		currentBuildID = *channel.CurrentBuildID
 	}
+	if channel.CandidateBuildID != nil {
+		candidateBuildID = *channel.CandidateBuildID
+	}
+	if channel.ExpiresAt != nil {
+		expiresAt = channel.ExpiresAt.UTC()
+	}
 
 	result, err := d.db.Exec(`
-		INSERT INTO channels (name, upload_id, current_build_id, created_at, updated_at)
-		VALUES (?, ?, ?, datetime('now'), datetime('now'))`,
-		channel.Name, channel.UploadID, currentBuildID)
+		INSERT INTO channels (name, upload_id, current_build_id, candidate_build_id, rollout_percent, rollout_paused,
+		                      expires_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
+		channel.Name, channel.UploadID, currentBuildID, candidateBuildID, channel.RolloutPercent, channel.RolloutPaused,
+		expiresAt)
 	if err != nil {
 		return err
 	}
@@ -456,18 +870,316 @@ func (d *SQLiteDatabase) CreateChannel(channel *Channel) error {
 }
 
 func (d *SQLiteDatabase) UpdateChannel(channel *Channel) error {
-	var currentBuildID interface{}
+	var currentBuildID, candidateBuildID, expiresAt interface{}
 	if channel.CurrentBuildID != nil {
 		currentBuildID = *channel.CurrentBuildID
 	}
+	if channel.CandidateBuildID != nil {
+		candidateBuildID = *channel.CandidateBuildID
+	}
+	if channel.ExpiresAt != nil {
+		expiresAt = channel.ExpiresAt.UTC()
+	}
 
 	_, err := d.db.Exec(`
-		UPDATE channels SET name = ?, upload_id = ?, current_build_id = ?, updated_at = datetime('now')
+		UPDATE channels SET name = ?, upload_id = ?, current_build_id = ?, candidate_build_id = ?,
+		       rollout_percent = ?, rollout_paused = ?, expires_at = ?, updated_at = datetime('now')
 		WHERE id = ?`,
-		channel.Name, channel.UploadID, currentBuildID, channel.ID)
+		channel.Name, channel.UploadID, currentBuildID, candidateBuildID,
+		channel.RolloutPercent, channel.RolloutPaused, expiresAt, channel.ID)
 	return err
 }
 
+func (d *SQLiteDatabase) GetChannelByID(id int64) (*Channel, error) {
+	channel := &Channel{}
+	var currentBuildID, candidateBuildID sql.NullInt64
+	var expiresAt sql.NullTime
+
+	err := d.db.QueryRow(`
+		SELECT id, name, upload_id, current_build_id, candidate_build_id, rollout_percent, rollout_paused,
+		       expires_at, created_at, updated_at
+		FROM channels WHERE id = ?`, id).Scan(
+		&channel.ID, &channel.Name, &channel.UploadID, &currentBuildID,
+		&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+		&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if currentBuildID.Valid {
+		channel.CurrentBuildID = &currentBuildID.Int64
+	}
+	if candidateBuildID.Valid {
+		channel.CandidateBuildID = &candidateBuildID.Int64
+	}
+	if expiresAt.Valid {
+		channel.ExpiresAt = &expiresAt.Time
+	}
+
+	return channel, nil
+}
+
+func (d *SQLiteDatabase) GetExpiringChannels() ([]*Channel, error) {
+	rows, err := d.db.Query(`
+		SELECT id, name, upload_id, current_build_id, candidate_build_id, rollout_percent, rollout_paused,
+		       expires_at, created_at, updated_at
+		FROM channels WHERE expires_at IS NOT NULL ORDER BY expires_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*Channel
+	for rows.Next() {
+		channel := &Channel{}
+		var currentBuildID, candidateBuildID sql.NullInt64
+		var expiresAt sql.NullTime
+
+		err := rows.Scan(&channel.ID, &channel.Name, &channel.UploadID, &currentBuildID,
+			&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+			&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if currentBuildID.Valid {
+			channel.CurrentBuildID = &currentBuildID.Int64
+		}
+		if candidateBuildID.Valid {
+			channel.CandidateBuildID = &candidateBuildID.Int64
+		}
+		if expiresAt.Valid {
+			channel.ExpiresAt = &expiresAt.Time
+		}
+
+		channels = append(channels, channel)
+	}
+
+	return channels, rows.Err()
+}
+
+func (d *SQLiteDatabase) DeleteChannel(id int64) error {
+	return execInTx(d.db,
+		statement{`DELETE FROM channel_protections WHERE channel_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM scheduled_releases WHERE channel_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM channel_history WHERE channel_id = ?`, []interface{}{id}},
+		statement{`DELETE FROM channels WHERE id = ?`, []interface{}{id}},
+	)
+}
+
+// ChannelTTLRule database methods
+func (d *SQLiteDatabase) GetChannelTTLRules(gameID int64) ([]*ChannelTTLRule, error) {
+	rows, err := d.db.Query(`
+		SELECT id, game_id, pattern, ttl_seconds, created_at
+		FROM channel_ttl_rules WHERE game_id = ? ORDER BY position, id`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*ChannelTTLRule
+	for rows.Next() {
+		rule := &ChannelTTLRule{}
+		if err := rows.Scan(&rule.ID, &rule.GameID, &rule.Pattern, &rule.TTLSeconds, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (d *SQLiteDatabase) SetChannelTTLRules(gameID int64, rules []*ChannelTTLRule) error {
+	statements := []statement{{`DELETE FROM channel_ttl_rules WHERE game_id = ?`, []interface{}{gameID}}}
+	for i, rule := range rules {
+		statements = append(statements, statement{`
+			INSERT INTO channel_ttl_rules (game_id, position, pattern, ttl_seconds, created_at)
+			VALUES (?, ?, ?, ?, datetime('now'))`, []interface{}{gameID, i, rule.Pattern, rule.TTLSeconds}})
+	}
+	return execInTx(d.db, statements...)
+}
+
+// ChannelProtection database methods
+func (d *SQLiteDatabase) GetChannelProtection(channelID int64) (*ChannelProtection, error) {
+	protection := &ChannelProtection{}
+	var requiredLabels string
+
+	err := d.db.QueryRow(`
+		SELECT id, channel_id, restrict_push, user_version_pattern, promotion_only, required_labels, created_at, updated_at
+		FROM channel_protections WHERE channel_id = ?`, channelID).Scan(
+		&protection.ID, &protection.ChannelID, &protection.RestrictPush,
+		&protection.UserVersionPattern, &protection.PromotionOnly, &requiredLabels,
+		&protection.CreatedAt, &protection.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	protection.RequiredLabels = decodeStringList(requiredLabels)
+	return protection, nil
+}
+
+func (d *SQLiteDatabase) SaveChannelProtection(protection *ChannelProtection) error {
+	_, err := d.db.Exec(`
+		INSERT INTO channel_protections (channel_id, restrict_push, user_version_pattern, promotion_only, required_labels, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, datetime('now'), datetime('now'))
+		ON CONFLICT(channel_id) DO UPDATE SET
+			restrict_push = excluded.restrict_push,
+			user_version_pattern = excluded.user_version_pattern,
+			promotion_only = excluded.promotion_only,
+			required_labels = excluded.required_labels,
+			updated_at = datetime('now')`,
+		protection.ChannelID, protection.RestrictPush,
+		protection.UserVersionPattern, protection.PromotionOnly, encodeStringList(protection.RequiredLabels))
+	if err != nil {
+		return err
+	}
+
+	return d.db.QueryRow(`
+		SELECT id, created_at, updated_at FROM channel_protections WHERE channel_id = ?`,
+		protection.ChannelID).Scan(&protection.ID, &protection.CreatedAt, &protection.UpdatedAt)
+}
+
+func (d *SQLiteDatabase) DeleteChannelProtection(channelID int64) error {
+	_, err := d.db.Exec(`DELETE FROM channel_protections WHERE channel_id = ?`, channelID)
+	return err
+}
+
+// ScheduledRelease database methods
+func (d *SQLiteDatabase) CreateScheduledRelease(release *ScheduledRelease) error {
+	result, err := d.db.Exec(`
+		INSERT INTO scheduled_releases (channel_id, build_id, release_at, state, created_by, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`,
+		release.ChannelID, release.BuildID, release.ReleaseAt.UTC(), release.State, release.CreatedBy, release.Error)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	release.ID = id
+
+	return d.db.QueryRow(`SELECT created_at, updated_at FROM scheduled_releases WHERE id = ?`, id).Scan(
+		&release.CreatedAt, &release.UpdatedAt)
+}
+
+func (d *SQLiteDatabase) GetScheduledReleaseByID(id int64) (*ScheduledRelease, error) {
+	release := &ScheduledRelease{}
+	err := d.db.QueryRow(`
+		SELECT id, channel_id, build_id, release_at, state, created_by, error, created_at, updated_at
+		FROM scheduled_releases WHERE id = ?`, id).Scan(
+		&release.ID, &release.ChannelID, &release.BuildID, &release.ReleaseAt, &release.State,
+		&release.CreatedBy, &release.Error, &release.CreatedAt, &release.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+func (d *SQLiteDatabase) GetScheduledReleasesByChannelID(channelID int64) ([]*ScheduledRelease, error) {
+	return d.queryScheduledReleases(`
+		SELECT id, channel_id, build_id, release_at, state, created_by, error, created_at, updated_at
+		FROM scheduled_releases WHERE channel_id = ? ORDER BY release_at, id`, channelID)
+}
+
+func (d *SQLiteDatabase) GetPendingScheduledReleases() ([]*ScheduledRelease, error) {
+	return d.queryScheduledReleases(`
+		SELECT id, channel_id, build_id, release_at, state, created_by, error, created_at, updated_at
+		FROM scheduled_releases WHERE state = ? ORDER BY release_at, id`, ReleaseStatePending)
+}
+
+func (d *SQLiteDatabase) queryScheduledReleases(query string, args ...interface{}) ([]*ScheduledRelease, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var releases []*ScheduledRelease
+	for rows.Next() {
+		release := &ScheduledRelease{}
+		err := rows.Scan(&release.ID, &release.ChannelID, &release.BuildID, &release.ReleaseAt, &release.State,
+			&release.CreatedBy, &release.Error, &release.CreatedAt, &release.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	return releases, rows.Err()
+}
+
+func (d *SQLiteDatabase) SetScheduledReleaseState(id int64, from, to, errorMessage string) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE scheduled_releases SET state = ?, error = ?, updated_at = datetime('now')
+		WHERE id = ? AND state = ?`, to, errorMessage, id, from)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ChannelHistory database methods
+func (d *SQLiteDatabase) CreateChannelHistoryEntry(entry *ChannelHistoryEntry) error {
+	var previousBuildID, buildID interface{}
+	if entry.PreviousBuildID != nil {
+		previousBuildID = *entry.PreviousBuildID
+	}
+	if entry.BuildID != nil {
+		buildID = *entry.BuildID
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO channel_history (channel_id, previous_build_id, build_id, reason, username, created_at)
+		VALUES (?, ?, ?, ?, ?, datetime('now'))`,
+		entry.ChannelID, previousBuildID, buildID, entry.Reason, entry.Username)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = id
+	return nil
+}
+
+func (d *SQLiteDatabase) GetChannelHistory(channelID int64) ([]*ChannelHistoryEntry, error) {
+	rows, err := d.db.Query(`
+		SELECT id, channel_id, previous_build_id, build_id, reason, username, created_at
+		FROM channel_history WHERE channel_id = ? ORDER BY id DESC`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*ChannelHistoryEntry
+	for rows.Next() {
+		entry := &ChannelHistoryEntry{}
+		var previousBuildID, buildID sql.NullInt64
+
+		err := rows.Scan(&entry.ID, &entry.ChannelID, &previousBuildID, &buildID,
+			&entry.Reason, &entry.Username, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if previousBuildID.Valid {
+			entry.PreviousBuildID = &previousBuildID.Int64
+		}
+		if buildID.Valid {
+			entry.BuildID = &buildID.Int64
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
 // UploadSession methods removed - using MinIO presigned URLs instead
 
 // Initialize database with migrations
@@ -495,6 +1207,10 @@ CREATE TABLE IF NOT EXISTS games (
     type TEXT DEFAULT 'default',
     classification TEXT DEFAULT 'game',
     url TEXT,
+    version_policy TEXT DEFAULT '',
+    web_channel TEXT DEFAULT 'web',
+    default_channel TEXT DEFAULT '',
+    visibility TEXT DEFAULT 'public',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id)
@@ -510,6 +1226,8 @@ CREATE TABLE IF NOT EXISTS uploads (
     storage TEXT DEFAULT 'hosted',
     type TEXT DEFAULT 'default',
     platforms TEXT DEFAULT '[]',
+    architectures TEXT DEFAULT '[]',
+    platforms_locked BOOLEAN DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (game_id) REFERENCES games(id)
@@ -522,6 +1240,8 @@ CREATE TABLE IF NOT EXISTS builds (
     user_version TEXT,
     parent_build_id INTEGER,
     state TEXT DEFAULT 'started',
+    unpacked BOOLEAN DEFAULT 0,
+    release_notes TEXT DEFAULT '',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (upload_id) REFERENCES uploads(id),
@@ -549,13 +1269,91 @@ CREATE TABLE IF NOT EXISTS channels (
     name TEXT NOT NULL,
     upload_id INTEGER NOT NULL,
     current_build_id INTEGER,
+    candidate_build_id INTEGER,
+    rollout_percent INTEGER DEFAULT 0,
+    rollout_paused BOOLEAN DEFAULT 0,
+    expires_at DATETIME,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (upload_id) REFERENCES uploads(id),
     FOREIGN KEY (current_build_id) REFERENCES builds(id),
+    FOREIGN KEY (candidate_build_id) REFERENCES builds(id),
     UNIQUE(name, upload_id)
 );
 
+-- Create channel_protections table
+CREATE TABLE IF NOT EXISTS channel_protections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel_id INTEGER UNIQUE NOT NULL,
+    restrict_push BOOLEAN DEFAULT 0,
+    user_version_pattern TEXT DEFAULT '',
+    promotion_only BOOLEAN DEFAULT 0,
+    required_labels TEXT DEFAULT '[]',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+-- Create channel_ttl_rules table
+CREATE TABLE IF NOT EXISTS channel_ttl_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    game_id INTEGER NOT NULL,
+    position INTEGER DEFAULT 0,
+    pattern TEXT NOT NULL,
+    ttl_seconds INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (game_id) REFERENCES games(id)
+);
+
+-- Create scheduled_releases table
+CREATE TABLE IF NOT EXISTS scheduled_releases (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel_id INTEGER NOT NULL,
+    build_id INTEGER NOT NULL,
+    release_at DATETIME NOT NULL,
+    state TEXT DEFAULT 'pending',
+    created_by TEXT DEFAULT '',
+    error TEXT DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(id),
+    FOREIGN KEY (build_id) REFERENCES builds(id)
+);
+
+-- Create channel_history table
+CREATE TABLE IF NOT EXISTS channel_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel_id INTEGER NOT NULL,
+    previous_build_id INTEGER,
+    build_id INTEGER,
+    reason TEXT NOT NULL,
+    username TEXT DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (channel_id) REFERENCES channels(id)
+);
+
+-- Create build_metadata table
+CREATE TABLE IF NOT EXISTS build_metadata (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    build_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (build_id) REFERENCES builds(id),
+    UNIQUE (build_id, key)
+);
+
+-- Create build_labels table
+CREATE TABLE IF NOT EXISTS build_labels (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    build_id INTEGER NOT NULL,
+    label TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (build_id) REFERENCES builds(id),
+    UNIQUE (build_id, label)
+);
+
 -- Create upload_sessions table
 CREATE TABLE IF NOT EXISTS upload_sessions (
     id TEXT PRIMARY KEY,
@@ -576,8 +1374,118 @@ CREATE INDEX IF NOT EXISTS idx_builds_upload_id ON builds(upload_id);
 CREATE INDEX IF NOT EXISTS idx_build_files_build_id ON build_files(build_id);
 CREATE INDEX IF NOT EXISTS idx_channels_name ON channels(name);
 CREATE INDEX IF NOT EXISTS idx_upload_sessions_build_file_id ON upload_sessions(build_file_id);
+CREATE INDEX IF NOT EXISTS idx_scheduled_releases_state ON scheduled_releases(state);
+CREATE INDEX IF NOT EXISTS idx_channel_history_channel_id ON channel_history(channel_id);
+CREATE INDEX IF NOT EXISTS idx_build_metadata_value ON build_metadata(value);
+CREATE INDEX IF NOT EXISTS idx_build_labels_label ON build_labels(label);
 	`
 
 	_, err := d.db.Exec(migrationSQL)
+	if err != nil {
+		return err
+	}
+
+	// Columns added after the initial schema, for databases created before them
+	columns := []struct{ table, column, definition string }{
+		{"games", "version_policy", "TEXT DEFAULT ''"},
+		{"builds", "unpacked", "BOOLEAN DEFAULT 0"},
+		{"games", "web_channel", "TEXT DEFAULT 'web'"},
+		{"uploads", "architectures", "TEXT DEFAULT '[]'"},
+		{"channels", "candidate_build_id", "INTEGER REFERENCES builds(id)"},
+		{"channels", "rollout_percent", "INTEGER DEFAULT 0"},
+		{"channels", "rollout_paused", "BOOLEAN DEFAULT 0"},
+		{"channels", "expires_at", "DATETIME"},
+		{"builds", "release_notes", "TEXT DEFAULT ''"},
+		{"channel_protections", "required_labels", "TEXT DEFAULT '[]'"},
+		{"uploads", "platforms_locked", "BOOLEAN DEFAULT 0"},
+		{"games", "visibility", "TEXT DEFAULT 'public'"},
+		{"games", "default_channel", "TEXT DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if err := d.addColumnIfMissing(c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+
+	return d.migrateGameSearch()
+}
+
+// migrateGameSearch sets up the games_fts full text index, kept up to date by
+// triggers. FTS5 needs the sqlite_fts5 build tag of go-sqlite3; without it the
+// triggers are dropped and SearchGames falls back to LIKE matching.
+func (d *SQLiteDatabase) migrateGameSearch() error {
+	var fts5 bool
+	if err := d.db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5); err != nil {
+		return err
+	}
+	if !fts5 {
+		fmt.Printf("Warning: SQLite was built without FTS5 (build with -tags sqlite_fts5), game search falls back to LIKE matching\n")
+		_, err := d.db.Exec(`
+DROP TRIGGER IF EXISTS games_fts_insert;
+DROP TRIGGER IF EXISTS games_fts_update;
+DROP TRIGGER IF EXISTS games_fts_delete;
+DROP TRIGGER IF EXISTS games_fts_username;
+		`)
+		return err
+	}
+
+	_, err := d.db.Exec(`
+CREATE VIRTUAL TABLE IF NOT EXISTS games_fts USING fts5(title, short_text, username);
+
+CREATE TRIGGER IF NOT EXISTS games_fts_insert AFTER INSERT ON games BEGIN
+    INSERT INTO games_fts (rowid, title, short_text, username)
+    SELECT new.id, new.title, COALESCE(new.short_text, ''), username FROM users WHERE id = new.user_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS games_fts_update AFTER UPDATE OF title, short_text, user_id ON games BEGIN
+    DELETE FROM games_fts WHERE rowid = old.id;
+    INSERT INTO games_fts (rowid, title, short_text, username)
+    SELECT new.id, new.title, COALESCE(new.short_text, ''), username FROM users WHERE id = new.user_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS games_fts_delete AFTER DELETE ON games BEGIN
+    DELETE FROM games_fts WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS games_fts_username AFTER UPDATE OF username ON users BEGIN
+    UPDATE games_fts SET username = new.username WHERE rowid IN (SELECT id FROM games WHERE user_id = new.id);
+END;
+
+-- Rebuild the index, in case games changed while running a build without FTS5
+DELETE FROM games_fts;
+INSERT INTO games_fts (rowid, title, short_text, username)
+SELECT g.id, g.title, COALESCE(g.short_text, ''), u.username FROM games g JOIN users u ON g.user_id = u.id;
+	`)
+	if err != nil {
+		return err
+	}
+	d.fullText = true
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already there
+func (d *SQLiteDatabase) addColumnIfMissing(table, column, definition string) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	return err
 }
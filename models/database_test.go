@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestDeleteGameAcrossUploads(t *testing.T) {
+	// Foreign keys are enforced here, as they are on Postgres
+	db, err := NewSQLiteDatabase(t.TempDir() + "/test.db?_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	user := &User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &Game{UserID: user.ID, Title: "space-game", Visibility: GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+
+	// The second upload's build is patched on top of the first upload's, and
+	// the first upload sorts first, so deleting upload by upload would fail
+	var builds []*Build
+	var parentID *int64
+	for _, filename := range []string{"windows.zip", "linux.zip"} {
+		upload := &Upload{GameID: game.ID, Filename: filename}
+		if err := db.CreateUpload(upload); err != nil {
+			t.Fatalf("failed to create upload: %v", err)
+		}
+		build := &Build{UploadID: upload.ID, ParentBuildID: parentID, UserVersion: "1.0.0", State: "completed"}
+		if err := db.CreateBuild(build); err != nil {
+			t.Fatalf("failed to create build: %v", err)
+		}
+		if err := db.CreateBuildFile(&BuildFile{BuildID: build.ID, Type: "patch", SubType: "default", State: "uploaded"}); err != nil {
+			t.Fatalf("failed to create build file: %v", err)
+		}
+		if err := db.AddBuildLabels(build.ID, []string{"stable"}); err != nil {
+			t.Fatalf("failed to add build labels: %v", err)
+		}
+		channel := &Channel{Name: "main", UploadID: upload.ID, CurrentBuildID: &build.ID}
+		if err := db.CreateChannel(channel); err != nil {
+			t.Fatalf("failed to create channel: %v", err)
+		}
+		if err := db.CreateChannelHistoryEntry(&ChannelHistoryEntry{ChannelID: channel.ID, BuildID: &build.ID, Reason: "push", Username: user.Username}); err != nil {
+			t.Fatalf("failed to create channel history entry: %v", err)
+		}
+		builds = append(builds, build)
+		parentID = &build.ID
+	}
+
+	if err := db.DeleteGame(game.ID); err != nil {
+		t.Fatalf("failed to delete game: %v", err)
+	}
+
+	if _, _, err := db.GetGameByID(game.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("game still there after delete: %v", err)
+	}
+	for _, build := range builds {
+		if _, err := db.GetBuildByID(build.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("build %d still there after delete: %v", build.ID, err)
+		}
+		if _, err := db.GetUploadByID(build.UploadID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("upload %d still there after delete: %v", build.UploadID, err)
+		}
+	}
+	var rows int
+	if err := db.db.QueryRow(`SELECT (SELECT COUNT(*) FROM channels) + (SELECT COUNT(*) FROM channel_history) + (SELECT COUNT(*) FROM build_files) + (SELECT COUNT(*) FROM build_labels)`).Scan(&rows); err != nil {
+		t.Fatalf("failed to count rows: %v", err)
+	}
+	if rows != 0 {
+		t.Errorf("%d channel and build rows left after delete", rows)
+	}
+}
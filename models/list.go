@@ -0,0 +1,249 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ListOptions are the paging and ordering of a list query. Rows are sorted by
+// the Sort column with ties broken by id, and start after the After cursor.
+type ListOptions struct {
+	Limit      int    // 0 for no limit
+	Sort       string // column to sort by, "id" if empty; each List method names the ones it accepts
+	Descending bool
+	After      *ListCursor
+}
+
+// ListCursor is the position of a row in a sorted list: its value of the sort
+// column and its id. Timestamps are given in RFC 3339 format.
+type ListCursor struct {
+	Value string
+	ID    int64
+}
+
+// BuildFilter narrows down ListBuilds. Fields left empty don't filter.
+type BuildFilter struct {
+	State         string
+	UserVersion   string
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+}
+
+// GameSearch is a full text search of games by title, short text and owner
+// username. Only public games are listed, along with the games of
+// IncludeUserID; AllGames lists games of any visibility, for admins.
+type GameSearch struct {
+	Query         string
+	IncludeUserID int64
+	AllGames      bool
+}
+
+// GameSearchResult is a game found by SearchGames. Owner only has its id,
+// username and display name set. Lower ranks are better matches.
+type GameSearchResult struct {
+	Game  *Game
+	Owner *User
+	Rank  float64
+}
+
+// searchTerms splits a search query into words, dropping punctuation so the
+// words can be put into FTS5 and tsquery expressions as they are
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// listColumn is a column lists can be sorted by
+type listColumn struct {
+	column string
+	time   bool
+	number bool
+}
+
+// Columns each list can be sorted by, keyed by sort name
+var (
+	gameListColumns = map[string]listColumn{
+		"id":         {column: "id"},
+		"title":      {column: "title"},
+		"created_at": {column: "created_at", time: true},
+	}
+	uploadListColumns = map[string]listColumn{
+		"id":         {column: "id"},
+		"filename":   {column: "filename"},
+		"created_at": {column: "created_at", time: true},
+	}
+	buildListColumns = map[string]listColumn{
+		"id":         {column: "id"},
+		"created_at": {column: "created_at", time: true},
+	}
+	channelListColumns = map[string]listColumn{
+		"id":         {column: "c.id"},
+		"name":       {column: "c.name"},
+		"created_at": {column: "c.created_at", time: true},
+	}
+	// Search results are selected from a subquery with the rank as score
+	gameSearchColumns = map[string]listColumn{
+		"id":         {column: "id"},
+		"title":      {column: "title"},
+		"created_at": {column: "created_at", time: true},
+		"relevance":  {column: "score", number: true},
+	}
+)
+
+// listQuery collects the conditions and arguments of a filtered, keyset
+// paginated SELECT, with ? placeholders for SQLite or $n ones for Postgres
+type listQuery struct {
+	postgres   bool
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds a query argument and returns its placeholder
+func (q *listQuery) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	if q.postgres {
+		return fmt.Sprintf("$%d", len(q.args))
+	}
+	return "?"
+}
+
+// timeColumn and timeArg make timestamps comparable. SQLite stores them as
+// text in more than one format, so both sides go through datetime(); Postgres
+// TIMESTAMP columns have no zone, so the argument's zone is dropped.
+func (q *listQuery) timeColumn(column string) string {
+	if q.postgres {
+		return column
+	}
+	return fmt.Sprintf("datetime(%s)", column)
+}
+
+func (q *listQuery) timeArg(t time.Time) string {
+	if q.postgres {
+		return fmt.Sprintf("CAST(%s AS TIMESTAMP)", q.arg(t.UTC()))
+	}
+	return fmt.Sprintf("datetime(%s)", q.arg(t.UTC()))
+}
+
+// where adds a condition the rows must match
+func (q *listQuery) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// clauses returns the WHERE, ORDER BY and LIMIT clauses for opts, adding the
+// cursor condition. columns are the ones the list can be sorted by.
+func (q *listQuery) clauses(opts ListOptions, columns map[string]listColumn) (string, error) {
+	sortName := opts.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	sortColumn, ok := columns[sortName]
+	if !ok {
+		return "", fmt.Errorf("can't sort by %s", sortName)
+	}
+	idColumn := columns["id"].column
+
+	sortExpr := sortColumn.column
+	if sortColumn.time {
+		sortExpr = q.timeColumn(sortColumn.column)
+	}
+
+	cmp, direction := ">", "ASC"
+	if opts.Descending {
+		cmp, direction = "<", "DESC"
+	}
+
+	if opts.After != nil {
+		if sortName == "id" {
+			q.where(fmt.Sprintf("%s %s %s", idColumn, cmp, q.arg(opts.After.ID)))
+		} else {
+			var first, second string
+			if sortColumn.time {
+				t, err := time.Parse(time.RFC3339Nano, opts.After.Value)
+				if err != nil {
+					return "", fmt.Errorf("invalid cursor time '%s'", opts.After.Value)
+				}
+				first, second = q.timeArg(t), q.timeArg(t)
+			} else if sortColumn.number {
+				f, err := strconv.ParseFloat(opts.After.Value, 64)
+				if err != nil {
+					return "", fmt.Errorf("invalid cursor number '%s'", opts.After.Value)
+				}
+				first, second = q.arg(f), q.arg(f)
+			} else {
+				first, second = q.arg(opts.After.Value), q.arg(opts.After.Value)
+			}
+			q.where(fmt.Sprintf("(%s %s %s OR (%s = %s AND %s %s %s))",
+				sortExpr, cmp, first, sortExpr, second, idColumn, cmp, q.arg(opts.After.ID)))
+		}
+	}
+
+	var clauses strings.Builder
+	if len(q.conditions) > 0 {
+		clauses.WriteString(" WHERE " + strings.Join(q.conditions, " AND "))
+	}
+	if sortName == "id" {
+		fmt.Fprintf(&clauses, " ORDER BY %s %s", idColumn, direction)
+	} else {
+		fmt.Fprintf(&clauses, " ORDER BY %s %s, %s %s", sortExpr, direction, idColumn, direction)
+	}
+	if opts.Limit > 0 {
+		clauses.WriteString(" LIMIT " + q.arg(opts.Limit))
+	}
+	return clauses.String(), nil
+}
+
+// buildFilterConditions adds the conditions of a build filter to a query
+func (q *listQuery) buildFilterConditions(filter BuildFilter) {
+	if filter.State != "" {
+		q.where("state = " + q.arg(filter.State))
+	}
+	if filter.UserVersion != "" {
+		q.where("user_version = " + q.arg(filter.UserVersion))
+	}
+	if filter.CreatedAfter != nil {
+		q.where(fmt.Sprintf("%s >= %s", q.timeColumn("created_at"), q.timeArg(*filter.CreatedAfter)))
+	}
+	if filter.CreatedBefore != nil {
+		q.where(fmt.Sprintf("%s < %s", q.timeColumn("created_at"), q.timeArg(*filter.CreatedBefore)))
+	}
+}
+
+// gameVisibilityCondition adds the visibility condition of a game search, on
+// the columns of the search subquery
+func (q *listQuery) gameVisibilityCondition(search GameSearch) {
+	if search.AllGames {
+		return
+	}
+	condition := "visibility = " + q.arg(GameVisibilityPublic)
+	if search.IncludeUserID != 0 {
+		condition = fmt.Sprintf("(%s OR user_id = %s)", condition, q.arg(search.IncludeUserID))
+	}
+	q.where(condition)
+}
+
+// scanGameSearchResults reads the rows of a game search, selected as the game
+// columns followed by the owner's username and display name and the score
+func scanGameSearchResults(rows *sql.Rows) ([]*GameSearchResult, error) {
+	defer rows.Close()
+
+	var results []*GameSearchResult
+	for rows.Next() {
+		game := &Game{}
+		owner := &User{}
+		result := &GameSearchResult{Game: game, Owner: owner}
+		err := rows.Scan(&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type,
+			&game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt,
+			&owner.Username, &owner.DisplayName, &result.Rank)
+		if err != nil {
+			return nil, err
+		}
+		owner.ID = game.UserID
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,349 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDB returns a migrated SQLite database in a temporary directory
+func newTestDB(t *testing.T) *SQLiteDatabase {
+	t.Helper()
+	db, err := NewSQLiteDatabase(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestListQueryClauses(t *testing.T) {
+	cursorTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	tests := []struct {
+		name     string
+		postgres bool
+		opts     ListOptions
+		columns  map[string]listColumn
+		want     string
+		wantArgs []interface{}
+		wantErr  string
+	}{
+		{
+			name:    "default sort",
+			columns: gameListColumns,
+			want:    " ORDER BY id ASC",
+		},
+		{
+			name:     "id cursor descending with limit",
+			columns:  gameListColumns,
+			opts:     ListOptions{Descending: true, Limit: 10, After: &ListCursor{ID: 7}},
+			want:     " WHERE id < ? ORDER BY id DESC LIMIT ?",
+			wantArgs: []interface{}{int64(7), 10},
+		},
+		{
+			name:     "text cursor breaks ties by id",
+			columns:  uploadListColumns,
+			opts:     ListOptions{Sort: "filename", After: &ListCursor{Value: "game.zip", ID: 3}},
+			want:     " WHERE (filename > ? OR (filename = ? AND id > ?)) ORDER BY filename ASC, id ASC",
+			wantArgs: []interface{}{"game.zip", "game.zip", int64(3)},
+		},
+		{
+			name:     "sqlite time cursor",
+			columns:  buildListColumns,
+			opts:     ListOptions{Sort: "created_at", Descending: true, After: &ListCursor{Value: cursorTime.Format(time.RFC3339), ID: 3}},
+			want:     " WHERE (datetime(created_at) < datetime(?) OR (datetime(created_at) = datetime(?) AND id < ?)) ORDER BY datetime(created_at) DESC, id DESC",
+			wantArgs: []interface{}{cursorTime.UTC(), cursorTime.UTC(), int64(3)},
+		},
+		{
+			name:     "postgres time cursor",
+			postgres: true,
+			columns:  channelListColumns,
+			opts:     ListOptions{Sort: "created_at", After: &ListCursor{Value: cursorTime.Format(time.RFC3339), ID: 3}, Limit: 5},
+			want:     " WHERE (c.created_at > CAST($1 AS TIMESTAMP) OR (c.created_at = CAST($2 AS TIMESTAMP) AND c.id > $3)) ORDER BY c.created_at ASC, c.id ASC LIMIT $4",
+			wantArgs: []interface{}{cursorTime.UTC(), cursorTime.UTC(), int64(3), 5},
+		},
+		{
+			name:     "number cursor",
+			postgres: true,
+			columns:  gameSearchColumns,
+			opts:     ListOptions{Sort: "relevance", After: &ListCursor{Value: "-1.5", ID: 9}},
+			want:     " WHERE (score > $1 OR (score = $2 AND id > $3)) ORDER BY score ASC, id ASC",
+			wantArgs: []interface{}{-1.5, -1.5, int64(9)},
+		},
+		{
+			name:    "unknown sort",
+			columns: buildListColumns,
+			opts:    ListOptions{Sort: "title"},
+			wantErr: "can't sort by title",
+		},
+		{
+			name:    "invalid cursor time",
+			columns: buildListColumns,
+			opts:    ListOptions{Sort: "created_at", After: &ListCursor{Value: "2024-05-01 12:00:00", ID: 1}},
+			wantErr: "invalid cursor time",
+		},
+		{
+			name:    "invalid cursor number",
+			columns: gameSearchColumns,
+			opts:    ListOptions{Sort: "relevance", After: &ListCursor{Value: "high", ID: 1}},
+			wantErr: "invalid cursor number",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &listQuery{postgres: tt.postgres}
+			got, err := q.clauses(tt.opts, tt.columns)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected clauses\n  %s\ngot\n  %s", tt.want, got)
+			}
+			if !reflect.DeepEqual(q.args, tt.wantArgs) {
+				t.Errorf("expected args %v, got %v", tt.wantArgs, q.args)
+			}
+		})
+	}
+}
+
+func TestListBuildsCursors(t *testing.T) {
+	db := newTestDB(t)
+
+	user := &User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &Game{UserID: user.ID, Title: "space-game", Visibility: GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+	upload := &Upload{GameID: game.ID, Filename: "game.zip"}
+	if err := db.CreateUpload(upload); err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+
+	// Builds are created with datetime('now'); some are moved to other times
+	// stored as other text formats, and several share a second
+	createdAt := []interface{}{
+		nil,
+		"2024-05-01 10:00:00",
+		time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+		"2024-05-01T12:00:00+02:00", // the same second as the one before
+		"2024-05-01 10:00:00",
+		nil,
+		time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+	}
+	for _, value := range createdAt {
+		build := &Build{UploadID: upload.ID, UserVersion: "1.0.0", State: "completed"}
+		if err := db.CreateBuild(build); err != nil {
+			t.Fatalf("failed to create build: %v", err)
+		}
+		if value != nil {
+			if _, err := db.db.Exec("UPDATE builds SET created_at = ? WHERE id = ?", value, build.ID); err != nil {
+				t.Fatalf("failed to set created_at: %v", err)
+			}
+		}
+	}
+
+	all, err := db.ListBuilds(upload.ID, BuildFilter{}, ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list builds: %v", err)
+	}
+	if len(all) != len(createdAt) {
+		t.Fatalf("expected %d builds, got %d", len(createdAt), len(all))
+	}
+
+	tests := []struct {
+		sort       string
+		descending bool
+	}{
+		{sort: "id"},
+		{sort: "id", descending: true},
+		{sort: "created_at"},
+		{sort: "created_at", descending: true},
+	}
+
+	for _, tt := range tests {
+		name := tt.sort
+		if tt.descending {
+			name = "-" + name
+		}
+		t.Run(name, func(t *testing.T) {
+			// The order every page put together has to follow: by second, then id
+			want := append([]*Build(nil), all...)
+			sort.Slice(want, func(i, j int) bool {
+				a, b := want[i], want[j]
+				if tt.descending {
+					a, b = b, a
+				}
+				if tt.sort == "created_at" {
+					at, bt := a.CreatedAt.UTC().Truncate(time.Second), b.CreatedAt.UTC().Truncate(time.Second)
+					if !at.Equal(bt) {
+						return at.Before(bt)
+					}
+				}
+				return a.ID < b.ID
+			})
+
+			var got []*Build
+			opts := ListOptions{Sort: tt.sort, Descending: tt.descending, Limit: 2}
+			for page := 0; page <= len(all); page++ {
+				builds, err := db.ListBuilds(upload.ID, BuildFilter{}, opts)
+				if err != nil {
+					t.Fatalf("failed to list page %d: %v", page, err)
+				}
+				if len(builds) == 0 {
+					break
+				}
+				got = append(got, builds...)
+
+				// The cursor is made the way list endpoints make it
+				last := builds[len(builds)-1]
+				opts.After = &ListCursor{Value: last.CreatedAt.UTC().Format(time.RFC3339Nano), ID: last.ID}
+			}
+
+			var wantIDs, gotIDs []int64
+			for _, build := range want {
+				wantIDs = append(wantIDs, build.ID)
+			}
+			for _, build := range got {
+				gotIDs = append(gotIDs, build.ID)
+			}
+			if !reflect.DeepEqual(gotIDs, wantIDs) {
+				t.Fatalf("expected builds %v across pages, got %v", wantIDs, gotIDs)
+			}
+		})
+	}
+}
+
+func TestListUploadsTiedCursor(t *testing.T) {
+	db := newTestDB(t)
+
+	user := &User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &Game{UserID: user.ID, Title: "space-game", Visibility: GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+
+	var ids []int64
+	for _, filename := range []string{"b.zip", "a.zip", "b.zip", "b.zip", "c.zip"} {
+		upload := &Upload{GameID: game.ID, Filename: filename}
+		if err := db.CreateUpload(upload); err != nil {
+			t.Fatalf("failed to create upload: %v", err)
+		}
+		ids = append(ids, upload.ID)
+	}
+
+	// Starting in the middle of the b.zip uploads picks up after that id
+	got, err := db.ListUploadsByGameID(game.ID, ListOptions{Sort: "filename", After: &ListCursor{Value: "b.zip", ID: ids[2]}})
+	if err != nil {
+		t.Fatalf("failed to list uploads: %v", err)
+	}
+	var gotIDs []int64
+	for _, upload := range got {
+		gotIDs = append(gotIDs, upload.ID)
+	}
+	if want := []int64{ids[3], ids[4]}; !reflect.DeepEqual(gotIDs, want) {
+		t.Fatalf("expected uploads %v, got %v", want, gotIDs)
+	}
+
+	got, err = db.ListUploadsByGameID(game.ID, ListOptions{Sort: "filename", Descending: true, After: &ListCursor{Value: "b.zip", ID: ids[2]}})
+	if err != nil {
+		t.Fatalf("failed to list uploads: %v", err)
+	}
+	gotIDs = nil
+	for _, upload := range got {
+		gotIDs = append(gotIDs, upload.ID)
+	}
+	if want := []int64{ids[0], ids[1]}; !reflect.DeepEqual(gotIDs, want) {
+		t.Fatalf("expected uploads %v, got %v", want, gotIDs)
+	}
+}
+
+func TestFindBuildsByMetadata(t *testing.T) {
+	db := newTestDB(t)
+
+	user := &User{Username: "alice", APIKey: "key", Role: "user", IsActive: true}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	game := &Game{UserID: user.ID, Title: "space-game", Visibility: GameVisibilityPublic}
+	if err := db.CreateGame(game); err != nil {
+		t.Fatalf("failed to create game: %v", err)
+	}
+
+	// Builds spread over two uploads, with metadata that only differs in case
+	// or contains LIKE wildcards
+	metadata := []map[string]string{
+		{"git_sha": "abc123"},
+		{"git_sha": "ABC123"},
+		{"git_sha": "abd999", "branch": "abc-feature"},
+		{"branch": "50%_off"},
+		{"git_sha": "abc456"},
+		{"branch": "50xyoff"},
+	}
+	var ids []int64
+	for i, values := range metadata {
+		upload := &Upload{GameID: game.ID, Filename: []string{"windows.zip", "linux.zip"}[i%2]}
+		if err := db.CreateUpload(upload); err != nil {
+			t.Fatalf("failed to create upload: %v", err)
+		}
+		build := &Build{UploadID: upload.ID, State: "completed"}
+		if err := db.CreateBuild(build); err != nil {
+			t.Fatalf("failed to create build: %v", err)
+		}
+		if err := db.UpdateBuildMetadata(build.ID, values, nil); err != nil {
+			t.Fatalf("failed to set metadata: %v", err)
+		}
+		ids = append(ids, build.ID)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		opts  ListOptions
+		want  []int64
+	}{
+		{name: "prefix is case-sensitive", key: "git_sha", value: "abc", opts: ListOptions{Descending: true}, want: []int64{ids[4], ids[0]}},
+		{name: "upper case prefix", key: "git_sha", value: "ABC", want: []int64{ids[1]}},
+		{name: "any key", value: "abc", want: []int64{ids[0], ids[2], ids[4]}},
+		{name: "wildcards match literally", key: "branch", value: "50%_", want: []int64{ids[3]}},
+		{name: "non-ascii prefix", key: "git_sha", value: "äbc", want: nil},
+		{name: "first page", value: "ab", opts: ListOptions{Descending: true, Limit: 2}, want: []int64{ids[4], ids[2]}},
+		{name: "next page", value: "ab", opts: ListOptions{Descending: true, Limit: 2, After: &ListCursor{ID: ids[2]}}, want: []int64{ids[0]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builds, err := db.FindBuildsByMetadata(game.ID, tt.key, tt.value, tt.opts)
+			if err != nil {
+				t.Fatalf("failed to find builds: %v", err)
+			}
+			var got []int64
+			for _, build := range builds {
+				got = append(got, build.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected builds %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,10 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -41,24 +45,64 @@ type Game struct {
 	Type           string    `json:"type" db:"type"`
 	Classification string    `json:"classification" db:"classification"`
 	URL            string    `json:"url" db:"url"`
+	VersionPolicy  string    `json:"version_policy" db:"version_policy"`
+	WebChannel     string    `json:"web_channel" db:"web_channel"`         // channel served as a web game for html games
+	DefaultChannel string    `json:"default_channel" db:"default_channel"` // channel clients get when they don't name one
+	Visibility     string    `json:"visibility" db:"visibility"`
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// Game types
+const (
+	GameTypeDefault = "default"
+	GameTypeHTML    = "html" // played in the browser from the unpacked head of the web channel
+)
+
+// Game visibilities. Public and unlisted games can be read by anyone who has
+// their id, but only public ones are listed; private games are only readable
+// by their owner and admins.
+const (
+	GameVisibilityPrivate  = "private"
+	GameVisibilityUnlisted = "unlisted"
+	GameVisibilityPublic   = "public"
+)
+
+// GameVisibilities are the visibilities a game can have
+var GameVisibilities = []string{GameVisibilityPrivate, GameVisibilityUnlisted, GameVisibilityPublic}
+
+// VisibleTo returns true if the user may read the game. The user is nil for
+// anonymous requests.
+func (g *Game) VisibleTo(user *User) bool {
+	if g.Visibility != GameVisibilityPrivate {
+		return true
+	}
+	return user != nil && (user.IsAdmin() || user.ID == g.UserID)
+}
+
+// GameClassifications are the kinds of projects a game can be classified as
+var GameClassifications = []string{"game", "tool", "assets", "game_mod", "physical_game", "soundtrack", "other", "comic", "book"}
+
 // Upload represents a file upload for a game
 type Upload struct {
-	ID          int64     `json:"id" db:"id"`
-	GameID      int64     `json:"game_id" db:"game_id"`
-	Filename    string    `json:"filename" db:"filename"`
-	DisplayName string    `json:"display_name" db:"display_name"`
-	Size        int64     `json:"size" db:"size"`
-	Storage     string    `json:"storage" db:"storage"`
-	Type        string    `json:"type" db:"type"`
-	Platforms   string    `json:"platforms" db:"platforms"` // JSON array as string
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID              int64     `json:"id" db:"id"`
+	GameID          int64     `json:"game_id" db:"game_id"`
+	Filename        string    `json:"filename" db:"filename"`
+	DisplayName     string    `json:"display_name" db:"display_name"`
+	Size            int64     `json:"size" db:"size"`
+	Storage         string    `json:"storage" db:"storage"`
+	Type            string    `json:"type" db:"type"`
+	Platforms       []string  `json:"platforms" db:"platforms"`
+	Architectures   []string  `json:"architectures" db:"architectures"`
+	PlatformsLocked bool      `json:"platforms_locked" db:"platforms_locked"` // set by the owner, processing doesn't detect them
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// UploadTypes are the kinds of files an upload can be
+var UploadTypes = []string{"default", "html", "soundtrack", "book", "video", "documentation", "mod",
+	"audio_assets", "graphical_assets", "sourcecode", "other"}
+
 // Build represents a wharf build
 type Build struct {
 	ID            int64     `json:"id" db:"id"`
@@ -66,6 +110,8 @@ type Build struct {
 	UserVersion   string    `json:"user_version" db:"user_version"`
 	ParentBuildID *int64    `json:"parent_build_id" db:"parent_build_id"`
 	State         string    `json:"state" db:"state"`
+	Unpacked      bool      `json:"unpacked" db:"unpacked"`           // files are stored individually under builds/{id}/content/
+	ReleaseNotes  string    `json:"release_notes" db:"release_notes"` // markdown
 	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -86,12 +132,119 @@ type BuildFile struct {
 
 // Channel represents a wharf channel
 type Channel struct {
-	ID             int64     `json:"id" db:"id"`
-	Name           string    `json:"name" db:"name"`
-	UploadID       int64     `json:"upload_id" db:"upload_id"`
-	CurrentBuildID *int64    `json:"current_build_id" db:"current_build_id"`
-	CreatedAt      time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+	ID               int64      `json:"id" db:"id"`
+	Name             string     `json:"name" db:"name"`
+	UploadID         int64      `json:"upload_id" db:"upload_id"`
+	CurrentBuildID   *int64     `json:"current_build_id" db:"current_build_id"`
+	CandidateBuildID *int64     `json:"candidate_build_id" db:"candidate_build_id"` // build being rolled out to part of the installs
+	RolloutPercent   int        `json:"rollout_percent" db:"rollout_percent"`
+	RolloutPaused    bool       `json:"rollout_paused" db:"rollout_paused"`
+	ExpiresAt        *time.Time `json:"expires_at" db:"expires_at"` // ephemeral channels are deleted once expired
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ChannelProtection holds the push restrictions for a channel
+type ChannelProtection struct {
+	ID                 int64     `json:"id" db:"id"`
+	ChannelID          int64     `json:"channel_id" db:"channel_id"`
+	RestrictPush       bool      `json:"restrict_push" db:"restrict_push"` // only admins may put builds on the channel
+	UserVersionPattern string    `json:"user_version_pattern" db:"user_version_pattern"`
+	PromotionOnly      bool      `json:"promotion_only" db:"promotion_only"`
+	RequiredLabels     []string  `json:"required_labels" db:"required_labels"` // labels a build needs before it can go on the channel
+	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ChannelTTLRule gives channels whose name matches Pattern an expiry of TTLSeconds after each push
+type ChannelTTLRule struct {
+	ID         int64     `json:"id" db:"id"`
+	GameID     int64     `json:"game_id" db:"game_id"`
+	Pattern    string    `json:"pattern" db:"pattern"` // regular expression matched against channel names
+	TTLSeconds int64     `json:"ttl_seconds" db:"ttl_seconds"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Scheduled release states
+const (
+	ReleaseStatePending   = "pending"
+	ReleaseStateApplied   = "applied"
+	ReleaseStateCancelled = "cancelled"
+	ReleaseStateFailed    = "failed"
+)
+
+// ScheduledRelease is a pending change of a channel's head at a set time
+type ScheduledRelease struct {
+	ID        int64     `json:"id" db:"id"`
+	ChannelID int64     `json:"channel_id" db:"channel_id"`
+	BuildID   int64     `json:"build_id" db:"build_id"`
+	ReleaseAt time.Time `json:"release_at" db:"release_at"`
+	State     string    `json:"state" db:"state"`
+	CreatedBy string    `json:"created_by" db:"created_by"`
+	Error     string    `json:"error,omitempty" db:"error"` // why a failed release couldn't be applied
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Reasons a channel's head changed, as recorded in its history
+const (
+	HeadChangePush     = "push"
+	HeadChangePromote  = "promote"
+	HeadChangeRollout  = "rollout"
+	HeadChangeSchedule = "schedule"
+)
+
+// ChannelHistoryEntry records one change of a channel's head
+type ChannelHistoryEntry struct {
+	ID              int64     `json:"id" db:"id"`
+	ChannelID       int64     `json:"channel_id" db:"channel_id"`
+	PreviousBuildID *int64    `json:"previous_build_id" db:"previous_build_id"`
+	BuildID         *int64    `json:"build_id" db:"build_id"`
+	Reason          string    `json:"reason" db:"reason"`
+	Username        string    `json:"username" db:"username"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// CheckPush returns an error describing why the user may not put a build with
+// the given user version and labels on the channel. Promoted is true when the
+// build is being promoted from another channel rather than pushed.
+func (p *ChannelProtection) CheckPush(user *User, channelName, userVersion string, labels []string, promoted bool) error {
+	if p.RestrictPush && !user.IsAdmin() {
+		return fmt.Errorf("channel '%s' is protected: only admins may update it", channelName)
+	}
+
+	if p.PromotionOnly && !promoted {
+		return fmt.Errorf("channel '%s' is protected: builds must be promoted from another channel instead of pushed", channelName)
+	}
+
+	if p.UserVersionPattern != "" {
+		pattern, err := regexp.Compile(p.UserVersionPattern)
+		if err != nil {
+			return fmt.Errorf("channel '%s' has an invalid user_version pattern: %v", channelName, err)
+		}
+		if !pattern.MatchString(userVersion) {
+			return fmt.Errorf("channel '%s' is protected: user_version '%s' does not match required pattern '%s'",
+				channelName, userVersion, p.UserVersionPattern)
+		}
+	}
+
+	for _, required := range p.RequiredLabels {
+		if !Contains(labels, required) {
+			return fmt.Errorf("channel '%s' is protected: builds need the '%s' label", channelName, required)
+		}
+	}
+
+	return nil
+}
+
+// Contains returns true if value is one of the strings in list
+func Contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
 
 // Database interface for testing
@@ -107,19 +260,57 @@ type Database interface {
 	// Games
 	GetGameByID(id int64) (*User, *Game, error)
 	GetGamesByUserID(userID int64) ([]*Game, error)
+	// ListGamesByUserID lists a user's games a page at a time, sorted by id, title or created_at
+	ListGamesByUserID(userID int64, opts ListOptions) ([]*Game, error)
 	GetGameByUserAndTitle(userID int64, title string) (*Game, error)
 	CreateGame(game *Game) error
+	SetGameVersionPolicy(gameID int64, policy string) error
+	SetGameWebSettings(gameID int64, gameType, webChannel string) error
+	// UpdateGame saves the title, short text, type, classification, URL and visibility of a game
+	UpdateGame(game *Game) error
+	// DeleteGame deletes a game with its uploads, channels, builds and channel TTL rules in one transaction.
+	DeleteGame(id int64) error
+	// SearchGames finds games matching all words of a query, as prefixes, a page at a
+	// time. Results are sorted by relevance, id, title or created_at.
+	SearchGames(search GameSearch, opts ListOptions) ([]*GameSearchResult, error)
 
 	// Uploads
 	GetUploadByID(id int64) (*Upload, error)
 	GetUploadsByGameID(gameID int64) ([]*Upload, error)
+	// ListUploadsByGameID lists a game's uploads a page at a time, sorted by id, filename or created_at
+	ListUploadsByGameID(gameID int64, opts ListOptions) ([]*Upload, error)
 	CreateUpload(upload *Upload) error
+	UpdateUploadPlatforms(uploadID int64, platforms, architectures []string) error
+	// UpdateUpload saves the names, type and platforms of an upload
+	UpdateUpload(upload *Upload) error
+	DeleteUpload(id int64) error
 
 	// Builds
 	GetBuildByID(id int64) (*Build, error)
+	// GetBuildsByUploadID returns all builds of an upload, newest first
 	GetBuildsByUploadID(uploadID int64) ([]*Build, error)
+	// ListBuilds lists the builds of an upload matching filter a page at a time, sorted by id or created_at
+	ListBuilds(uploadID int64, filter BuildFilter, opts ListOptions) ([]*Build, error)
 	CreateBuild(build *Build) error
 	UpdateBuild(build *Build) error
+	// DeleteBuild deletes a build with its build files, metadata, labels and scheduled releases
+	DeleteBuild(id int64) error
+
+	// Build Metadata, free-form key/value pairs such as the git commit a build was made from
+	GetBuildMetadata(buildID int64) (map[string]string, error)
+	GetBuildMetadataByUploadID(uploadID int64) (map[int64]map[string]string, error)
+	// UpdateBuildMetadata sets the given keys of a build's metadata and removes the keys in remove
+	UpdateBuildMetadata(buildID int64, set map[string]string, remove []string) error
+	// FindBuildsByMetadata lists a game's builds with a metadata value starting
+	// with value, case-sensitively. An empty key matches any key. Sorts: id, created_at.
+	FindBuildsByMetadata(gameID int64, key, value string, opts ListOptions) ([]*Build, error)
+
+	// Build Labels
+	GetBuildLabels(buildID int64) ([]string, error)
+	GetBuildLabelsByUploadID(uploadID int64) (map[int64][]string, error)
+	AddBuildLabels(buildID int64, labels []string) error
+	// RemoveBuildLabel reports false if the build didn't have the label
+	RemoveBuildLabel(buildID int64, label string) (bool, error)
 
 	// Build Files
 	GetBuildFileByID(id int64) (*BuildFile, error)
@@ -130,8 +321,36 @@ type Database interface {
 	// Channels
 	GetChannelByName(name string, uploadID int64) (*Channel, error)
 	GetChannelsByUploadID(uploadID int64) ([]*Channel, error)
+	// ListChannelsByGameID lists the channels of all of a game's uploads a page at a time, sorted by id, name or created_at
+	ListChannelsByGameID(gameID int64, opts ListOptions) ([]*Channel, error)
 	CreateChannel(channel *Channel) error
 	UpdateChannel(channel *Channel) error
+	GetChannelByID(id int64) (*Channel, error)
+	GetExpiringChannels() ([]*Channel, error)
+	// DeleteChannel deletes a channel with its protection, scheduled releases and history
+	DeleteChannel(id int64) error
+
+	// Channel TTL Rules, in the order they are tried
+	GetChannelTTLRules(gameID int64) ([]*ChannelTTLRule, error)
+	SetChannelTTLRules(gameID int64, rules []*ChannelTTLRule) error
+
+	// Channel Protections
+	GetChannelProtection(channelID int64) (*ChannelProtection, error)
+	SaveChannelProtection(protection *ChannelProtection) error
+	DeleteChannelProtection(channelID int64) error
+
+	// Scheduled Releases
+	CreateScheduledRelease(release *ScheduledRelease) error
+	GetScheduledReleaseByID(id int64) (*ScheduledRelease, error)
+	GetScheduledReleasesByChannelID(channelID int64) ([]*ScheduledRelease, error)
+	GetPendingScheduledReleases() ([]*ScheduledRelease, error)
+	// SetScheduledReleaseState moves a release from one state to another and
+	// reports false if it was no longer in the from state
+	SetScheduledReleaseState(id int64, from, to, errorMessage string) (bool, error)
+
+	// Channel History
+	CreateChannelHistoryEntry(entry *ChannelHistoryEntry) error
+	GetChannelHistory(channelID int64) ([]*ChannelHistoryEntry, error)
 
 	Close() error
 }
@@ -139,6 +358,8 @@ type Database interface {
 // SQLiteDatabase implements Database interface
 type SQLiteDatabase struct {
 	db *sql.DB
+	// fullText is set by Migrate when SQLite was built with FTS5, see SearchGames
+	fullText bool
 }
 
 // NewSQLiteDatabase creates a new SQLite database connection
@@ -159,3 +380,53 @@ func NewSQLiteDatabase(dbPath string) (*SQLiteDatabase, error) {
 func (d *SQLiteDatabase) Close() error {
 	return d.db.Close()
 }
+
+// encodeStringList serializes a string list for storage in a TEXT column
+func encodeStringList(values []string) string {
+	if len(values) == 0 {
+		return "[]"
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+// decodeStringList parses a string list stored by encodeStringList
+func decodeStringList(data string) []string {
+	values := []string{}
+	if data == "" {
+		return values
+	}
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return []string{}
+	}
+	return values
+}
+
+// statement is one query of a transaction run by execInTx
+type statement struct {
+	query string
+	args  []interface{}
+}
+
+// execInTx runs the statements in order inside a single transaction
+func execInTx(db *sql.DB, statements ...statement) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, st := range statements {
+		if _, err := tx.Exec(st.query, st.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// likePrefix builds a LIKE pattern, used with ESCAPE '\', matching values that start with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
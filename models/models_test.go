@@ -0,0 +1,44 @@
+package models
+
+import "testing"
+
+func TestCheckPush(t *testing.T) {
+	owner := &User{ID: 1, Username: "alice", Role: "user"}
+	admin := &User{ID: 2, Username: "root", Role: "admin"}
+
+	tests := []struct {
+		name        string
+		protection  ChannelProtection
+		user        *User
+		userVersion string
+		labels      []string
+		promoted    bool
+		wantErr     bool
+	}{
+		{name: "unprotected", user: owner, userVersion: "1.0.0"},
+		{name: "restricted for the owner", protection: ChannelProtection{RestrictPush: true}, user: owner, wantErr: true},
+		{name: "restricted promotion for the owner", protection: ChannelProtection{RestrictPush: true}, user: owner, promoted: true, wantErr: true},
+		{name: "restricted for an admin", protection: ChannelProtection{RestrictPush: true}, user: admin},
+		{name: "promotion only push", protection: ChannelProtection{PromotionOnly: true}, user: owner, wantErr: true},
+		{name: "promotion only promotion", protection: ChannelProtection{PromotionOnly: true}, user: owner, promoted: true},
+		{name: "promotion only binds admins", protection: ChannelProtection{PromotionOnly: true}, user: admin, wantErr: true},
+		{name: "matching version", protection: ChannelProtection{UserVersionPattern: `^\d+\.\d+\.\d+$`}, user: owner, userVersion: "1.2.3"},
+		{name: "mismatching version", protection: ChannelProtection{UserVersionPattern: `^\d+\.\d+\.\d+$`}, user: owner, userVersion: "nightly", wantErr: true},
+		{name: "invalid pattern", protection: ChannelProtection{UserVersionPattern: "("}, user: owner, userVersion: "1.2.3", wantErr: true},
+		{name: "required labels present", protection: ChannelProtection{RequiredLabels: []string{"qa", "stable"}}, user: owner, labels: []string{"stable", "qa", "extra"}, promoted: true},
+		{name: "required label missing", protection: ChannelProtection{RequiredLabels: []string{"qa", "stable"}}, user: owner, labels: []string{"qa"}, promoted: true, wantErr: true},
+		{name: "required labels on a push", protection: ChannelProtection{RequiredLabels: []string{"qa"}}, user: admin, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.protection.CheckPush(tt.user, "main", tt.userVersion, tt.labels, tt.promoted)
+			if tt.wantErr && err == nil {
+				t.Errorf("CheckPush() succeeded, want an error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("CheckPush() failed: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Platforms, named like itch.io does
+const (
+	PlatformWindows = "windows"
+	PlatformLinux   = "linux"
+	PlatformOSX     = "osx"
+)
+
+// Architectures, named like Go does
+const (
+	Arch386   = "386"
+	ArchAMD64 = "amd64"
+	ArchARM   = "arm"
+	ArchARM64 = "arm64"
+)
+
+// ExecutableInfo is what an executable's header says about where it runs
+type ExecutableInfo struct {
+	Platform string
+	Archs    []string // empty if unknown, several for universal binaries
+	Script   bool     // shell scripts are weaker evidence than binaries
+}
+
+// SniffExecutable identifies PE, ELF and Mach-O binaries and shebang scripts
+// from the first bytes of a file. It returns false for anything else.
+func SniffExecutable(header []byte) (ExecutableInfo, bool) {
+	switch {
+	case len(header) >= 2 && header[0] == 'M' && header[1] == 'Z':
+		return sniffPE(header)
+	case bytes.HasPrefix(header, []byte("\x7fELF")):
+		return sniffELF(header)
+	case bytes.HasPrefix(header, []byte("#!")):
+		return ExecutableInfo{Platform: PlatformLinux, Script: true}, true
+	}
+
+	if len(header) >= 8 {
+		switch binary.LittleEndian.Uint32(header) {
+		case 0xfeedface, 0xfeedfacf:
+			info := ExecutableInfo{Platform: PlatformOSX}
+			if arch := machOArch(binary.LittleEndian.Uint32(header[4:])); arch != "" {
+				info.Archs = []string{arch}
+			}
+			return info, true
+		}
+		// Universal binaries share their magic with Java class files, which
+		// have a version number >= 45 where the architecture count would be
+		if binary.BigEndian.Uint32(header) == 0xcafebabe && binary.BigEndian.Uint32(header[4:]) < 20 {
+			return sniffUniversal(header), true
+		}
+	}
+
+	return ExecutableInfo{}, false
+}
+
+func sniffUniversal(header []byte) ExecutableInfo {
+	info := ExecutableInfo{Platform: PlatformOSX}
+	count := int(binary.BigEndian.Uint32(header[4:]))
+	for i := 0; i < count; i++ {
+		offset := 8 + i*20
+		if len(header) < offset+4 {
+			break
+		}
+		if arch := machOArch(binary.BigEndian.Uint32(header[offset:])); arch != "" {
+			info.Archs = appendUnique(info.Archs, arch)
+		}
+	}
+	return info
+}
+
+func sniffPE(header []byte) (ExecutableInfo, bool) {
+	info := ExecutableInfo{Platform: PlatformWindows}
+	if len(header) < 0x40 {
+		return info, true
+	}
+	peOffset := int(binary.LittleEndian.Uint32(header[0x3c:]))
+	if peOffset < 0 || len(header) < peOffset+6 || !bytes.Equal(header[peOffset:peOffset+4], []byte("PE\x00\x00")) {
+		return info, true
+	}
+	switch binary.LittleEndian.Uint16(header[peOffset+4:]) {
+	case 0x14c:
+		info.Archs = []string{Arch386}
+	case 0x8664:
+		info.Archs = []string{ArchAMD64}
+	case 0x1c4:
+		info.Archs = []string{ArchARM}
+	case 0xaa64:
+		info.Archs = []string{ArchARM64}
+	}
+	return info, true
+}
+
+func sniffELF(header []byte) (ExecutableInfo, bool) {
+	info := ExecutableInfo{Platform: PlatformLinux}
+	if len(header) < 20 {
+		return info, true
+	}
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if header[5] == 2 {
+		byteOrder = binary.BigEndian
+	}
+	switch byteOrder.Uint16(header[18:]) {
+	case 3:
+		info.Archs = []string{Arch386}
+	case 62:
+		info.Archs = []string{ArchAMD64}
+	case 40:
+		info.Archs = []string{ArchARM}
+	case 183:
+		info.Archs = []string{ArchARM64}
+	}
+	return info, true
+}
+
+func machOArch(cpuType uint32) string {
+	switch cpuType {
+	case 7:
+		return Arch386
+	case 0x01000007:
+		return ArchAMD64
+	case 12:
+		return ArchARM
+	case 0x0100000c:
+		return ArchARM64
+	}
+	return ""
+}
+
+// PlatformFromPath guesses the platform of a build file from its path alone:
+// .exe files, .app bundles and the extensions engines give Linux executables
+func PlatformFromPath(filePath string) (ExecutableInfo, bool) {
+	if strings.Contains(filePath, ".app/Contents/MacOS/") {
+		return ExecutableInfo{Platform: PlatformOSX}, true
+	}
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".exe":
+		return ExecutableInfo{Platform: PlatformWindows}, true
+	case ".x86_64":
+		return ExecutableInfo{Platform: PlatformLinux, Archs: []string{ArchAMD64}}, true
+	case ".x86":
+		return ExecutableInfo{Platform: PlatformLinux, Archs: []string{Arch386}}, true
+	case ".sh":
+		return ExecutableInfo{Platform: PlatformLinux, Script: true}, true
+	}
+	return ExecutableInfo{}, false
+}
+
+// channelTokens maps parts of channel names to the platforms and architectures they imply
+var channelTokens = map[string][]string{
+	"win":       {PlatformWindows},
+	"windows":   {PlatformWindows},
+	"win32":     {PlatformWindows, Arch386},
+	"win64":     {PlatformWindows, ArchAMD64},
+	"linux":     {PlatformLinux},
+	"linux32":   {PlatformLinux, Arch386},
+	"linux64":   {PlatformLinux, ArchAMD64},
+	"mac":       {PlatformOSX},
+	"macos":     {PlatformOSX},
+	"osx":       {PlatformOSX},
+	"darwin":    {PlatformOSX},
+	"universal": {PlatformOSX, ArchAMD64, ArchARM64},
+	"32":        {Arch386},
+	"x86":       {Arch386},
+	"386":       {Arch386},
+	"i386":      {Arch386},
+	"64":        {ArchAMD64},
+	"x64":       {ArchAMD64},
+	"amd64":     {ArchAMD64},
+	"arm":       {ArchARM},
+	"arm64":     {ArchARM64},
+	"aarch64":   {ArchARM64},
+}
+
+// PlatformsFromChannel applies butler's channel naming conventions, such as
+// "windows-64" or "osx-universal", to guess platforms and architectures
+func PlatformsFromChannel(channelName string) (platforms, archs []string) {
+	// "x86_64" is the one token that contains a separator
+	name := strings.ReplaceAll(strings.ToLower(channelName), "x86_64", "amd64")
+	tokens := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_' || r == '.' || r == ' '
+	})
+
+	for _, token := range tokens {
+		matches := channelTokens[token]
+		for _, m := range matches {
+			if IsPlatform(m) {
+				platforms = appendUnique(platforms, m)
+			} else {
+				archs = appendUnique(archs, m)
+			}
+		}
+	}
+
+	sort.Strings(platforms)
+	sort.Strings(archs)
+	return platforms, archs
+}
+
+// KnownPlatforms and KnownArchitectures are the values uploads may list
+var (
+	KnownPlatforms     = []string{PlatformWindows, PlatformLinux, PlatformOSX}
+	KnownArchitectures = []string{Arch386, ArchAMD64, ArchARM, ArchARM64}
+)
+
+// IsPlatform reports whether name is one of the known platforms
+func IsPlatform(name string) bool {
+	return Contains(KnownPlatforms, name)
+}
+
+// IsArchitecture reports whether name is one of the known architectures
+func IsArchitecture(name string) bool {
+	return Contains(KnownArchitectures, name)
+}
+
+// ValidatePlatforms returns an error naming the first unknown platform or architecture
+func ValidatePlatforms(platforms, architectures []string) error {
+	for _, p := range platforms {
+		if !IsPlatform(p) {
+			return fmt.Errorf("unknown platform '%s', expected one of %s", p, strings.Join(KnownPlatforms, ", "))
+		}
+	}
+	for _, a := range architectures {
+		if !IsArchitecture(a) {
+			return fmt.Errorf("unknown architecture '%s', expected one of %s", a, strings.Join(KnownArchitectures, ", "))
+		}
+	}
+	return nil
+}
+
+// SupportsPlatform reports whether the upload runs on the given platform and,
+// if arch is set, architecture. Uploads that don't list architectures are
+// assumed to run on any.
+func (u *Upload) SupportsPlatform(platform, arch string) bool {
+	if platform != "" && !Contains(u.Platforms, platform) {
+		return false
+	}
+	if arch != "" && len(u.Architectures) > 0 && !Contains(u.Architectures, arch) {
+		return false
+	}
+	return true
+}
+
+// Architecture match ranks returned by ArchRank, best first
+const (
+	ArchMatchExact      = 0 // the upload lists the client's architecture
+	ArchMatchAny        = 1 // the upload lists no architectures
+	ArchMatchCompatible = 2 // the client can run the upload's architecture through emulation
+)
+
+// compatibleArchs lists what each client architecture can run besides its own
+var compatibleArchs = map[string]map[string][]string{
+	PlatformWindows: {ArchAMD64: {Arch386}, ArchARM64: {ArchAMD64, Arch386}},
+	PlatformLinux:   {ArchAMD64: {Arch386}, ArchARM64: {ArchARM}},
+	PlatformOSX:     {ArchARM64: {ArchAMD64}},
+}
+
+// ArchRank returns how well the upload's architectures fit a client on the
+// given platform and architecture, or false if the client can't run it
+func (u *Upload) ArchRank(platform, arch string) (int, bool) {
+	if len(u.Architectures) == 0 || arch == "" {
+		return ArchMatchAny, true
+	}
+	if Contains(u.Architectures, arch) {
+		return ArchMatchExact, true
+	}
+	for _, compatible := range compatibleArchs[platform][arch] {
+		if Contains(u.Architectures, compatible) {
+			return ArchMatchCompatible, true
+		}
+	}
+	return 0, false
+}
+
+func appendUnique(list []string, value string) []string {
+	if Contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 
 	_ "github.com/lib/pq"
 )
@@ -72,6 +73,10 @@ func (d *PostgresDatabase) migrate() error {
 			type VARCHAR(50) DEFAULT 'default',
 			classification VARCHAR(50) DEFAULT 'game',
 			url VARCHAR(255),
+			version_policy VARCHAR(50) DEFAULT '',
+			web_channel VARCHAR(255) DEFAULT 'web',
+			default_channel VARCHAR(255) DEFAULT '',
+			visibility VARCHAR(20) DEFAULT 'public',
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -84,6 +89,8 @@ func (d *PostgresDatabase) migrate() error {
 			size BIGINT DEFAULT 0,
 			type VARCHAR(50),
 			platforms TEXT,
+			architectures TEXT DEFAULT '[]',
+			platforms_locked BOOLEAN DEFAULT false,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -92,6 +99,10 @@ func (d *PostgresDatabase) migrate() error {
 			upload_id INTEGER REFERENCES uploads(id),
 			name VARCHAR(255) NOT NULL,
 			build_id INTEGER,
+			candidate_build_id INTEGER,
+			rollout_percent INTEGER DEFAULT 0,
+			rollout_paused BOOLEAN DEFAULT false,
+			expires_at TIMESTAMP,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -101,6 +112,8 @@ func (d *PostgresDatabase) migrate() error {
 			parent_build_id INTEGER REFERENCES builds(id),
 			user_version VARCHAR(255),
 			state VARCHAR(50) DEFAULT 'started',
+			unpacked BOOLEAN DEFAULT false,
+			release_notes TEXT DEFAULT '',
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -115,6 +128,61 @@ func (d *PostgresDatabase) migrate() error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS channel_protections (
+			id SERIAL PRIMARY KEY,
+			channel_id INTEGER UNIQUE REFERENCES channels(id),
+			restrict_push BOOLEAN DEFAULT false,
+			user_version_pattern VARCHAR(255) DEFAULT '',
+			promotion_only BOOLEAN DEFAULT false,
+			required_labels TEXT DEFAULT '[]',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS channel_ttl_rules (
+			id SERIAL PRIMARY KEY,
+			game_id INTEGER REFERENCES games(id),
+			position INTEGER DEFAULT 0,
+			pattern VARCHAR(255) NOT NULL,
+			ttl_seconds BIGINT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS scheduled_releases (
+			id SERIAL PRIMARY KEY,
+			channel_id INTEGER REFERENCES channels(id),
+			build_id INTEGER REFERENCES builds(id),
+			release_at TIMESTAMP NOT NULL,
+			state VARCHAR(50) DEFAULT 'pending',
+			created_by VARCHAR(255) DEFAULT '',
+			error TEXT DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS channel_history (
+			id SERIAL PRIMARY KEY,
+			channel_id INTEGER REFERENCES channels(id),
+			previous_build_id INTEGER,
+			build_id INTEGER,
+			reason VARCHAR(50) NOT NULL,
+			username VARCHAR(255) DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS build_metadata (
+			id SERIAL PRIMARY KEY,
+			build_id INTEGER REFERENCES builds(id),
+			key VARCHAR(64) NOT NULL,
+			value TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (build_id, key)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_build_metadata_value ON build_metadata(value text_pattern_ops)`,
+		`CREATE TABLE IF NOT EXISTS build_labels (
+			id SERIAL PRIMARY KEY,
+			build_id INTEGER REFERENCES builds(id),
+			label VARCHAR(64) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (build_id, label)
+		)`,
 		`CREATE TABLE IF NOT EXISTS upload_sessions (
 			id VARCHAR(255) PRIMARY KEY,
 			build_file_id INTEGER REFERENCES build_files(id),
@@ -124,6 +192,44 @@ func (d *PostgresDatabase) migrate() error {
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`ALTER TABLE games ADD COLUMN IF NOT EXISTS version_policy VARCHAR(50) DEFAULT ''`,
+		`ALTER TABLE builds ADD COLUMN IF NOT EXISTS unpacked BOOLEAN DEFAULT false`,
+		`ALTER TABLE games ADD COLUMN IF NOT EXISTS web_channel VARCHAR(255) DEFAULT 'web'`,
+		`ALTER TABLE uploads ADD COLUMN IF NOT EXISTS architectures TEXT DEFAULT '[]'`,
+		`ALTER TABLE channels ADD COLUMN IF NOT EXISTS candidate_build_id INTEGER`,
+		`ALTER TABLE channels ADD COLUMN IF NOT EXISTS rollout_percent INTEGER DEFAULT 0`,
+		`ALTER TABLE channels ADD COLUMN IF NOT EXISTS rollout_paused BOOLEAN DEFAULT false`,
+		`ALTER TABLE channels ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP`,
+		`ALTER TABLE builds ADD COLUMN IF NOT EXISTS release_notes TEXT DEFAULT ''`,
+		`ALTER TABLE channel_protections ADD COLUMN IF NOT EXISTS required_labels TEXT DEFAULT '[]'`,
+		`ALTER TABLE uploads ADD COLUMN IF NOT EXISTS platforms_locked BOOLEAN DEFAULT false`,
+		`ALTER TABLE games ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) DEFAULT 'public'`,
+		`ALTER TABLE games ADD COLUMN IF NOT EXISTS default_channel VARCHAR(255) DEFAULT ''`,
+		// Game search: a weighted tsvector of title, short text and owner username
+		`ALTER TABLE games ADD COLUMN IF NOT EXISTS search_vector TSVECTOR`,
+		`CREATE INDEX IF NOT EXISTS idx_games_search_vector ON games USING GIN (search_vector)`,
+		`CREATE OR REPLACE FUNCTION games_search_vector() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector :=
+				setweight(to_tsvector('simple', COALESCE(NEW.title, '')), 'A') ||
+				setweight(to_tsvector('simple', COALESCE(NEW.short_text, '')), 'B') ||
+				setweight(to_tsvector('simple', COALESCE((SELECT username FROM users WHERE id = NEW.user_id), '')), 'C');
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS games_search_vector ON games`,
+		`CREATE TRIGGER games_search_vector BEFORE INSERT OR UPDATE OF title, short_text, user_id ON games
+			FOR EACH ROW EXECUTE PROCEDURE games_search_vector()`,
+		`CREATE OR REPLACE FUNCTION users_search_vector() RETURNS trigger AS $$
+		BEGIN
+			UPDATE games SET user_id = user_id WHERE user_id = NEW.id;
+			RETURN NEW;
+		END
+		$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS users_search_vector ON users`,
+		`CREATE TRIGGER users_search_vector AFTER UPDATE OF username ON users
+			FOR EACH ROW EXECUTE PROCEDURE users_search_vector()`,
+		`UPDATE games SET user_id = user_id WHERE search_vector IS NULL`,
 	}
 
 	for _, migration := range migrations {
@@ -234,12 +340,12 @@ func (d *PostgresDatabase) GetGameByID(id int64) (*User, *Game, error) {
 
 	err := d.db.QueryRow(`
 		SELECT
-			g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.created_at, g.updated_at,
+			g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.version_policy, g.web_channel, g.default_channel, g.visibility, g.created_at, g.updated_at,
 			u.id, u.username, u.display_name, u.api_key, u.role, u.is_active, u.created_at, u.updated_at
 		FROM games g
 		JOIN users u ON g.user_id = u.id
 		WHERE g.id = $1`, id).Scan(
-		&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type, &game.Classification, &game.URL, &game.CreatedAt, &game.UpdatedAt,
+		&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type, &game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt,
 		&user.ID, &user.Username, &user.DisplayName, &user.APIKey, &user.Role, &user.IsActive, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
@@ -252,9 +358,9 @@ func (d *PostgresDatabase) GetGameByID(id int64) (*User, *Game, error) {
 func (d *PostgresDatabase) GetGameByUserAndTitle(userID int64, title string) (*Game, error) {
 	game := &Game{}
 	err := d.db.QueryRow(`
-		SELECT id, user_id, title, short_text, type, classification, url, created_at, updated_at
+		SELECT id, user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at
 		FROM games WHERE user_id = $1 AND title = $2`, userID, title).Scan(
-		&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type, &game.Classification, &game.URL, &game.CreatedAt, &game.UpdatedAt)
+		&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type, &game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -263,18 +369,74 @@ func (d *PostgresDatabase) GetGameByUserAndTitle(userID int64, title string) (*G
 
 func (d *PostgresDatabase) CreateGame(game *Game) error {
 	err := d.db.QueryRow(`
-		INSERT INTO games (user_id, title, short_text, type, classification, url)
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`,
-		game.UserID, game.Title, game.ShortText, game.Type, game.Classification, game.URL).Scan(
+		INSERT INTO games (user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id, created_at, updated_at`,
+		game.UserID, game.Title, game.ShortText, game.Type, game.Classification, game.URL, game.VersionPolicy, game.WebChannel, game.DefaultChannel, game.Visibility).Scan(
 		&game.ID, &game.CreatedAt, &game.UpdatedAt)
 	return err
 }
 
+func (d *PostgresDatabase) SetGameVersionPolicy(gameID int64, policy string) error {
+	_, err := d.db.Exec(`
+		UPDATE games SET version_policy = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, policy, gameID)
+	return err
+}
+
+func (d *PostgresDatabase) SetGameWebSettings(gameID int64, gameType, webChannel string) error {
+	_, err := d.db.Exec(`
+		UPDATE games SET type = $1, web_channel = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`, gameType, webChannel, gameID)
+	return err
+}
+
+func (d *PostgresDatabase) UpdateGame(game *Game) error {
+	_, err := d.db.Exec(`
+		UPDATE games SET title = $1, short_text = $2, type = $3, classification = $4, url = $5, visibility = $6, default_channel = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8`,
+		game.Title, game.ShortText, game.Type, game.Classification, game.URL, game.Visibility, game.DefaultChannel, game.ID)
+	return err
+}
+
+// DeleteGame deletes a game with all its uploads, channels and builds in one
+// transaction. Parent links are cleared first so builds patched across uploads
+// can be deleted in a single statement.
+func (d *PostgresDatabase) DeleteGame(id int64) error {
+	const uploads = `SELECT id FROM uploads WHERE game_id = $1`
+	const builds = `SELECT id FROM builds WHERE upload_id IN (` + uploads + `)`
+	const channels = `SELECT id FROM channels WHERE upload_id IN (` + uploads + `)`
+	return execInTx(d.db,
+		statement{`DELETE FROM upload_sessions WHERE build_file_id IN (SELECT id FROM build_files WHERE build_id IN (` + builds + `))`, []interface{}{id}},
+		statement{`DELETE FROM build_files WHERE build_id IN (` + builds + `)`, []interface{}{id}},
+		statement{`DELETE FROM build_metadata WHERE build_id IN (` + builds + `)`, []interface{}{id}},
+		statement{`DELETE FROM build_labels WHERE build_id IN (` + builds + `)`, []interface{}{id}},
+		statement{`DELETE FROM scheduled_releases WHERE build_id IN (` + builds + `) OR channel_id IN (` + channels + `)`, []interface{}{id}},
+		statement{`DELETE FROM channel_protections WHERE channel_id IN (` + channels + `)`, []interface{}{id}},
+		statement{`DELETE FROM channel_history WHERE channel_id IN (` + channels + `)`, []interface{}{id}},
+		statement{`DELETE FROM channels WHERE upload_id IN (` + uploads + `)`, []interface{}{id}},
+		statement{`UPDATE builds SET parent_build_id = NULL WHERE upload_id IN (` + uploads + `)`, []interface{}{id}},
+		statement{`DELETE FROM builds WHERE upload_id IN (` + uploads + `)`, []interface{}{id}},
+		statement{`DELETE FROM uploads WHERE game_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM channel_ttl_rules WHERE game_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM games WHERE id = $1`, []interface{}{id}},
+	)
+}
+
 // Upload methods
 func (d *PostgresDatabase) GetUploadsByGameID(gameID int64) ([]*Upload, error) {
+	return d.ListUploadsByGameID(gameID, ListOptions{})
+}
+
+func (d *PostgresDatabase) ListUploadsByGameID(gameID int64, opts ListOptions) ([]*Upload, error) {
+	q := &listQuery{postgres: true}
+	q.where("game_id = " + q.arg(gameID))
+	clauses, err := q.clauses(opts, uploadListColumns)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.db.Query(`
-		SELECT id, game_id, filename, display_name, storage, size, created_at, updated_at
-		FROM uploads WHERE game_id = $1`, gameID)
+		SELECT id, game_id, filename, display_name, storage, size, COALESCE(type, 'default'), COALESCE(platforms, '[]'),
+			COALESCE(architectures, '[]'), COALESCE(platforms_locked, false), created_at, updated_at
+		FROM uploads`+clauses, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -283,42 +445,80 @@ func (d *PostgresDatabase) GetUploadsByGameID(gameID int64) ([]*Upload, error) {
 	var uploads []*Upload
 	for rows.Next() {
 		upload := &Upload{}
+		var platforms, architectures string
 		err := rows.Scan(&upload.ID, &upload.GameID, &upload.Filename, &upload.DisplayName,
-			&upload.Storage, &upload.Size, &upload.CreatedAt, &upload.UpdatedAt)
+			&upload.Storage, &upload.Size, &upload.Type, &platforms, &architectures, &upload.PlatformsLocked,
+			&upload.CreatedAt, &upload.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		upload.Platforms = decodeStringList(platforms)
+		upload.Architectures = decodeStringList(architectures)
 		uploads = append(uploads, upload)
 	}
-	return uploads, nil
+	return uploads, rows.Err()
 }
 
 func (d *PostgresDatabase) CreateUpload(upload *Upload) error {
 	err := d.db.QueryRow(`
-		INSERT INTO uploads (game_id, filename, display_name, storage, size)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at, updated_at`,
-		upload.GameID, upload.Filename, upload.DisplayName, upload.Storage, upload.Size).Scan(
+		INSERT INTO uploads (game_id, filename, display_name, storage, size, type, platforms, architectures, platforms_locked)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at`,
+		upload.GameID, upload.Filename, upload.DisplayName, upload.Storage, upload.Size,
+		upload.Type, encodeStringList(upload.Platforms), encodeStringList(upload.Architectures), upload.PlatformsLocked).Scan(
 		&upload.ID, &upload.CreatedAt, &upload.UpdatedAt)
 	return err
 }
 
+func (d *PostgresDatabase) UpdateUploadPlatforms(uploadID int64, platforms, architectures []string) error {
+	_, err := d.db.Exec(`
+		UPDATE uploads SET platforms = $1, architectures = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $3`,
+		encodeStringList(platforms), encodeStringList(architectures), uploadID)
+	return err
+}
+
+func (d *PostgresDatabase) UpdateUpload(upload *Upload) error {
+	_, err := d.db.Exec(`
+		UPDATE uploads SET filename = $1, display_name = $2, type = $3, platforms = $4, architectures = $5, platforms_locked = $6,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7`,
+		upload.Filename, upload.DisplayName, upload.Type, encodeStringList(upload.Platforms),
+		encodeStringList(upload.Architectures), upload.PlatformsLocked, upload.ID)
+	return err
+}
+
 func (d *PostgresDatabase) GetUploadByID(id int64) (*Upload, error) {
 	upload := &Upload{}
+	var platforms, architectures string
 	err := d.db.QueryRow(`
-		SELECT id, game_id, filename, display_name, storage, size, type, platforms, created_at, updated_at
+		SELECT id, game_id, filename, display_name, storage, size, COALESCE(type, 'default'), COALESCE(platforms, '[]'),
+			COALESCE(architectures, '[]'), COALESCE(platforms_locked, false), created_at, updated_at
 		FROM uploads WHERE id = $1`, id).Scan(
 		&upload.ID, &upload.GameID, &upload.Filename, &upload.DisplayName,
-		&upload.Storage, &upload.Size, &upload.Type, &upload.Platforms, &upload.CreatedAt, &upload.UpdatedAt)
+		&upload.Storage, &upload.Size, &upload.Type, &platforms, &architectures, &upload.PlatformsLocked,
+		&upload.CreatedAt, &upload.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
+	upload.Platforms = decodeStringList(platforms)
+	upload.Architectures = decodeStringList(architectures)
 	return upload, nil
 }
 
 func (d *PostgresDatabase) GetGamesByUserID(userID int64) ([]*Game, error) {
+	return d.ListGamesByUserID(userID, ListOptions{})
+}
+
+func (d *PostgresDatabase) ListGamesByUserID(userID int64, opts ListOptions) ([]*Game, error) {
+	q := &listQuery{postgres: true}
+	q.where("user_id = " + q.arg(userID))
+	clauses, err := q.clauses(opts, gameListColumns)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.db.Query(`
-		SELECT id, user_id, title, short_text, type, classification, url, created_at, updated_at
-		FROM games WHERE user_id = $1`, userID)
+		SELECT id, user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at
+		FROM games`+clauses, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -328,23 +528,64 @@ func (d *PostgresDatabase) GetGamesByUserID(userID int64) ([]*Game, error) {
 	for rows.Next() {
 		game := &Game{}
 		err := rows.Scan(&game.ID, &game.UserID, &game.Title, &game.ShortText, &game.Type,
-			&game.Classification, &game.URL, &game.CreatedAt, &game.UpdatedAt)
+			&game.Classification, &game.URL, &game.VersionPolicy, &game.WebChannel, &game.DefaultChannel, &game.Visibility, &game.CreatedAt, &game.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
 		games = append(games, game)
 	}
-	return games, nil
+	return games, rows.Err()
+}
+
+func (d *PostgresDatabase) SearchGames(search GameSearch, opts ListOptions) ([]*GameSearchResult, error) {
+	terms := searchTerms(search.Query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	q := &listQuery{postgres: true}
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	// ts_rank scores better matches higher, so it's negated to rank them lower
+	results := `
+		SELECT g.id, g.user_id, g.title, g.short_text, g.type, g.classification, g.url, g.version_policy, g.web_channel, g.default_channel, g.visibility, g.created_at, g.updated_at,
+			u.username, u.display_name, -ts_rank(g.search_vector, query)::float8 AS score
+		FROM games g
+		JOIN users u ON g.user_id = u.id
+		CROSS JOIN to_tsquery('simple', ` + q.arg(strings.Join(prefixes, " & ")) + `) AS query
+		WHERE g.search_vector @@ query`
+
+	q.gameVisibilityCondition(search)
+	clauses, err := q.clauses(opts, gameSearchColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, user_id, title, short_text, type, classification, url, version_policy, web_channel, default_channel, visibility, created_at, updated_at,
+			username, display_name, score
+		FROM (`+results+`) AS results`+clauses, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanGameSearchResults(rows)
+}
+
+func (d *PostgresDatabase) DeleteUpload(id int64) error {
+	_, err := d.db.Exec(`DELETE FROM uploads WHERE id = $1`, id)
+	return err
 }
 
 // Build methods
 func (d *PostgresDatabase) GetBuildByID(id int64) (*Build, error) {
 	build := &Build{}
 	err := d.db.QueryRow(`
-		SELECT id, upload_id, parent_build_id, user_version, state, created_at, updated_at
+		SELECT id, upload_id, parent_build_id, user_version, state, unpacked, COALESCE(release_notes, ''), created_at, updated_at
 		FROM builds WHERE id = $1`, id).Scan(
 		&build.ID, &build.UploadID, &build.ParentBuildID, &build.UserVersion,
-		&build.State, &build.CreatedAt, &build.UpdatedAt)
+		&build.State, &build.Unpacked, &build.ReleaseNotes, &build.CreatedAt, &build.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -353,25 +594,38 @@ func (d *PostgresDatabase) GetBuildByID(id int64) (*Build, error) {
 
 func (d *PostgresDatabase) CreateBuild(build *Build) error {
 	err := d.db.QueryRow(`
-		INSERT INTO builds (upload_id, parent_build_id, user_version, state)
-		VALUES ($1, $2, $3, $4) RETURNING id, created_at, updated_at`,
-		build.UploadID, build.ParentBuildID, build.UserVersion, build.State).Scan(
+		INSERT INTO builds (upload_id, parent_build_id, user_version, state, unpacked, release_notes)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`,
+		build.UploadID, build.ParentBuildID, build.UserVersion, build.State, build.Unpacked, build.ReleaseNotes).Scan(
 		&build.ID, &build.CreatedAt, &build.UpdatedAt)
 	return err
 }
 
 func (d *PostgresDatabase) UpdateBuild(build *Build) error {
 	_, err := d.db.Exec(`
-		UPDATE builds SET upload_id = $1, parent_build_id = $2, user_version = $3, state = $4, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $5`,
-		build.UploadID, build.ParentBuildID, build.UserVersion, build.State, build.ID)
+		UPDATE builds SET upload_id = $1, parent_build_id = $2, user_version = $3, state = $4, unpacked = $5, release_notes = $6,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7`,
+		build.UploadID, build.ParentBuildID, build.UserVersion, build.State, build.Unpacked, build.ReleaseNotes, build.ID)
 	return err
 }
 
 func (d *PostgresDatabase) GetBuildsByUploadID(uploadID int64) ([]*Build, error) {
+	return d.ListBuilds(uploadID, BuildFilter{}, ListOptions{Descending: true})
+}
+
+func (d *PostgresDatabase) ListBuilds(uploadID int64, filter BuildFilter, opts ListOptions) ([]*Build, error) {
+	q := &listQuery{postgres: true}
+	q.where("upload_id = " + q.arg(uploadID))
+	q.buildFilterConditions(filter)
+	clauses, err := q.clauses(opts, buildListColumns)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := d.db.Query(`
-		SELECT id, upload_id, parent_build_id, user_version, state, created_at, updated_at
-		FROM builds WHERE upload_id = $1`, uploadID)
+		SELECT id, upload_id, parent_build_id, user_version, state, unpacked, COALESCE(release_notes, ''), created_at, updated_at
+		FROM builds`+clauses, q.args...)
 	if err != nil {
 		return nil, err
 	}
@@ -381,13 +635,189 @@ func (d *PostgresDatabase) GetBuildsByUploadID(uploadID int64) ([]*Build, error)
 	for rows.Next() {
 		build := &Build{}
 		err := rows.Scan(&build.ID, &build.UploadID, &build.ParentBuildID, &build.UserVersion,
-			&build.State, &build.CreatedAt, &build.UpdatedAt)
+			&build.State, &build.Unpacked, &build.ReleaseNotes, &build.CreatedAt, &build.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		builds = append(builds, build)
+	}
+	return builds, rows.Err()
+}
+
+func (d *PostgresDatabase) DeleteBuild(id int64) error {
+	return execInTx(d.db,
+		statement{`DELETE FROM upload_sessions WHERE build_file_id IN (SELECT id FROM build_files WHERE build_id = $1)`, []interface{}{id}},
+		statement{`DELETE FROM build_files WHERE build_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM build_metadata WHERE build_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM build_labels WHERE build_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM scheduled_releases WHERE build_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM builds WHERE id = $1`, []interface{}{id}},
+	)
+}
+
+// BuildMetadata methods
+func (d *PostgresDatabase) GetBuildMetadata(buildID int64) (map[string]string, error) {
+	rows, err := d.db.Query(`
+		SELECT key, value FROM build_metadata WHERE build_id = $1 ORDER BY key`, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		metadata[key] = value
+	}
+	return metadata, rows.Err()
+}
+
+func (d *PostgresDatabase) GetBuildMetadataByUploadID(uploadID int64) (map[int64]map[string]string, error) {
+	rows, err := d.db.Query(`
+		SELECT m.build_id, m.key, m.value FROM build_metadata m
+		JOIN builds b ON b.id = m.build_id
+		WHERE b.upload_id = $1`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := map[int64]map[string]string{}
+	for rows.Next() {
+		var buildID int64
+		var key, value string
+		if err := rows.Scan(&buildID, &key, &value); err != nil {
+			return nil, err
+		}
+		if metadata[buildID] == nil {
+			metadata[buildID] = map[string]string{}
+		}
+		metadata[buildID][key] = value
+	}
+	return metadata, rows.Err()
+}
+
+func (d *PostgresDatabase) UpdateBuildMetadata(buildID int64, set map[string]string, remove []string) error {
+	var statements []statement
+	for key, value := range set {
+		statements = append(statements, statement{`
+			INSERT INTO build_metadata (build_id, key, value)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (build_id, key) DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP`,
+			[]interface{}{buildID, key, value}})
+	}
+	for _, key := range remove {
+		statements = append(statements, statement{`DELETE FROM build_metadata WHERE build_id = $1 AND key = $2`, []interface{}{buildID, key}})
+	}
+	return execInTx(d.db, statements...)
+}
+
+func (d *PostgresDatabase) FindBuildsByMetadata(gameID int64, key, value string, opts ListOptions) ([]*Build, error) {
+	q := &listQuery{postgres: true}
+	gameCondition := "u.game_id = " + q.arg(gameID)
+	var match string
+	if key != "" {
+		match = "m.key = " + q.arg(key) + " AND "
+	}
+	match += fmt.Sprintf(`m.value LIKE %s ESCAPE '\'`, q.arg(likePrefix(value)))
+	found := `
+		SELECT b.id, b.upload_id, b.user_version, b.parent_build_id, b.state, b.unpacked,
+		       COALESCE(b.release_notes, '') AS release_notes, b.created_at, b.updated_at
+		FROM builds b
+		JOIN uploads u ON u.id = b.upload_id
+		WHERE ` + gameCondition + ` AND EXISTS (
+			SELECT 1 FROM build_metadata m WHERE m.build_id = b.id AND ` + match + `)`
+	clauses, err := q.clauses(opts, buildListColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT id, upload_id, user_version, parent_build_id, state, unpacked, release_notes, created_at, updated_at
+		FROM (`+found+`) AS found`+clauses, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var builds []*Build
+	for rows.Next() {
+		build := &Build{}
+		var parentBuildID sql.NullInt64
+		err := rows.Scan(&build.ID, &build.UploadID, &build.UserVersion, &parentBuildID,
+			&build.State, &build.Unpacked, &build.ReleaseNotes, &build.CreatedAt, &build.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if parentBuildID.Valid {
+			build.ParentBuildID = &parentBuildID.Int64
+		}
 		builds = append(builds, build)
 	}
-	return builds, nil
+	return builds, rows.Err()
+}
+
+// BuildLabel methods
+func (d *PostgresDatabase) GetBuildLabels(buildID int64) ([]string, error) {
+	rows, err := d.db.Query(`SELECT label FROM build_labels WHERE build_id = $1 ORDER BY label`, buildID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []string{}
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+func (d *PostgresDatabase) GetBuildLabelsByUploadID(uploadID int64) (map[int64][]string, error) {
+	rows, err := d.db.Query(`
+		SELECT l.build_id, l.label FROM build_labels l
+		JOIN builds b ON b.id = l.build_id
+		WHERE b.upload_id = $1 ORDER BY l.label`, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := map[int64][]string{}
+	for rows.Next() {
+		var buildID int64
+		var label string
+		if err := rows.Scan(&buildID, &label); err != nil {
+			return nil, err
+		}
+		labels[buildID] = append(labels[buildID], label)
+	}
+	return labels, rows.Err()
+}
+
+func (d *PostgresDatabase) AddBuildLabels(buildID int64, labels []string) error {
+	var statements []statement
+	for _, label := range labels {
+		statements = append(statements, statement{`
+			INSERT INTO build_labels (build_id, label) VALUES ($1, $2)
+			ON CONFLICT (build_id, label) DO NOTHING`, []interface{}{buildID, label}})
+	}
+	return execInTx(d.db, statements...)
+}
+
+func (d *PostgresDatabase) RemoveBuildLabel(buildID int64, label string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM build_labels WHERE build_id = $1 AND label = $2`, buildID, label)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
 }
 
 // BuildFile methods
@@ -446,7 +876,8 @@ func (d *PostgresDatabase) UpdateBuildFile(file *BuildFile) error {
 // Channel methods
 func (d *PostgresDatabase) GetChannelsByUploadID(uploadID int64) ([]*Channel, error) {
 	rows, err := d.db.Query(`
-		SELECT id, upload_id, name, build_id, created_at, updated_at
+		SELECT id, upload_id, name, build_id, candidate_build_id, COALESCE(rollout_percent, 0),
+		       COALESCE(rollout_paused, false), expires_at, created_at, updated_at
 		FROM channels WHERE upload_id = $1`, uploadID)
 	if err != nil {
 		return nil, err
@@ -456,50 +887,357 @@ func (d *PostgresDatabase) GetChannelsByUploadID(uploadID int64) ([]*Channel, er
 	var channels []*Channel
 	for rows.Next() {
 		channel := &Channel{}
-		var buildID sql.NullInt64
+		var buildID, candidateBuildID sql.NullInt64
+		var expiresAt sql.NullTime
 		err := rows.Scan(&channel.ID, &channel.UploadID, &channel.Name, &buildID,
-			&channel.CreatedAt, &channel.UpdatedAt)
+			&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+			&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
 		if buildID.Valid {
 			channel.CurrentBuildID = &buildID.Int64
 		}
+		if candidateBuildID.Valid {
+			channel.CandidateBuildID = &candidateBuildID.Int64
+		}
+		if expiresAt.Valid {
+			channel.ExpiresAt = &expiresAt.Time
+		}
 		channels = append(channels, channel)
 	}
 	return channels, nil
 }
 
+func (d *PostgresDatabase) ListChannelsByGameID(gameID int64, opts ListOptions) ([]*Channel, error) {
+	q := &listQuery{postgres: true}
+	q.where("u.game_id = " + q.arg(gameID))
+	clauses, err := q.clauses(opts, channelListColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT c.id, c.upload_id, c.name, c.build_id, c.candidate_build_id, COALESCE(c.rollout_percent, 0),
+		       COALESCE(c.rollout_paused, false), c.expires_at, c.created_at, c.updated_at
+		FROM channels c
+		JOIN uploads u ON u.id = c.upload_id`+clauses, q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*Channel
+	for rows.Next() {
+		channel := &Channel{}
+		var buildID, candidateBuildID sql.NullInt64
+		var expiresAt sql.NullTime
+		err := rows.Scan(&channel.ID, &channel.UploadID, &channel.Name, &buildID,
+			&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+			&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if buildID.Valid {
+			channel.CurrentBuildID = &buildID.Int64
+		}
+		if candidateBuildID.Valid {
+			channel.CandidateBuildID = &candidateBuildID.Int64
+		}
+		if expiresAt.Valid {
+			channel.ExpiresAt = &expiresAt.Time
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
 func (d *PostgresDatabase) GetChannelByName(name string, uploadID int64) (*Channel, error) {
 	channel := &Channel{}
-	var buildID sql.NullInt64
+	var buildID, candidateBuildID sql.NullInt64
+	var expiresAt sql.NullTime
 	err := d.db.QueryRow(`
-		SELECT id, upload_id, name, build_id, created_at, updated_at
+		SELECT id, upload_id, name, build_id, candidate_build_id, COALESCE(rollout_percent, 0),
+		       COALESCE(rollout_paused, false), expires_at, created_at, updated_at
 		FROM channels WHERE name = $1 AND upload_id = $2`, name, uploadID).Scan(
 		&channel.ID, &channel.UploadID, &channel.Name, &buildID,
-		&channel.CreatedAt, &channel.UpdatedAt)
+		&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+		&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
 	if buildID.Valid {
 		channel.CurrentBuildID = &buildID.Int64
 	}
+	if candidateBuildID.Valid {
+		channel.CandidateBuildID = &candidateBuildID.Int64
+	}
+	if expiresAt.Valid {
+		channel.ExpiresAt = &expiresAt.Time
+	}
 	return channel, nil
 }
 
 func (d *PostgresDatabase) CreateChannel(channel *Channel) error {
 	err := d.db.QueryRow(`
-		INSERT INTO channels (upload_id, name, build_id)
-		VALUES ($1, $2, $3) RETURNING id, created_at, updated_at`,
-		channel.UploadID, channel.Name, channel.CurrentBuildID).Scan(
+		INSERT INTO channels (upload_id, name, build_id, candidate_build_id, rollout_percent, rollout_paused, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`,
+		channel.UploadID, channel.Name, channel.CurrentBuildID, channel.CandidateBuildID,
+		channel.RolloutPercent, channel.RolloutPaused, channel.ExpiresAt).Scan(
 		&channel.ID, &channel.CreatedAt, &channel.UpdatedAt)
 	return err
 }
 
 func (d *PostgresDatabase) UpdateChannel(channel *Channel) error {
 	_, err := d.db.Exec(`
-		UPDATE channels SET upload_id = $1, name = $2, build_id = $3, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $4`,
-		channel.UploadID, channel.Name, channel.CurrentBuildID, channel.ID)
+		UPDATE channels SET upload_id = $1, name = $2, build_id = $3, candidate_build_id = $4,
+		       rollout_percent = $5, rollout_paused = $6, expires_at = $7, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $8`,
+		channel.UploadID, channel.Name, channel.CurrentBuildID, channel.CandidateBuildID,
+		channel.RolloutPercent, channel.RolloutPaused, channel.ExpiresAt, channel.ID)
+	return err
+}
+
+func (d *PostgresDatabase) GetChannelByID(id int64) (*Channel, error) {
+	channel := &Channel{}
+	var buildID, candidateBuildID sql.NullInt64
+	var expiresAt sql.NullTime
+	err := d.db.QueryRow(`
+		SELECT id, upload_id, name, build_id, candidate_build_id, COALESCE(rollout_percent, 0),
+		       COALESCE(rollout_paused, false), expires_at, created_at, updated_at
+		FROM channels WHERE id = $1`, id).Scan(
+		&channel.ID, &channel.UploadID, &channel.Name, &buildID,
+		&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+		&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if buildID.Valid {
+		channel.CurrentBuildID = &buildID.Int64
+	}
+	if candidateBuildID.Valid {
+		channel.CandidateBuildID = &candidateBuildID.Int64
+	}
+	if expiresAt.Valid {
+		channel.ExpiresAt = &expiresAt.Time
+	}
+	return channel, nil
+}
+
+func (d *PostgresDatabase) GetExpiringChannels() ([]*Channel, error) {
+	rows, err := d.db.Query(`
+		SELECT id, upload_id, name, build_id, candidate_build_id, COALESCE(rollout_percent, 0),
+		       COALESCE(rollout_paused, false), expires_at, created_at, updated_at
+		FROM channels WHERE expires_at IS NOT NULL ORDER BY expires_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []*Channel
+	for rows.Next() {
+		channel := &Channel{}
+		var buildID, candidateBuildID sql.NullInt64
+		var expiresAt sql.NullTime
+		err := rows.Scan(&channel.ID, &channel.UploadID, &channel.Name, &buildID,
+			&candidateBuildID, &channel.RolloutPercent, &channel.RolloutPaused,
+			&expiresAt, &channel.CreatedAt, &channel.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if buildID.Valid {
+			channel.CurrentBuildID = &buildID.Int64
+		}
+		if candidateBuildID.Valid {
+			channel.CandidateBuildID = &candidateBuildID.Int64
+		}
+		if expiresAt.Valid {
+			channel.ExpiresAt = &expiresAt.Time
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+func (d *PostgresDatabase) DeleteChannel(id int64) error {
+	return execInTx(d.db,
+		statement{`DELETE FROM channel_protections WHERE channel_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM scheduled_releases WHERE channel_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM channel_history WHERE channel_id = $1`, []interface{}{id}},
+		statement{`DELETE FROM channels WHERE id = $1`, []interface{}{id}},
+	)
+}
+
+// ChannelTTLRule methods
+func (d *PostgresDatabase) GetChannelTTLRules(gameID int64) ([]*ChannelTTLRule, error) {
+	rows, err := d.db.Query(`
+		SELECT id, game_id, pattern, ttl_seconds, created_at
+		FROM channel_ttl_rules WHERE game_id = $1 ORDER BY position, id`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*ChannelTTLRule
+	for rows.Next() {
+		rule := &ChannelTTLRule{}
+		if err := rows.Scan(&rule.ID, &rule.GameID, &rule.Pattern, &rule.TTLSeconds, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (d *PostgresDatabase) SetChannelTTLRules(gameID int64, rules []*ChannelTTLRule) error {
+	statements := []statement{{`DELETE FROM channel_ttl_rules WHERE game_id = $1`, []interface{}{gameID}}}
+	for i, rule := range rules {
+		statements = append(statements, statement{`
+			INSERT INTO channel_ttl_rules (game_id, position, pattern, ttl_seconds)
+			VALUES ($1, $2, $3, $4)`, []interface{}{gameID, i, rule.Pattern, rule.TTLSeconds}})
+	}
+	return execInTx(d.db, statements...)
+}
+
+// ChannelProtection methods
+func (d *PostgresDatabase) GetChannelProtection(channelID int64) (*ChannelProtection, error) {
+	protection := &ChannelProtection{}
+	var requiredLabels string
+	err := d.db.QueryRow(`
+		SELECT id, channel_id, restrict_push, user_version_pattern, promotion_only,
+		       COALESCE(required_labels, '[]'), created_at, updated_at
+		FROM channel_protections WHERE channel_id = $1`, channelID).Scan(
+		&protection.ID, &protection.ChannelID, &protection.RestrictPush,
+		&protection.UserVersionPattern, &protection.PromotionOnly, &requiredLabels,
+		&protection.CreatedAt, &protection.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	protection.RequiredLabels = decodeStringList(requiredLabels)
+	return protection, nil
+}
+
+func (d *PostgresDatabase) SaveChannelProtection(protection *ChannelProtection) error {
+	err := d.db.QueryRow(`
+		INSERT INTO channel_protections (channel_id, restrict_push, user_version_pattern, promotion_only, required_labels)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (channel_id) DO UPDATE SET
+			restrict_push = EXCLUDED.restrict_push,
+			user_version_pattern = EXCLUDED.user_version_pattern,
+			promotion_only = EXCLUDED.promotion_only,
+			required_labels = EXCLUDED.required_labels,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at, updated_at`,
+		protection.ChannelID, protection.RestrictPush,
+		protection.UserVersionPattern, protection.PromotionOnly, encodeStringList(protection.RequiredLabels)).Scan(
+		&protection.ID, &protection.CreatedAt, &protection.UpdatedAt)
 	return err
 }
+
+func (d *PostgresDatabase) DeleteChannelProtection(channelID int64) error {
+	_, err := d.db.Exec(`DELETE FROM channel_protections WHERE channel_id = $1`, channelID)
+	return err
+}
+
+// ScheduledRelease methods
+func (d *PostgresDatabase) CreateScheduledRelease(release *ScheduledRelease) error {
+	return d.db.QueryRow(`
+		INSERT INTO scheduled_releases (channel_id, build_id, release_at, state, created_by, error)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at`,
+		release.ChannelID, release.BuildID, release.ReleaseAt.UTC(), release.State, release.CreatedBy, release.Error).Scan(
+		&release.ID, &release.CreatedAt, &release.UpdatedAt)
+}
+
+func (d *PostgresDatabase) GetScheduledReleaseByID(id int64) (*ScheduledRelease, error) {
+	release := &ScheduledRelease{}
+	err := d.db.QueryRow(`
+		SELECT id, channel_id, build_id, release_at, state, created_by, error, created_at, updated_at
+		FROM scheduled_releases WHERE id = $1`, id).Scan(
+		&release.ID, &release.ChannelID, &release.BuildID, &release.ReleaseAt, &release.State,
+		&release.CreatedBy, &release.Error, &release.CreatedAt, &release.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+func (d *PostgresDatabase) GetScheduledReleasesByChannelID(channelID int64) ([]*ScheduledRelease, error) {
+	return d.queryScheduledReleases(`
+		SELECT id, channel_id, build_id, release_at, state, created_by, error, created_at, updated_at
+		FROM scheduled_releases WHERE channel_id = $1 ORDER BY release_at, id`, channelID)
+}
+
+func (d *PostgresDatabase) GetPendingScheduledReleases() ([]*ScheduledRelease, error) {
+	return d.queryScheduledReleases(`
+		SELECT id, channel_id, build_id, release_at, state, created_by, error, created_at, updated_at
+		FROM scheduled_releases WHERE state = $1 ORDER BY release_at, id`, ReleaseStatePending)
+}
+
+func (d *PostgresDatabase) queryScheduledReleases(query string, args ...interface{}) ([]*ScheduledRelease, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var releases []*ScheduledRelease
+	for rows.Next() {
+		release := &ScheduledRelease{}
+		err := rows.Scan(&release.ID, &release.ChannelID, &release.BuildID, &release.ReleaseAt, &release.State,
+			&release.CreatedBy, &release.Error, &release.CreatedAt, &release.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releases, rows.Err()
+}
+
+func (d *PostgresDatabase) SetScheduledReleaseState(id int64, from, to, errorMessage string) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE scheduled_releases SET state = $1, error = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND state = $4`, to, errorMessage, id, from)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ChannelHistory methods
+func (d *PostgresDatabase) CreateChannelHistoryEntry(entry *ChannelHistoryEntry) error {
+	return d.db.QueryRow(`
+		INSERT INTO channel_history (channel_id, previous_build_id, build_id, reason, username)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`,
+		entry.ChannelID, entry.PreviousBuildID, entry.BuildID, entry.Reason, entry.Username).Scan(
+		&entry.ID, &entry.CreatedAt)
+}
+
+func (d *PostgresDatabase) GetChannelHistory(channelID int64) ([]*ChannelHistoryEntry, error) {
+	rows, err := d.db.Query(`
+		SELECT id, channel_id, previous_build_id, build_id, reason, username, created_at
+		FROM channel_history WHERE channel_id = $1 ORDER BY id DESC`, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*ChannelHistoryEntry
+	for rows.Next() {
+		entry := &ChannelHistoryEntry{}
+		var previousBuildID, buildID sql.NullInt64
+		err := rows.Scan(&entry.ID, &entry.ChannelID, &previousBuildID, &buildID,
+			&entry.Reason, &entry.Username, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if previousBuildID.Valid {
+			entry.PreviousBuildID = &previousBuildID.Int64
+		}
+		if buildID.Valid {
+			entry.BuildID = &buildID.Int64
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
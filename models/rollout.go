@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// RolloutBucket places an install in one of 100 buckets for the channel's
+// current candidate. The bucket only depends on the channel, the candidate
+// and the install ID, so raising the percentage keeps earlier installs in
+// the rollout, while each new candidate reaches a different first group.
+func (c *Channel) RolloutBucket(installID string) int {
+	var candidateBuildID int64
+	if c.CandidateBuildID != nil {
+		candidateBuildID = *c.CandidateBuildID
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%d:%s", c.ID, candidateBuildID, installID)))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// InRollout reports whether an install should be offered the candidate build.
+// A paused rollout keeps the installs in its buckets, as its percentage can't
+// be raised until it is resumed; installs without an ID never get it.
+func (c *Channel) InRollout(installID string) bool {
+	if c.CandidateBuildID == nil || installID == "" {
+		return false
+	}
+	return c.RolloutBucket(installID) < c.RolloutPercent
+}
+
+// HeadForInstall returns the build an install should run: the candidate if
+// the install is part of the rollout, the channel's stable head otherwise
+func (c *Channel) HeadForInstall(installID string) *int64 {
+	if c.InRollout(installID) {
+		return c.CandidateBuildID
+	}
+	return c.CurrentBuildID
+}
+
+// ClearRollout drops the channel's candidate and resets the rollout state
+func (c *Channel) ClearRollout() {
+	c.CandidateBuildID = nil
+	c.RolloutPercent = 0
+	c.RolloutPaused = false
+}
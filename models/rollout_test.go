@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRolloutBucket(t *testing.T) {
+	head, candidate, otherCandidate := int64(1), int64(2), int64(3)
+	channel := &Channel{ID: 7, CurrentBuildID: &head, CandidateBuildID: &candidate, RolloutPercent: 50}
+
+	counts := make([]int, 100)
+	moved := 0
+	for i := 0; i < 10000; i++ {
+		installID := fmt.Sprintf("install-%d", i)
+		bucket := channel.RolloutBucket(installID)
+		if bucket < 0 || bucket >= 100 {
+			t.Fatalf("bucket %d of %s is out of range", bucket, installID)
+		}
+		if again := channel.RolloutBucket(installID); again != bucket {
+			t.Fatalf("bucket of %s changed from %d to %d", installID, bucket, again)
+		}
+		counts[bucket]++
+
+		// Another candidate reshuffles the installs
+		other := *channel
+		other.CandidateBuildID = &otherCandidate
+		if other.RolloutBucket(installID) != bucket {
+			moved++
+		}
+	}
+
+	for bucket, count := range counts {
+		if count < 50 || count > 150 {
+			t.Errorf("bucket %d holds %d of 10000 installs, expected about 100", bucket, count)
+		}
+	}
+	if moved < 9000 {
+		t.Errorf("only %d of 10000 installs changed bucket with a new candidate", moved)
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	head, candidate := int64(1), int64(2)
+
+	// Find installs on both sides of a 30 percent rollout
+	channel := &Channel{ID: 7, CurrentBuildID: &head, CandidateBuildID: &candidate}
+	var inside, outside string
+	for i := 0; inside == "" || outside == ""; i++ {
+		installID := fmt.Sprintf("install-%d", i)
+		if channel.RolloutBucket(installID) < 30 {
+			inside = installID
+		} else {
+			outside = installID
+		}
+	}
+
+	tests := []struct {
+		name      string
+		channel   Channel
+		installID string
+		want      bool
+	}{
+		{name: "inside the percentage", channel: Channel{CandidateBuildID: &candidate, RolloutPercent: 30}, installID: inside, want: true},
+		{name: "outside the percentage", channel: Channel{CandidateBuildID: &candidate, RolloutPercent: 30}, installID: outside, want: false},
+		{name: "paused keeps its buckets", channel: Channel{CandidateBuildID: &candidate, RolloutPercent: 30, RolloutPaused: true}, installID: inside, want: true},
+		{name: "paused adds no one", channel: Channel{CandidateBuildID: &candidate, RolloutPercent: 30, RolloutPaused: true}, installID: outside, want: false},
+		{name: "zero percent", channel: Channel{CandidateBuildID: &candidate}, installID: inside, want: false},
+		{name: "no install id", channel: Channel{CandidateBuildID: &candidate, RolloutPercent: 99}, installID: "", want: false},
+		{name: "no candidate", channel: Channel{RolloutPercent: 30}, installID: inside, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.channel
+			c.ID = channel.ID
+			c.CurrentBuildID = &head
+			if got := c.InRollout(tt.installID); got != tt.want {
+				t.Errorf("InRollout(%q) = %v, want %v", tt.installID, got, tt.want)
+			}
+
+			want := &head
+			if tt.want {
+				want = &candidate
+			}
+			if got := c.HeadForInstall(tt.installID); got != want {
+				t.Errorf("HeadForInstall(%q) = %d, want %d", tt.installID, *got, *want)
+			}
+		})
+	}
+}
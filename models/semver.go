@@ -0,0 +1,310 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version policies that can be set on a game to constrain user_version on pushes
+const (
+	VersionPolicyNone      = ""
+	VersionPolicyUnique    = "unique"
+	VersionPolicyMonotonic = "monotonic"
+)
+
+// ValidVersionPolicy returns true if the policy is one the server understands
+func ValidVersionPolicy(policy string) bool {
+	switch policy {
+	case VersionPolicyNone, VersionPolicyUnique, VersionPolicyMonotonic:
+		return true
+	}
+	return false
+}
+
+// Semver is a parsed semantic version (https://semver.org)
+type Semver struct {
+	Major      int64    `json:"major"`
+	Minor      int64    `json:"minor"`
+	Patch      int64    `json:"patch"`
+	Prerelease []string `json:"prerelease,omitempty"`
+	Metadata   string   `json:"metadata,omitempty"`
+}
+
+// ParseSemver parses a semantic version. A leading "v" is accepted, and
+// missing minor or patch components default to zero ("1.2" is "1.2.0").
+func ParseSemver(version string) (*Semver, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+
+	v := &Semver{}
+
+	if i := strings.Index(s, "+"); i >= 0 {
+		v.Metadata = s[i+1:]
+		s = s[:i]
+	}
+
+	if i := strings.Index(s, "-"); i >= 0 {
+		for _, identifier := range strings.Split(s[i+1:], ".") {
+			if identifier == "" {
+				return nil, fmt.Errorf("invalid prerelease in version '%s'", version)
+			}
+			v.Prerelease = append(v.Prerelease, identifier)
+		}
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("too many components in version '%s'", version)
+	}
+
+	numbers := []*int64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version '%s'", version)
+		}
+		*numbers[i] = n
+	}
+
+	return v, nil
+}
+
+// String formats the version in canonical form
+func (v *Semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Metadata != "" {
+		s += "+" + v.Metadata
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 depending on whether v sorts before, equal to or
+// after other, following semver precedence rules (build metadata is ignored)
+func (v *Semver) Compare(other *Semver) int {
+	for _, pair := range [][2]int64{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A version without prerelease has higher precedence than one with
+	if len(v.Prerelease) == 0 || len(other.Prerelease) == 0 {
+		switch {
+		case len(v.Prerelease) == len(other.Prerelease):
+			return 0
+		case len(v.Prerelease) == 0:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if c := comparePrerelease(v.Prerelease[i], other.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(v.Prerelease) < len(other.Prerelease):
+		return -1
+	case len(v.Prerelease) > len(other.Prerelease):
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares two prerelease identifiers: numeric identifiers
+// compare numerically and sort before alphanumeric ones
+func comparePrerelease(a, b string) int {
+	an, aErr := strconv.ParseInt(a, 10, 64)
+	bn, bErr := strconv.ParseInt(b, 10, 64)
+
+	switch {
+	case aErr == nil && bErr == nil:
+		if an < bn {
+			return -1
+		} else if an > bn {
+			return 1
+		}
+		return 0
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// VersionConstraint matches versions against a pattern such as "1.2.x",
+// "1.*" or an exact version like "1.2.3"
+type VersionConstraint struct {
+	parts []string
+	exact *Semver
+}
+
+// ParseVersionConstraint parses a version pattern. Components may be "x", "X"
+// or "*" to match anything; missing trailing components also match anything.
+func ParseVersionConstraint(pattern string) (*VersionConstraint, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(pattern), "v")
+	if s == "" {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+
+	parts := strings.Split(s, ".")
+	wildcard := len(parts) < 3
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = true
+		}
+	}
+
+	if !wildcard {
+		exact, err := ParseSemver(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint '%s'", pattern)
+		}
+		return &VersionConstraint{exact: exact}, nil
+	}
+
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version constraint '%s'", pattern)
+	}
+	for _, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			continue
+		}
+		if _, err := strconv.ParseInt(part, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid version constraint '%s'", pattern)
+		}
+	}
+
+	return &VersionConstraint{parts: parts}, nil
+}
+
+// Matches returns true if the version satisfies the constraint. Prereleases
+// only match wildcard constraints when the numeric components match.
+func (c *VersionConstraint) Matches(v *Semver) bool {
+	if c.exact != nil {
+		return c.exact.Compare(v) == 0
+	}
+
+	numbers := []int64{v.Major, v.Minor, v.Patch}
+	for i, part := range c.parts {
+		if part == "x" || part == "X" || part == "*" {
+			continue
+		}
+		n, _ := strconv.ParseInt(part, 10, 64)
+		if numbers[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
+// SortBuildsByVersion sorts builds by semantic version, highest first unless
+// ascending is set. Builds whose user_version isn't semver always sort last,
+// newest first, so results stay deterministic.
+func SortBuildsByVersion(builds []*Build, ascending bool) {
+	parsed := make(map[int64]*Semver, len(builds))
+	for _, build := range builds {
+		if v, err := ParseSemver(build.UserVersion); err == nil {
+			parsed[build.ID] = v
+		}
+	}
+
+	sort.SliceStable(builds, func(i, j int) bool {
+		vi, vj := parsed[builds[i].ID], parsed[builds[j].ID]
+		switch {
+		case vi == nil && vj == nil:
+			return builds[i].ID > builds[j].ID
+		case vi == nil:
+			return false
+		case vj == nil:
+			return true
+		}
+
+		c := vi.Compare(vj)
+		if c == 0 {
+			return builds[i].ID > builds[j].ID
+		}
+		if ascending {
+			return c < 0
+		}
+		return c > 0
+	})
+}
+
+// FilterBuildsByVersion returns the builds whose user_version satisfies the constraint
+func FilterBuildsByVersion(builds []*Build, constraint *VersionConstraint) []*Build {
+	var filtered []*Build
+	for _, build := range builds {
+		v, err := ParseSemver(build.UserVersion)
+		if err != nil {
+			continue
+		}
+		if constraint.Matches(v) {
+			filtered = append(filtered, build)
+		}
+	}
+	return filtered
+}
+
+// CheckVersionPolicy returns an error if pushing userVersion to a channel
+// would break the game's version policy. Head is the channel's current build
+// (may be nil) and channelBuilds are the builds the channel held before.
+// Unique doesn't apply to builds pushed without a user_version.
+func CheckVersionPolicy(policy, channelName, userVersion string, head *Build, channelBuilds []*Build) error {
+	switch policy {
+	case VersionPolicyNone:
+		return nil
+
+	case VersionPolicyUnique:
+		if userVersion == "" {
+			return nil
+		}
+		for _, build := range channelBuilds {
+			if build.State != "failed" && build.UserVersion == userVersion {
+				return fmt.Errorf("user_version '%s' was already pushed to channel '%s' (build %d)",
+					userVersion, channelName, build.ID)
+			}
+		}
+		return nil
+
+	case VersionPolicyMonotonic:
+		if userVersion == "" {
+			return fmt.Errorf("channel '%s' requires a user_version (butler push --userversion), the game's version policy is monotonic",
+				channelName)
+		}
+		v, err := ParseSemver(userVersion)
+		if err != nil {
+			return fmt.Errorf("user_version '%s' is not a valid semantic version, required for channel '%s'",
+				userVersion, channelName)
+		}
+		if head == nil {
+			return nil
+		}
+		current, err := ParseSemver(head.UserVersion)
+		if err != nil {
+			return nil
+		}
+		if v.Compare(current) <= 0 {
+			return fmt.Errorf("user_version '%s' must be greater than '%s', the current version on channel '%s'",
+				userVersion, head.UserVersion, channelName)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown version policy '%s'", policy)
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+		wantErr bool
+	}{
+		{version: "1.2.3", want: "1.2.3"},
+		{version: "v1.2.3", want: "1.2.3"},
+		{version: "1.2", want: "1.2.0"},
+		{version: "1", want: "1.0.0"},
+		{version: "1.0.0-rc.1", want: "1.0.0-rc.1"},
+		{version: "1.0.0+build.7", want: "1.0.0+build.7"},
+		{version: "1.0.0-beta+exp.sha.5114f85", want: "1.0.0-beta+exp.sha.5114f85"},
+		{version: "", wantErr: true},
+		{version: "1.0.0-", wantErr: true},
+		{version: "1.0.0-rc..1", wantErr: true},
+		{version: "1.2.3.4", wantErr: true},
+		{version: "1.-2.3", wantErr: true},
+		{version: "nightly-2024-05-01", wantErr: true},
+		{version: "a1b2c3d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			v, err := ParseSemver(tt.version)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSemver(%q) = %s, want an error", tt.version, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSemver(%q) failed: %v", tt.version, err)
+			}
+			if got := v.String(); got != tt.want {
+				t.Errorf("ParseSemver(%q) = %s, want %s", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "1.0.0", b: "1.0.0", want: 0},
+		{a: "1.0.0", b: "2.0.0", want: -1},
+		{a: "1.10.0", b: "1.9.0", want: 1},
+		{a: "1.0.10", b: "1.0.9", want: 1},
+		{a: "1.2", b: "1.2.0", want: 0},
+		// Prereleases sort before the release
+		{a: "1.0.0-alpha", b: "1.0.0", want: -1},
+		{a: "1.0.0", b: "1.0.0-rc.1", want: 1},
+		// The ordering example from the semver spec
+		{a: "1.0.0-alpha", b: "1.0.0-alpha.1", want: -1},
+		{a: "1.0.0-alpha.1", b: "1.0.0-alpha.beta", want: -1},
+		{a: "1.0.0-alpha.beta", b: "1.0.0-beta", want: -1},
+		{a: "1.0.0-beta", b: "1.0.0-beta.2", want: -1},
+		{a: "1.0.0-beta.2", b: "1.0.0-beta.11", want: -1},
+		{a: "1.0.0-beta.11", b: "1.0.0-rc.1", want: -1},
+		{a: "1.0.0-rc.1", b: "1.0.0-rc.1", want: 0},
+		// Build metadata doesn't take part in precedence
+		{a: "1.0.0+build.1", b: "1.0.0+build.2", want: 0},
+		{a: "1.0.0-rc.1+build.9", b: "1.0.0-rc.1", want: 0},
+		{a: "1.0.0+build.1", b: "1.0.1", want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			a, err := ParseSemver(tt.a)
+			if err != nil {
+				t.Fatalf("ParseSemver(%q) failed: %v", tt.a, err)
+			}
+			b, err := ParseSemver(tt.b)
+			if err != nil {
+				t.Fatalf("ParseSemver(%q) failed: %v", tt.b, err)
+			}
+			if got := a.Compare(b); got != tt.want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if got := b.Compare(a); got != -tt.want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+			}
+		})
+	}
+}
+
+func TestSortBuildsByVersion(t *testing.T) {
+	// Builds are given as id and user_version; ids are in push order
+	builds := func() []*Build {
+		return []*Build{
+			{ID: 1, UserVersion: "1.0.0"},
+			{ID: 2, UserVersion: "nightly"},
+			{ID: 3, UserVersion: "1.1.0-rc.1"},
+			{ID: 4, UserVersion: "1.1.0"},
+			{ID: 5, UserVersion: ""},
+			{ID: 6, UserVersion: "1.0.0+rebuild"},
+			{ID: 7, UserVersion: "1.1.0-beta.2"},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		ascending bool
+		want      []int64
+	}{
+		// Equal versions (1.0.0 and 1.0.0+rebuild) sort newest first, and
+		// non-semver builds come last, newest first, in both directions
+		{name: "descending", want: []int64{4, 3, 7, 6, 1, 5, 2}},
+		{name: "ascending", ascending: true, want: []int64{6, 1, 7, 3, 4, 5, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := builds()
+			SortBuildsByVersion(sorted, tt.ascending)
+			var got []int64
+			for _, build := range sorted {
+				got = append(got, build.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SortBuildsByVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionConstraintMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		version string
+		want    bool
+	}{
+		{pattern: "1.2.x", version: "1.2.7", want: true},
+		{pattern: "1.2.x", version: "1.3.0", want: false},
+		{pattern: "1.*", version: "1.9.9", want: true},
+		{pattern: "1", version: "1.4.0", want: true},
+		{pattern: "1.x", version: "1.4.0-rc.1", want: true},
+		{pattern: "1.2.3", version: "1.2.3+build.5", want: true},
+		{pattern: "1.2.3", version: "1.2.3-rc.1", want: false},
+		{pattern: "v2.0.0", version: "2.0.0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.version, func(t *testing.T) {
+			c, err := ParseVersionConstraint(tt.pattern)
+			if err != nil {
+				t.Fatalf("ParseVersionConstraint(%q) failed: %v", tt.pattern, err)
+			}
+			v, err := ParseSemver(tt.version)
+			if err != nil {
+				t.Fatalf("ParseSemver(%q) failed: %v", tt.version, err)
+			}
+			if got := c.Matches(v); got != tt.want {
+				t.Errorf("%s matches %s = %v, want %v", tt.pattern, tt.version, got, tt.want)
+			}
+		})
+	}
+
+	for _, pattern := range []string{"", "1.2.3.x", "1.y", "one.two.three"} {
+		if _, err := ParseVersionConstraint(pattern); err == nil {
+			t.Errorf("ParseVersionConstraint(%q) succeeded, want an error", pattern)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package wharf
+
+import "os"
+
+// Container describes the files, directories and symlinks of a build, as
+// stored at the start of wharf signatures and patches
+type Container struct {
+	Files    []*File
+	Dirs     []*Dir
+	Symlinks []*Symlink
+	Size     int64
+}
+
+// File is a regular file in a container
+type File struct {
+	Path   string
+	Mode   uint32
+	Size   int64
+	Offset int64
+}
+
+// Dir is a directory in a container
+type Dir struct {
+	Path string
+	Mode uint32
+}
+
+// Symlink is a symbolic link in a container
+type Symlink struct {
+	Path string
+	Mode uint32
+	Dest string
+}
+
+// IsExecutable returns true if any execute permission bit is set on the file
+func (f *File) IsExecutable() bool {
+	return os.FileMode(f.Mode)&0111 != 0
+}
+
+// decodeContainer decodes a tlc.Container message
+func decodeContainer(data []byte) (*Container, error) {
+	c := &Container{}
+	err := decodeFields(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			file := &File{}
+			err := decodeFields(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					file.Path = string(f.bytes)
+				case 2:
+					file.Mode = uint32(f.varint)
+				case 3:
+					file.Size = int64(f.varint)
+				case 4:
+					file.Offset = int64(f.varint)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			c.Files = append(c.Files, file)
+		case 2:
+			dir := &Dir{}
+			err := decodeFields(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					dir.Path = string(f.bytes)
+				case 2:
+					dir.Mode = uint32(f.varint)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			c.Dirs = append(c.Dirs, dir)
+		case 3:
+			symlink := &Symlink{}
+			err := decodeFields(f.bytes, func(f protoField) error {
+				switch f.num {
+				case 1:
+					symlink.Path = string(f.bytes)
+				case 2:
+					symlink.Mode = uint32(f.varint)
+				case 3:
+					symlink.Dest = string(f.bytes)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			c.Symlinks = append(c.Symlinks, symlink)
+		case 16:
+			c.Size = int64(f.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
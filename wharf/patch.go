@@ -0,0 +1,206 @@
+package wharf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Patch is an open wharf patch. The containers are read up front; the sync
+// operations that follow them are left on the stream.
+type Patch struct {
+	// Target is the container the patch applies to (the parent build)
+	Target *Container
+	// Source is the container the patch produces (the new build)
+	Source *Container
+
+	messages  *messageReader
+	closeBody func()
+}
+
+// OpenPatch reads the header and containers of a wharf patch
+func OpenPatch(r io.Reader) (*Patch, error) {
+	messages, closeBody, err := openStream(r, PatchMagic)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Patch{messages: messages, closeBody: closeBody}
+
+	for _, c := range []**Container{&p.Target, &p.Source} {
+		data, err := messages.readMessage()
+		if err != nil {
+			closeBody()
+			return nil, fmt.Errorf("failed to read container: %w", err)
+		}
+		*c, err = decodeContainer(data)
+		if err != nil {
+			closeBody()
+			return nil, fmt.Errorf("invalid container: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// Close releases the decompressor of the patch stream
+func (p *Patch) Close() {
+	p.closeBody()
+}
+
+// Sync header types
+const (
+	syncHeaderRsync  = 0
+	syncHeaderBsdiff = 1
+)
+
+// Sync operation types
+const (
+	syncOpBlockRange  = 0
+	syncOpData        = 1
+	syncOpHeyYouDidIt = 2049
+)
+
+// ErrBsdiffUnsupported is returned by Apply for optimized (bsdiff) patches
+var ErrBsdiffUnsupported = errors.New("bsdiff patches are not supported")
+
+// syncOp is a decoded SyncOp message
+type syncOp struct {
+	opType     int
+	fileIndex  int64
+	blockIndex int64
+	blockSpan  int64
+	data       []byte
+}
+
+// Apply reconstructs every file of the source container. openTarget opens a
+// file of the target container by index, create returns the writer the
+// content of a source file goes to; it is closed once the file is complete.
+func (p *Patch) Apply(openTarget func(index int64) (io.ReaderAt, error), create func(file *File) (io.WriteCloser, error)) error {
+	targets := make(map[int64]io.ReaderAt)
+
+	for i, file := range p.Source.Files {
+		data, err := p.messages.readMessage()
+		if err != nil {
+			return fmt.Errorf("failed to read sync header for %s: %w", file.Path, err)
+		}
+
+		var headerType int
+		var fileIndex int64
+		err = decodeFields(data, func(f protoField) error {
+			switch f.num {
+			case 1:
+				headerType = int(f.varint)
+			case 16:
+				fileIndex = int64(f.varint)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid sync header: %w", err)
+		}
+		if fileIndex != int64(i) {
+			return fmt.Errorf("sync header for file %d found where file %d was expected", fileIndex, i)
+		}
+		if headerType == syncHeaderBsdiff {
+			return ErrBsdiffUnsupported
+		}
+		if headerType != syncHeaderRsync {
+			return fmt.Errorf("unknown sync header type %d", headerType)
+		}
+
+		w, err := create(file)
+		if err != nil {
+			return err
+		}
+
+		written, err := p.applyFile(w, targets, openTarget)
+		if err != nil {
+			w.Close()
+			return fmt.Errorf("failed to patch %s: %w", file.Path, err)
+		}
+		if written != file.Size {
+			w.Close()
+			return fmt.Errorf("patched %s is %d bytes, expected %d", file.Path, written, file.Size)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// applyFile runs the sync operations of a single file and returns the number of bytes written
+func (p *Patch) applyFile(w io.Writer, targets map[int64]io.ReaderAt, openTarget func(index int64) (io.ReaderAt, error)) (int64, error) {
+	var written int64
+	for {
+		data, err := p.messages.readMessage()
+		if err != nil {
+			return written, fmt.Errorf("failed to read sync op: %w", err)
+		}
+
+		var op syncOp
+		err = decodeFields(data, func(f protoField) error {
+			switch f.num {
+			case 1:
+				op.opType = int(f.varint)
+			case 2:
+				op.fileIndex = int64(f.varint)
+			case 3:
+				op.blockIndex = int64(f.varint)
+			case 4:
+				op.blockSpan = int64(f.varint)
+			case 5:
+				op.data = f.bytes
+			}
+			return nil
+		})
+		if err != nil {
+			return written, fmt.Errorf("invalid sync op: %w", err)
+		}
+
+		switch op.opType {
+		case syncOpHeyYouDidIt:
+			return written, nil
+		case syncOpData:
+			n, err := w.Write(op.data)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		case syncOpBlockRange:
+			if op.fileIndex < 0 || op.fileIndex >= int64(len(p.Target.Files)) {
+				return written, fmt.Errorf("block range references unknown old file %d", op.fileIndex)
+			}
+
+			target, ok := targets[op.fileIndex]
+			if !ok {
+				target, err = openTarget(op.fileIndex)
+				if err != nil {
+					return written, err
+				}
+				targets[op.fileIndex] = target
+			}
+
+			// The last block of a file may be short
+			size := p.Target.Files[op.fileIndex].Size
+			offset := op.blockIndex * BlockSize
+			length := op.blockSpan * BlockSize
+			if offset+length > size {
+				length = size - offset
+			}
+			if length < 0 {
+				return written, fmt.Errorf("block range past the end of old file %d", op.fileIndex)
+			}
+
+			n, err := io.Copy(w, io.NewSectionReader(target, offset, length))
+			written += n
+			if err != nil {
+				return written, err
+			}
+		default:
+			return written, fmt.Errorf("unknown sync op type %d", op.opType)
+		}
+	}
+}
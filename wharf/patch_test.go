@@ -0,0 +1,178 @@
+package wharf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// memFile collects the content Apply writes for one file
+type memFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (m *memFile) Close() error {
+	m.closed = true
+	return nil
+}
+
+// applyFixture applies a patch fixture to the given old files, indexed like
+// the patch's target container, and returns the new files by path
+func applyFixture(t *testing.T, name string, old [][]byte) (map[string]*memFile, error) {
+	t.Helper()
+	patch, err := OpenPatch(bytes.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatalf("failed to open patch: %v", err)
+	}
+	defer patch.Close()
+
+	files := make(map[string]*memFile)
+	err = patch.Apply(func(index int64) (io.ReaderAt, error) {
+		if index >= int64(len(old)) {
+			return nil, errors.New("no such old file")
+		}
+		return bytes.NewReader(old[index]), nil
+	}, func(file *File) (io.WriteCloser, error) {
+		files[file.Path] = &memFile{}
+		return files[file.Path], nil
+	})
+	return files, err
+}
+
+func TestOpenPatch(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		wantTarget  []string
+		wantSource  []string
+		wantSymlink bool
+	}{
+		{fixture: "v1.pwr", wantSource: []string{"bin/run.sh", "data.bin", "empty.txt", "readme.txt"}, wantSymlink: true},
+		{fixture: "v2.pwr", wantTarget: []string{"bin/run.sh", "data.bin", "empty.txt", "readme.txt"}, wantSource: []string{"bin/run.sh", "data.bin", "readme.txt"}},
+		{fixture: "bsdiff.pwr", wantTarget: []string{"bin/run.sh", "data.bin", "empty.txt", "readme.txt"}, wantSource: []string{"bin/run.sh", "data.bin", "readme.txt"}},
+	}
+
+	paths := func(c *Container) []string {
+		var paths []string
+		for _, f := range c.Files {
+			paths = append(paths, f.Path)
+		}
+		return paths
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			patch, err := OpenPatch(bytes.NewReader(readFixture(t, tt.fixture)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer patch.Close()
+
+			if got := strings.Join(paths(patch.Target), ","); got != strings.Join(tt.wantTarget, ",") {
+				t.Errorf("expected target files %v, got %s", tt.wantTarget, got)
+			}
+			if got := strings.Join(paths(patch.Source), ","); got != strings.Join(tt.wantSource, ",") {
+				t.Errorf("expected source files %v, got %s", tt.wantSource, got)
+			}
+			if got := len(patch.Source.Symlinks) == 1; got != tt.wantSymlink {
+				t.Errorf("expected symlink %v, got %+v", tt.wantSymlink, patch.Source.Symlinks)
+			}
+		})
+	}
+}
+
+func TestOpenPatchErrors(t *testing.T) {
+	patch := readFixture(t, "v2.pwr")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "signature instead of patch", data: readFixture(t, "v1.pwr.sig"), wantErr: "wrong magic number"},
+		{name: "missing header", data: patch[:4], wantErr: "failed to read header"},
+		{name: "unknown compression", data: append([]byte{0x00, 0x5f, 0xef, 0x0f, 0x04, 0x0a, 0x02, 0x08, 0x09}, patch[11:]...), wantErr: "unsupported compression algorithm 9"},
+		{name: "missing containers", data: patch[:11], wantErr: "failed to read container"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := OpenPatch(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPatchApply(t *testing.T) {
+	var v1 [][]byte
+	for _, f := range v1Files {
+		v1 = append(v1, f.content)
+	}
+
+	tests := []struct {
+		name    string
+		fixture string
+		old     [][]byte
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "from nothing",
+			fixture: "v1.pwr",
+			want: map[string]string{
+				"bin/run.sh": "#!/bin/sh\necho hi\n",
+				"data.bin":   string(testData()),
+				"empty.txt":  "",
+				"readme.txt": "My game, version 1\n",
+			},
+		},
+		{
+			name:    "from parent",
+			fixture: "v2.pwr",
+			old:     v1,
+			want: map[string]string{
+				"bin/run.sh": "#!/bin/sh\necho hello\n",
+				"data.bin":   string(testData()),
+				"readme.txt": "My game, version 1\n",
+			},
+		},
+		{name: "parent files missing", fixture: "v2.pwr", old: v1[:2], wantErr: "no such old file"},
+		{name: "parent file too short", fixture: "v2.pwr", old: [][]byte{v1[0], v1[1][:BlockSize], v1[2], v1[3]}, wantErr: "patched data.bin is 65536 bytes, expected 70000"},
+		{name: "bsdiff", fixture: "bsdiff.pwr", old: v1, wantErr: ErrBsdiffUnsupported.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := applyFixture(t, tt.fixture, tt.old)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(files) != len(tt.want) {
+				t.Fatalf("expected %d files, got %d", len(tt.want), len(files))
+			}
+			for path, want := range tt.want {
+				got, ok := files[path]
+				if !ok {
+					t.Fatalf("%s was not written", path)
+				}
+				if got.String() != want {
+					t.Errorf("%s: expected %d bytes of content, got %d different bytes", path, len(want), got.Len())
+				}
+				if !got.closed {
+					t.Errorf("%s was not closed", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Package wharf reads the file formats butler uploads to the server: wharf
+// signatures and patches. Only the handful of protobuf messages those formats
+// use are decoded, so no generated protobuf code is needed.
+package wharf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// protoField is a single decoded field of a protobuf message
+type protoField struct {
+	num      int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+// decodeFields walks the fields of a serialized protobuf message in order
+func decodeFields(data []byte, fn func(f protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("invalid protobuf field key")
+		}
+		data = data[n:]
+
+		f := protoField{num: int(key >> 3), wireType: int(key & 7)}
+		switch f.wireType {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint in field %d", f.num)
+			}
+			f.varint = v
+			data = data[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return fmt.Errorf("invalid length in field %d", f.num)
+			}
+			f.bytes = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case wireFixed64:
+			if len(data) < 8 {
+				return fmt.Errorf("truncated fixed64 in field %d", f.num)
+			}
+			f.varint = binary.LittleEndian.Uint64(data)
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return fmt.Errorf("truncated fixed32 in field %d", f.num)
+			}
+			f.varint = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", f.wireType, f.num)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package wharf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []protoField
+		wantErr bool
+	}{
+		{name: "empty message", data: nil},
+		{name: "varint", data: []byte{0x08, 0x96, 0x01}, want: []protoField{{num: 1, wireType: wireVarint, varint: 150}}},
+		{name: "bytes", data: []byte{0x12, 0x02, 'h', 'i'}, want: []protoField{{num: 2, wireType: wireBytes, bytes: []byte("hi")}}},
+		{name: "fixed64", data: []byte{0x19, 1, 0, 0, 0, 0, 0, 0, 1}, want: []protoField{{num: 3, wireType: wireFixed64, varint: 1<<56 | 1}}},
+		{name: "fixed32", data: []byte{0x25, 0xff, 0, 0, 0}, want: []protoField{{num: 4, wireType: wireFixed32, varint: 255}}},
+		{name: "high field number", data: []byte{0x80, 0x01, 0x07}, want: []protoField{{num: 16, wireType: wireVarint, varint: 7}}},
+		{name: "fields in order", data: []byte{0x08, 0x01, 0x12, 0x00, 0x08, 0x02}, want: []protoField{
+			{num: 1, wireType: wireVarint, varint: 1},
+			{num: 2, wireType: wireBytes, bytes: []byte{}},
+			{num: 1, wireType: wireVarint, varint: 2},
+		}},
+		{name: "truncated key", data: []byte{0x80}, wantErr: true},
+		{name: "truncated varint", data: []byte{0x08, 0x96}, wantErr: true},
+		{name: "length past the end", data: []byte{0x12, 0x05, 'h', 'i'}, wantErr: true},
+		{name: "truncated fixed64", data: []byte{0x19, 1, 2, 3}, wantErr: true},
+		{name: "truncated fixed32", data: []byte{0x25, 1}, wantErr: true},
+		{name: "group wire type", data: []byte{0x0b}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []protoField
+			err := decodeFields(tt.data, func(f protoField) error {
+				got = append(got, f)
+				return nil
+			})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got fields %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected fields %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package wharf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// BlockHash is the weak and strong hash of one block of a file
+type BlockHash struct {
+	WeakHash   uint32
+	StrongHash []byte
+}
+
+// Signature is a decoded wharf signature: the build's container and the
+// block hashes of every file, in container order
+type Signature struct {
+	Container *Container
+	Hashes    [][]BlockHash // indexed like Container.Files
+}
+
+// ReadSignature decodes a wharf signature file
+func ReadSignature(r io.Reader) (*Signature, error) {
+	messages, closeBody, err := openStream(r, SignatureMagic)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody()
+
+	data, err := messages.readMessage()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container: %w", err)
+	}
+	container, err := decodeContainer(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container: %w", err)
+	}
+
+	var hashes []BlockHash
+	for {
+		data, err := messages.readMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read block hash: %w", err)
+		}
+
+		var hash BlockHash
+		err = decodeFields(data, func(f protoField) error {
+			switch f.num {
+			case 1:
+				hash.WeakHash = uint32(f.varint)
+			case 2:
+				hash.StrongHash = f.bytes
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid block hash: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	perFile, err := splitHashes(container, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{Container: container, Hashes: perFile}, nil
+}
+
+// splitHashes assigns the flat list of block hashes to the container's files.
+// Depending on the butler version, empty files get either no block hash or a
+// single one, so the total count decides which layout was used.
+func splitHashes(container *Container, hashes []BlockHash) ([][]BlockHash, error) {
+	var expected, emptyFiles int
+	for _, file := range container.Files {
+		expected += int(NumBlocks(file.Size))
+		if file.Size == 0 {
+			emptyFiles++
+		}
+	}
+
+	emptyBlocks := 0
+	switch len(hashes) {
+	case expected:
+	case expected + emptyFiles:
+		emptyBlocks = 1
+	default:
+		return nil, fmt.Errorf("signature has %d block hashes, expected %d for %d files", len(hashes), expected, len(container.Files))
+	}
+
+	perFile := make([][]BlockHash, len(container.Files))
+	offset := 0
+	for i, file := range container.Files {
+		n := int(NumBlocks(file.Size))
+		if file.Size == 0 {
+			n = emptyBlocks
+		}
+		perFile[i] = hashes[offset : offset+n]
+		offset += n
+	}
+	return perFile, nil
+}
+
+// FileHash returns a hex digest identifying the content of the file at index
+// i, computed as the SHA-256 of its strong block hashes. Two files with the
+// same digest have the same content.
+func (s *Signature) FileHash(i int) string {
+	h := sha256.New()
+	for _, block := range s.Hashes[i] {
+		h.Write(block.StrongHash)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// NumBlocks returns the number of blocks a file of the given size spans
+func NumBlocks(size int64) int64 {
+	return (size + BlockSize - 1) / BlockSize
+}
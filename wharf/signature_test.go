@@ -0,0 +1,185 @@
+package wharf
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The fixtures in testdata describe a small build:
+//
+//	v1.pwr      gzip patch from nothing to version 1
+//	v1.pwr.sig  uncompressed signature of version 1, no block hash for its empty file
+//	v2.pwr      zstd patch from version 1 to version 2, reusing blocks of data.bin and readme.txt
+//	bsdiff.pwr  optimized patch whose first file is a bsdiff
+//
+// Version 1 has the dir bin, the symlink latest -> bin/run.sh and the files below.
+var v1Files = []struct {
+	path    string
+	mode    uint32
+	content []byte
+}{
+	{"bin/run.sh", 0755, []byte("#!/bin/sh\necho hi\n")},
+	{"data.bin", 0644, testData()},
+	{"empty.txt", 0644, []byte{}},
+	{"readme.txt", 0644, []byte("My game, version 1\n")},
+}
+
+// testData returns the content of data.bin, which spans two blocks
+func testData() []byte {
+	data := make([]byte, 70000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return data
+}
+
+func TestReadSignature(t *testing.T) {
+	sig, err := ReadSignature(bytes.NewReader(readFixture(t, "v1.pwr.sig")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := sig.Container
+	if len(c.Files) != len(v1Files) {
+		t.Fatalf("expected %d files, got %d", len(v1Files), len(c.Files))
+	}
+	var offset int64
+	for i, want := range v1Files {
+		got := c.Files[i]
+		if got.Path != want.path || got.Mode != want.mode || got.Size != int64(len(want.content)) || got.Offset != offset {
+			t.Errorf("file %d: expected %s mode %o size %d offset %d, got %+v", i, want.path, want.mode, len(want.content), offset, got)
+		}
+		offset += int64(len(want.content))
+	}
+	if c.Size != offset {
+		t.Errorf("expected container size %d, got %d", offset, c.Size)
+	}
+	if len(c.Dirs) != 1 || c.Dirs[0].Path != "bin" || c.Dirs[0].Mode != 0755 {
+		t.Errorf("expected dir bin, got %+v", c.Dirs)
+	}
+	if len(c.Symlinks) != 1 || c.Symlinks[0].Path != "latest" || c.Symlinks[0].Dest != "bin/run.sh" {
+		t.Errorf("expected symlink latest -> bin/run.sh, got %+v", c.Symlinks)
+	}
+	if !c.Files[0].IsExecutable() || c.Files[3].IsExecutable() {
+		t.Errorf("expected only bin/run.sh to be executable")
+	}
+
+	for i, want := range v1Files {
+		if n := len(sig.Hashes[i]); int64(n) != NumBlocks(int64(len(want.content))) {
+			t.Errorf("%s: expected %d block hashes, got %d", want.path, NumBlocks(int64(len(want.content))), n)
+		}
+	}
+
+	// The fixture's strong hashes are the MD5 of each block
+	strong := md5.Sum(v1Files[3].content)
+	sum := sha256.Sum256(strong[:])
+	if got := sig.FileHash(3); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected readme.txt hash %x, got %s", sum, got)
+	}
+	if sig.FileHash(0) == sig.FileHash(3) {
+		t.Errorf("expected files with different content to have different hashes")
+	}
+}
+
+func TestReadSignatureErrors(t *testing.T) {
+	sig := readFixture(t, "v1.pwr.sig")
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{name: "empty file", data: nil, wantErr: "failed to read magic"},
+		{name: "patch instead of signature", data: readFixture(t, "v1.pwr"), wantErr: "wrong magic number"},
+		{name: "missing header", data: sig[:4], wantErr: "failed to read header"},
+		{name: "missing container", data: sig[:11], wantErr: "failed to read container"},
+		{name: "truncated block hash", data: sig[:len(sig)-5], wantErr: "failed to read block hash"},
+		{name: "missing block hash", data: sig[:len(sig)-21], wantErr: "signature has 3 block hashes, expected 4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadSignature(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSplitHashes(t *testing.T) {
+	container := &Container{Files: []*File{{Size: 10}, {Size: 0}, {Size: BlockSize + 1}}}
+	hash := func(n uint32) BlockHash { return BlockHash{WeakHash: n} }
+
+	tests := []struct {
+		name    string
+		hashes  []BlockHash
+		want    [][]BlockHash
+		wantErr bool
+	}{
+		{
+			name:   "no hash for empty files",
+			hashes: []BlockHash{hash(1), hash(2), hash(3)},
+			want:   [][]BlockHash{{hash(1)}, {}, {hash(2), hash(3)}},
+		},
+		{
+			name:   "one hash for empty files",
+			hashes: []BlockHash{hash(1), hash(2), hash(3), hash(4)},
+			want:   [][]BlockHash{{hash(1)}, {hash(2)}, {hash(3), hash(4)}},
+		},
+		{name: "too few hashes", hashes: []BlockHash{hash(1), hash(2)}, wantErr: true},
+		{name: "too many hashes", hashes: []BlockHash{hash(1), hash(2), hash(3), hash(4), hash(5)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitHashes(container, tt.hashes)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNumBlocks(t *testing.T) {
+	tests := []struct {
+		size int64
+		want int64
+	}{
+		{0, 0},
+		{1, 1},
+		{BlockSize, 1},
+		{BlockSize + 1, 2},
+		{3 * BlockSize, 3},
+	}
+
+	for _, tt := range tests {
+		if got := NumBlocks(tt.size); got != tt.want {
+			t.Errorf("NumBlocks(%d): expected %d, got %d", tt.size, tt.want, got)
+		}
+	}
+}
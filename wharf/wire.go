@@ -0,0 +1,140 @@
+package wharf
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic numbers at the start of wharf files
+const (
+	PatchMagic     = int32(0x0FEF5F00)
+	SignatureMagic = int32(0x0FEF5F01)
+)
+
+// Compression algorithms used by wharf
+const (
+	CompressionNone   = 0
+	CompressionBrotli = 1
+	CompressionGzip   = 2
+	CompressionZstd   = 3
+)
+
+// BlockSize is the size of the blocks wharf hashes and patches reference
+const BlockSize = 64 * 1024
+
+// maxMessageSize bounds a single message so corrupt input can't exhaust memory
+const maxMessageSize = 64 * 1024 * 1024
+
+// messageReader reads the length-prefixed protobuf messages of a wharf stream
+type messageReader struct {
+	r *bufio.Reader
+}
+
+func newMessageReader(r io.Reader) *messageReader {
+	return &messageReader{r: bufio.NewReader(r)}
+}
+
+// readMagic reads the little-endian magic number at the start of a wharf file
+func (m *messageReader) readMagic(expected int32) error {
+	var magic int32
+	if err := binary.Read(m.r, binary.LittleEndian, &magic); err != nil {
+		return fmt.Errorf("failed to read magic: %w", err)
+	}
+	if magic != expected {
+		return fmt.Errorf("wrong magic number %#x, expected %#x", magic, expected)
+	}
+	return nil
+}
+
+// readMessage returns the next message, or io.EOF at the end of the stream
+func (m *messageReader) readMessage() ([]byte, error) {
+	length, err := binary.ReadUvarint(m.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+	if length > maxMessageSize {
+		return nil, fmt.Errorf("message too large (%d bytes)", length)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(m.r, buf); err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return buf, nil
+}
+
+// decodeCompressionHeader decodes a PatchHeader or SignatureHeader message and
+// returns the compression algorithm of the rest of the stream
+func decodeCompressionHeader(data []byte) (int, error) {
+	algorithm := CompressionNone
+	err := decodeFields(data, func(f protoField) error {
+		if f.num != 1 {
+			return nil
+		}
+		return decodeFields(f.bytes, func(f protoField) error {
+			if f.num == 1 {
+				algorithm = int(f.varint)
+			}
+			return nil
+		})
+	})
+	return algorithm, err
+}
+
+// decompress wraps the compressed part of a wharf stream. The returned close
+// function releases decoder resources.
+func decompress(r io.Reader, algorithm int) (io.Reader, func(), error) {
+	switch algorithm {
+	case CompressionNone:
+		return r, func() {}, nil
+	case CompressionBrotli:
+		return brotli.NewReader(r), func() {}, nil
+	case CompressionGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		return gz, func() { gz.Close() }, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		return zr, zr.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported compression algorithm %d", algorithm)
+}
+
+// openStream checks the magic number and header of a wharf file and returns a
+// message reader over its decompressed body
+func openStream(r io.Reader, magic int32) (*messageReader, func(), error) {
+	raw := newMessageReader(r)
+	if err := raw.readMagic(magic); err != nil {
+		return nil, nil, err
+	}
+
+	header, err := raw.readMessage()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	algorithm, err := decodeCompressionHeader(header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	body, closeBody, err := decompress(raw.r, algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newMessageReader(body), closeBody, nil
+}